@@ -0,0 +1,239 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The six ability scores, in stat-block order. abilityScores is indexed
+// by these.
+const (
+	abilityStr = iota
+	abilityDex
+	abilityCon
+	abilityInt
+	abilityWis
+	abilityCha
+)
+
+// abilityCodes are the short names used in forms, the database and
+// exports; abilityNames are for display.
+var (
+	abilityCodes = [6]string{"str", "dex", "con", "int", "wis", "cha"}
+	abilityNames = [6]string{"Strength", "Dexterity", "Constitution", "Intelligence", "Wisdom", "Charisma"}
+)
+
+const (
+	defaultScore     = 10
+	defaultProfBonus = 2
+)
+
+// abilityScores holds STR through CHA. The zero value means "not given",
+// which storage treats as all 10s.
+type abilityScores [6]int
+
+func defaultScores() abilityScores {
+	return abilityScores{defaultScore, defaultScore, defaultScore, defaultScore, defaultScore, defaultScore}
+}
+
+// parseAbility reads "dex", "DEX" or "dexterity".
+func parseAbility(s string) (int, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i := range abilityCodes {
+		if s == abilityCodes[i] || s == strings.ToLower(abilityNames[i]) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// abilityModifier is the usual (score - 10) / 2, rounded down.
+func abilityModifier(score int) int {
+	return score/2 - 5
+}
+
+// Modifier is m's modifier for ability a.
+func (m Minion) Modifier(a int) int {
+	return abilityModifier(m.Scores[a])
+}
+
+// ProficientSave reports whether m adds its proficiency bonus to saves
+// with ability a.
+func (m Minion) ProficientSave(a int) bool {
+	for _, s := range m.Saves {
+		if s == abilityCodes[a] {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveBonus is what m adds to a d20 saving throw with ability a.
+func (m Minion) SaveBonus(a int) int {
+	bonus := m.Modifier(a)
+	if m.ProficientSave(a) {
+		bonus += m.ProfBonus
+	}
+	return bonus
+}
+
+// abilityView is one ability as minion-row and minion-edit show it.
+type abilityView struct {
+	Index      int
+	Code       string
+	Label      string
+	Score      int
+	Mod        int
+	Save       int
+	Proficient bool
+}
+
+// Abilities lists m's six abilities for the templates.
+func (m Minion) Abilities() []abilityView {
+	views := make([]abilityView, len(abilityCodes))
+	for i, code := range abilityCodes {
+		views[i] = abilityView{
+			Index:      i,
+			Code:       code,
+			Label:      strings.ToUpper(code),
+			Score:      m.Scores[i],
+			Mod:        m.Modifier(i),
+			Save:       m.SaveBonus(i),
+			Proficient: m.ProficientSave(i),
+		}
+	}
+	return views
+}
+
+// signed formats a bonus as "+2" or "-1".
+func signed(n int) string {
+	if n >= 0 {
+		return "+" + strconv.Itoa(n)
+	}
+	return strconv.Itoa(n)
+}
+
+// normalizeSaves keeps the known ability codes from saves, once each and
+// in stat-block order.
+func normalizeSaves(saves []string) []string {
+	var out []string
+	for _, code := range abilityCodes {
+		for _, s := range saves {
+			if a, ok := parseAbility(s); ok && abilityCodes[a] == code {
+				out = append(out, code)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// parseSaves reads the saves column, a comma-separated list of codes. It
+// never returns nil, so a loaded minion written back keeps no saves as no
+// saves.
+func parseSaves(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+// Save roll modes.
+const (
+	rollNormal       = ""
+	rollAdvantage    = "advantage"
+	rollDisadvantage = "disadvantage"
+)
+
+// saveResult is one resolved saving throw.
+type saveResult struct {
+	Minion  *Minion
+	Ability int
+	DC      int
+	Mode    string
+	Rolls   []int // both dice with advantage or disadvantage
+	Roll    int   // the die that counts
+	Bonus   int
+	Total   int
+	Passed  bool
+}
+
+// AbilityName is the full name of the ability saved with.
+func (r saveResult) AbilityName() string {
+	return abilityNames[r.Ability]
+}
+
+// rollSave rolls m's saving throw with ability a against dc.
+func rollSave(m *Minion, a, dc int, mode string) saveResult {
+	res := saveResult{Minion: m, Ability: a, DC: dc, Mode: mode, Bonus: m.SaveBonus(a)}
+	res.Rolls = []int{rollDie(20)}
+	res.Roll = res.Rolls[0]
+	if mode == rollAdvantage || mode == rollDisadvantage {
+		second := rollDie(20)
+		res.Rolls = append(res.Rolls, second)
+		if (mode == rollAdvantage) == (second > res.Roll) {
+			res.Roll = second
+		}
+	}
+	res.Total = res.Roll + res.Bonus
+	res.Passed = res.Total >= dc
+	return res
+}
+
+// saveEvent is the history entry for a saving throw.
+func saveEvent(res saveResult) minionEvent {
+	outcome := "failed"
+	if res.Passed {
+		outcome = "passed"
+	}
+	return minionEvent{Kind: eventSave, Detail: fmt.Sprintf("%s %d vs DC %d, %s",
+		strings.ToUpper(abilityCodes[res.Ability]), res.Total, res.DC, outcome)}
+}
+
+// parseSaveRequest reads the ability, dc and mode form values shared by
+// every form that asks for a saving throw.
+func parseSaveRequest(r *http.Request) (ability, dc int, mode string, err error) {
+	ability, ok := parseAbility(r.FormValue("ability"))
+	if !ok {
+		return 0, 0, "", errors.New("choose an ability to save with")
+	}
+	dc, err = strconv.Atoi(r.FormValue("dc"))
+	if err != nil || dc < 1 || dc > 40 {
+		return 0, 0, "", errors.New("DC must be a number from 1 to 40")
+	}
+	switch mode = r.FormValue("mode"); mode {
+	case rollNormal, rollAdvantage, rollDisadvantage:
+	default:
+		mode = rollNormal
+	}
+	return ability, dc, mode, nil
+}
+
+func handleSave(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	m, err := getMinion(campaignID(r), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	r.ParseForm()
+	ability, dc, mode, err := parseSaveRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res := rollSave(m, ability, dc, mode)
+	if err := logEvent(db, campaignID(r), id, saveEvent(res)); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "save-result", res)
+}
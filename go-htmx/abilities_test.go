@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAbilityModifier(t *testing.T) {
+	for score, want := range map[int]int{1: -5, 3: -4, 8: -1, 9: -1, 10: 0, 11: 0, 12: 1, 20: 5, 30: 10} {
+		if got := abilityModifier(score); got != want {
+			t.Errorf("abilityModifier(%d) = %d, want %d", score, got, want)
+		}
+	}
+}
+
+func TestParseAbility(t *testing.T) {
+	for in, want := range map[string]int{"str": abilityStr, "DEX": abilityDex, " Constitution ": abilityCon, "cha": abilityCha} {
+		if got, ok := parseAbility(in); !ok || got != want {
+			t.Errorf("parseAbility(%q) = %d, %v, want %d", in, got, ok, want)
+		}
+	}
+	if _, ok := parseAbility("luck"); ok {
+		t.Error("Expected luck to be rejected")
+	}
+	if got := normalizeSaves([]string{"wis", "Dexterity", "luck", "dex"}); !reflect.DeepEqual(got, []string{"dex", "wis"}) {
+		t.Errorf("Expected saves in stat-block order, got %v", got)
+	}
+}
+
+func TestSaveBonus(t *testing.T) {
+	m := Minion{Scores: abilityScores{8, 14, 10, 10, 13, 8}, Saves: []string{"wis"}, ProfBonus: 3}
+	if got := m.SaveBonus(abilityDex); got != 2 {
+		t.Errorf("Expected +2 DEX save, got %d", got)
+	}
+	if got := m.SaveBonus(abilityWis); got != 4 {
+		t.Errorf("Expected +4 proficient WIS save, got %d", got)
+	}
+	if signed(m.SaveBonus(abilityStr)) != "-1" || signed(0) != "+0" {
+		t.Errorf("Expected signed bonuses, got %s and %s", signed(m.SaveBonus(abilityStr)), signed(0))
+	}
+}
+
+func TestRollSave(t *testing.T) {
+	m := &Minion{Scores: abilityScores{10, 14, 10, 10, 10, 10}}
+
+	fixedRolls(t, 11)
+	if res := rollSave(m, abilityDex, 13, rollNormal); res.Total != 13 || !res.Passed {
+		t.Errorf("Expected 11+2 to meet DC 13, got %+v", res)
+	}
+
+	fixedRolls(t, 4, 17)
+	if res := rollSave(m, abilityDex, 15, rollAdvantage); res.Roll != 17 || !res.Passed || len(res.Rolls) != 2 {
+		t.Errorf("Expected advantage to keep the 17, got %+v", res)
+	}
+
+	fixedRolls(t, 4, 17)
+	if res := rollSave(m, abilityDex, 15, rollDisadvantage); res.Roll != 4 || res.Passed {
+		t.Errorf("Expected disadvantage to keep the 4, got %+v", res)
+	}
+}
+
+func TestAbilitiesStored(t *testing.T) {
+	testDB := useTestDB(t)
+
+	id := createTestMinion(t, testDB, &Minion{Name: "Bandit", HP: 11, MaxHP: 11})
+	m, _ := getMinion(defaultCampaignID, id)
+	if m.Scores != defaultScores() || m.ProfBonus != defaultProfBonus || len(m.Saves) != 0 {
+		t.Errorf("Expected default scores, got %+v", m)
+	}
+
+	m.Scores[abilityStr] = 16
+	m.Saves = []string{"str", "con"}
+	m.ProfBonus = 3
+	if err := updateMinion(defaultCampaignID, m); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	got, _ := getMinion(defaultCampaignID, id)
+	if got.Scores[abilityStr] != 16 || !reflect.DeepEqual(got.Saves, []string{"str", "con"}) || got.ProfBonus != 3 {
+		t.Errorf("Expected scores and saves to round-trip, got %+v", got)
+	}
+
+	// An edit that leaves them out keeps them
+	got.Scores, got.Saves, got.ProfBonus = abilityScores{}, nil, 0
+	if err := updateMinion(defaultCampaignID, got); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if kept, _ := getMinion(defaultCampaignID, id); kept.Scores[abilityStr] != 16 || len(kept.Saves) != 2 || kept.ProfBonus != 3 {
+		t.Errorf("Expected stored abilities to be kept, got %+v", kept)
+	}
+}
+
+func TestHandleUpdateAbilities(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	id := createTestMinion(t, testDB, &Minion{Name: "Bandit", HP: 11, MaxHP: 11})
+	path := "/c/default/minions/" + itoa64(id)
+
+	form := "name=Bandit&hp=11&max_hp=11&ac=12&attack=3&str=11&dex=12&con=12&int=10&wis=10&cha=10&saves=dex&prof_bonus=2"
+	if rec := serveAs(t, token, "PUT", path, strings.NewReader(form)); !contains(rec.Body.String(), "DEX</strong> 12 (&#43;1)") {
+		t.Errorf("Expected the row to show the new scores, got %s", rec.Body.String())
+	}
+
+	// Unticking every save clears them
+	serveAs(t, token, "PUT", path, strings.NewReader("name=Bandit&hp=11&max_hp=11&ac=12&attack=3&prof_bonus=2"))
+	m, _ := getMinion(defaultCampaignID, id)
+	if len(m.Saves) != 0 || m.Scores[abilityDex] != 12 {
+		t.Errorf("Expected saves cleared and scores kept, got %+v", m)
+	}
+}
+
+func TestHandleSave(t *testing.T) {
+	useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	id := insertTestMinion(t, &Minion{Name: "Bandit", HP: 11, MaxHP: 11, Active: true,
+		Scores: abilityScores{11, 12, 12, 10, 10, 10}, Saves: []string{"dex"}, ProfBonus: 2}).ID
+	path := "/c/default/minions/" + itoa64(id) + "/save"
+
+	fixedRolls(t, 12)
+	rec := serveAs(t, token, "POST", path, strings.NewReader("ability=dex&dc=15"))
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), "Saved") || !contains(rec.Body.String(), "Dexterity save 15 vs DC 15") {
+		t.Errorf("Expected 12+3 to pass DC 15, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	fixedRolls(t, 12)
+	if rec := serveAs(t, token, "POST", path, strings.NewReader("ability=con&dc=15")); !contains(rec.Body.String(), "Failed") {
+		t.Errorf("Expected 12+1 to fail DC 15, got %s", rec.Body.String())
+	}
+
+	for _, form := range []string{"ability=luck&dc=10", "ability=dex&dc=0", "ability=dex"} {
+		if rec := serveAs(t, token, "POST", path, strings.NewReader(form)); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %q, got %d", form, rec.Code)
+		}
+	}
+
+	events, _ := listEvents(defaultCampaignID, id)
+	if len(events) != 2 || events[0].Detail != "DEX 15 vs DC 15, passed" || events[1].Detail != "CON 13 vs DC 15, failed" {
+		t.Errorf("Expected both saves in the history, got %+v", events)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// attack is one of a minion's named attacks. Uses is how many times it is
+// made as part of the minion's multiattack; zero leaves it out.
+type attack struct {
+	Name       string `json:"name"`
+	ToHit      int    `json:"to_hit"`
+	Damage     string `json:"damage"`
+	Reach      string `json:"reach,omitempty"` // "5 ft." or "range 30/120 ft."
+	DamageType string `json:"damage_type,omitempty"`
+	Uses       int    `json:"uses,omitempty"`
+}
+
+// parseAttacks reads the attacks column minionSelect builds.
+func parseAttacks(s string) ([]attack, error) {
+	var attacks []attack
+	if err := json.Unmarshal([]byte(s), &attacks); err != nil {
+		return nil, err
+	}
+	if len(attacks) == 0 {
+		return nil, nil
+	}
+	return attacks, nil
+}
+
+// setMinionAttacks replaces a minion's attacks.
+func setMinionAttacks(q querier, minionID int64, attacks []attack) error {
+	if _, err := q.Exec(`DELETE FROM attacks WHERE minion_id = ?`, minionID); err != nil {
+		return err
+	}
+	for i, a := range attacks {
+		if _, err := q.Exec(
+			`INSERT INTO attacks (minion_id, position, name, to_hit, damage, reach, damage_type, uses)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			minionID, i, a.Name, a.ToHit, a.Damage, a.Reach, a.DamageType, a.Uses); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Multiattack describes m's multiattack, e.g. "2× Greatclub, Javelin", or
+// is empty when it has none.
+func (m Minion) Multiattack() string {
+	var parts []string
+	for _, a := range m.Attacks {
+		switch {
+		case a.Uses == 1:
+			parts = append(parts, a.Name)
+		case a.Uses > 1:
+			parts = append(parts, strconv.Itoa(a.Uses)+"× "+a.Name)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// attackRoll is one resolved attack. Hit is only meaningful when the
+// target's AC was given.
+type attackRoll struct {
+	Attack attack
+	Roll   int // the d20
+	Total  int
+	Crit   bool
+	Hit    bool
+	Damage int
+}
+
+// attackRolls is the combined result of rolling a minion's attacks.
+type attackRolls struct {
+	Minion   *Minion
+	Target   *Minion // the PC or ally attacked, if one was picked
+	TargetAC int     // zero when not given
+	Rolls    []attackRoll
+	Damage   int  // from hits, or from every attack without a target AC
+	IsGM     bool // whether the roller may apply the damage to Target
+}
+
+// attackSequence is what "roll all attacks" makes: the multiattack when m
+// has one, otherwise each attack once. A minion without named attacks
+// makes its single Attack/Damage attack.
+func (m Minion) attackSequence() []attack {
+	var seq []attack
+	for _, a := range m.Attacks {
+		for range a.Uses {
+			seq = append(seq, a)
+		}
+	}
+	if len(seq) > 0 {
+		return seq
+	}
+	if len(m.Attacks) > 0 {
+		return m.Attacks
+	}
+	return []attack{{Name: "Attack", ToHit: m.Attack, Damage: m.Damage}}
+}
+
+// rollAttacks rolls m's attack sequence against targetAC, or without a
+// target when it is zero. A natural 20 hits and doubles the damage dice;
+// a natural 1 misses, so its damage never counts, target or not.
+func rollAttacks(m *Minion, targetAC int) attackRolls {
+	res := attackRolls{Minion: m, TargetAC: targetAC}
+	for _, a := range m.attackSequence() {
+		r := attackRoll{Attack: a, Roll: rollDie(20)}
+		r.Total = r.Roll + a.ToHit
+		r.Crit = r.Roll == 20
+		r.Hit = r.Crit || (r.Roll != 1 && r.Total >= targetAC)
+		if d, err := parseDamage(a.Damage); err == nil {
+			if r.Crit {
+				d = d.Crit()
+			}
+			r.Damage = d.Roll()
+		}
+		if r.Hit || (targetAC == 0 && r.Roll != 1) {
+			res.Damage += r.Damage
+		}
+		res.Rolls = append(res.Rolls, r)
+	}
+	return res
+}
+
+// parseAttackForm reads the attack rows of the edit form, which come as
+// parallel atk_* lists. Rows without a name are dropped, so blank rows
+// are how attacks are added and clearing a name removes one. It returns
+// nil when the form had no attack rows at all.
+func parseAttackForm(r *http.Request) []attack {
+	if _, ok := r.Form["atk_name"]; !ok {
+		return nil
+	}
+	field := func(key string, i int) string {
+		if v := r.Form[key]; i < len(v) {
+			return strings.TrimSpace(v[i])
+		}
+		return ""
+	}
+	attacks := []attack{}
+	for i, name := range r.Form["atk_name"] {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		a := attack{Name: name, Damage: field("atk_damage", i), Reach: field("atk_reach", i), DamageType: field("atk_type", i)}
+		a.ToHit, _ = strconv.Atoi(field("atk_to_hit", i))
+		if n, err := strconv.Atoi(field("atk_uses", i)); err == nil && n > 0 {
+			a.Uses = n
+		}
+		attacks = append(attacks, a)
+	}
+	return attacks
+}
+
+func handleRollAttacks(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	m, err := getMinion(campaignID(r), id)
+	if err != nil {
+		http.Error(w, "not found", 404)
+		return
+	}
+	r.ParseForm()
+	target, err := attackTarget(r)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "target not found", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	ac := 0
+	if v := r.FormValue("target_ac"); target != nil && target.AC > 0 {
+		ac = target.AC
+	} else if v != "" {
+		if ac, err = strconv.Atoi(v); err != nil || ac < 1 {
+			http.Error(w, "target AC must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+	res := rollAttacks(m, ac)
+	res.Target, res.IsGM = target, campaignFor(r).IsGM()
+	tmpl.ExecuteTemplate(w, "attack-rolls", res)
+}
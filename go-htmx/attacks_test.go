@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func ogreAttacks() []attack {
+	return []attack{
+		{Name: "Greatclub", ToHit: 6, Damage: "2d8+4", Reach: "reach 5 ft.", DamageType: "bludgeoning", Uses: 2},
+		{Name: "Javelin", ToHit: 6, Damage: "2d6+4", Reach: "range 30/120 ft.", DamageType: "piercing"},
+	}
+}
+
+func TestAttackSequence(t *testing.T) {
+	m := Minion{Attack: 3, Damage: "1d6+1"}
+	if seq := m.attackSequence(); len(seq) != 1 || seq[0].ToHit != 3 || seq[0].Damage != "1d6+1" {
+		t.Errorf("Expected the single attack, got %+v", seq)
+	}
+
+	m.Attacks = ogreAttacks()
+	if seq := m.attackSequence(); len(seq) != 2 || seq[0].Name != "Greatclub" || seq[1].Name != "Greatclub" {
+		t.Errorf("Expected two greatclub swings, got %+v", seq)
+	}
+	if m.Multiattack() != "2× Greatclub" {
+		t.Errorf("Unexpected multiattack %q", m.Multiattack())
+	}
+
+	m.Attacks[0].Uses = 0
+	if seq := m.attackSequence(); len(seq) != 2 || seq[1].Name != "Javelin" || m.Multiattack() != "" {
+		t.Errorf("Expected each attack once without a multiattack, got %+v", seq)
+	}
+}
+
+func TestRollAttacks(t *testing.T) {
+	m := &Minion{Attacks: ogreAttacks()}
+
+	// Greatclub hits on 9+6 and rolls 3+5+4; the second is a natural 20
+	// and doubles its dice to 1+2+3+4+4
+	fixedRolls(t, 9, 3, 5, 20, 1, 2, 3, 4)
+	res := rollAttacks(m, 15)
+	if len(res.Rolls) != 2 || !res.Rolls[0].Hit || res.Rolls[0].Damage != 12 {
+		t.Fatalf("Expected a 12 damage hit first, got %+v", res.Rolls)
+	}
+	if !res.Rolls[1].Crit || res.Rolls[1].Damage != 14 || res.Damage != 26 {
+		t.Errorf("Expected a 14 damage critical and 26 in all, got %+v", res)
+	}
+
+	// A natural 1 misses whatever the bonus; without a target AC every
+	// other attack's damage counts
+	fixedRolls(t, 1, 4, 4, 8, 4, 4)
+	if res := rollAttacks(m, 5); res.Rolls[0].Hit || res.Damage != 12 {
+		t.Errorf("Expected only the second swing to land, got %+v", res)
+	}
+	fixedRolls(t, 1, 4, 4, 8, 4, 4)
+	if res := rollAttacks(m, 0); res.Damage != 12 {
+		t.Errorf("Expected the natural 1 left out without a target, got %+v", res)
+	}
+	fixedRolls(t, 2, 4, 4, 8, 4, 4)
+	if res := rollAttacks(m, 0); res.Damage != 24 {
+		t.Errorf("Expected 24 damage without a target, got %+v", res)
+	}
+}
+
+func TestAttacksStored(t *testing.T) {
+	useTestDB(t)
+
+	m := insertTestMinion(t, &Minion{Name: "Ogre", HP: 59, MaxHP: 59, Active: true, Attacks: ogreAttacks()})
+	got, _ := getMinion(defaultCampaignID, m.ID)
+	if !reflect.DeepEqual(got.Attacks, ogreAttacks()) {
+		t.Errorf("Expected attacks to round-trip, got %+v", got.Attacks)
+	}
+
+	// nil keeps them, an empty list clears them
+	got.Attacks = nil
+	updateMinion(defaultCampaignID, got)
+	if kept, _ := getMinion(defaultCampaignID, m.ID); len(kept.Attacks) != 2 {
+		t.Errorf("Expected attacks kept, got %+v", kept.Attacks)
+	}
+	got.Attacks = []attack{}
+	updateMinion(defaultCampaignID, got)
+	if cleared, _ := getMinion(defaultCampaignID, m.ID); cleared.Attacks != nil {
+		t.Errorf("Expected attacks cleared, got %+v", cleared.Attacks)
+	}
+
+	spawned, err := spawnMob(defaultCampaignID, insertTestMinion(t, &Minion{Name: "Ogre", HP: 59, MaxHP: 59, Bestiary: true,
+		Attacks: ogreAttacks()}).ID, 3, 0)
+	if err != nil || len(spawned.Attacks) != 2 {
+		t.Errorf("Expected a spawned mob to copy the attacks, got %+v, %v", spawned, err)
+	}
+}
+
+func TestSRDMultiattack(t *testing.T) {
+	monsters, err := parseSRDMonsters([]byte(`{"name":"Bugbear Chief","hit_points":65,"actions":[
+		{"name":"Multiattack","actions":[{"action_name":"Morningstar","count":"2","type":"melee"}]},
+		{"name":"Morningstar","attack_bonus":5,"damage":[{"damage_type":{"index":"piercing"},"damage_dice":"2d8+3"}]},
+		{"name":"Javelin","attack_bonus":5,"damage":[{"damage_type":{"index":"piercing"},"damage_dice":"2d6+3"}]}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	m, err := monsters[0].toMinion()
+	if err != nil {
+		t.Fatalf("Mapping failed: %v", err)
+	}
+	if len(m.Attacks) != 2 || m.Attacks[0].Uses != 2 || m.Attacks[1].Uses != 0 || m.Multiattack() != "2× Morningstar" {
+		t.Errorf("Expected two morningstar attacks, got %+v", m.Attacks)
+	}
+}
+
+func TestHandleUpdateAttacks(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	id := createTestMinion(t, testDB, &Minion{Name: "Ogre", HP: 59, MaxHP: 59, Attack: 1, Damage: "1"})
+	path := "/c/default/minions/" + itoa64(id)
+
+	form := url.Values{
+		"name": {"Ogre"}, "hp": {"59"}, "max_hp": {"59"}, "ac": {"11"}, "attack": {"1"}, "damage": {"1"},
+		"atk_name": {"Greatclub", "Javelin", ""}, "atk_to_hit": {"6", "6", ""}, "atk_damage": {"2d8+4", "2d6+4", ""},
+		"atk_type": {"bludgeoning", "piercing", ""}, "atk_reach": {"reach 5 ft.", "range 30/120 ft.", ""},
+		"atk_uses": {"2", "", ""},
+	}
+	rec := serveAs(t, token, "PUT", path, strings.NewReader(form.Encode()))
+	if body := rec.Body.String(); !contains(body, "Greatclub") || !contains(body, "2× Greatclub") || !contains(body, "Roll multiattack") {
+		t.Errorf("Expected the row to list the attacks and multiattack, got %s", body)
+	}
+	m, _ := getMinion(defaultCampaignID, id)
+	if len(m.Attacks) != 2 || m.Attack != 6 || m.Damage != "2d8+4" {
+		t.Errorf("Expected two attacks with the first as the main one, got %+v", m)
+	}
+
+	fixedRolls(t, 10, 1, 1, 10, 1, 1)
+	rec = serveAs(t, token, "POST", path+"/attacks/roll", strings.NewReader("target_ac=15"))
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), "12 damage") {
+		t.Errorf("Expected two 6 damage hits, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveAs(t, token, "POST", path+"/attacks/roll", strings.NewReader("target_ac=-1")); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad AC, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	sessionCookie = "session"
+	sessionTTL    = 30 * 24 * time.Hour
+)
+
+// bcryptCost is a variable so tests can trade strength for speed.
+var bcryptCost = bcrypt.DefaultCost
+
+var errBadCredentials = errors.New("invalid username or password")
+
+type ctxKey int
+
+const (
+	userKey ctxKey = iota
+	csrfKey
+	campaignKey
+)
+
+// currentUser returns the signed-in user for r, or nil.
+func currentUser(r *http.Request) *User {
+	u, _ := r.Context().Value(userKey).(*User)
+	return u
+}
+
+func withUser(r *http.Request, u *User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey, u))
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func countUsers() (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&n)
+	return n, err
+}
+
+func createUser(username, password, role string) (*User, error) {
+	if role != roleGM && role != rolePlayer {
+		return nil, errors.New("unknown role " + strconv.Quote(role))
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return nil, err
+	}
+	res, err := db.Exec(`INSERT INTO users (username, password_hash, role) VALUES (?, ?, ?)`,
+		username, string(hash), role)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	return &User{ID: id, Username: username, Role: role}, nil
+}
+
+func listUsers() ([]User, error) {
+	rows, err := db.Query(`SELECT id, username, role FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func authenticate(username, password string) (*User, error) {
+	u := &User{}
+	var hash string
+	err := db.QueryRow(`SELECT id, username, role, password_hash FROM users WHERE username = ?`, username).
+		Scan(&u.ID, &u.Username, &u.Role, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errBadCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil, errBadCredentials
+	}
+	return u, nil
+}
+
+func createSession(userID int64) (string, error) {
+	token := randomToken()
+	_, err := db.Exec(`INSERT INTO sessions (token, user_id, expires_at, csrf_token) VALUES (?, ?, ?, ?)`,
+		token, userID, time.Now().Add(sessionTTL).Unix(), randomToken())
+	return token, err
+}
+
+// lookupSession returns the unexpired session for token along with the
+// CSRF token bound to it.
+func lookupSession(token string) (*User, string, error) {
+	u := &User{}
+	var csrf string
+	err := db.QueryRow(
+		`SELECT u.id, u.username, u.role, s.csrf_token FROM sessions s JOIN users u ON u.id = s.user_id
+		 WHERE s.token = ? AND s.expires_at > ?`, token, time.Now().Unix()).
+		Scan(&u.ID, &u.Username, &u.Role, &csrf)
+	return u, csrf, err
+}
+
+func deleteSession(token string) error {
+	_, err := db.Exec(`DELETE FROM sessions WHERE token = ?`, token)
+	return err
+}
+
+// loadSession attaches the user behind the session cookie, if any, and
+// their CSRF token to the request context. It never rejects a request on
+// its own.
+func loadSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			if u, csrf, err := lookupSession(c.Value); err == nil {
+				r = withUser(r, u)
+				r = r.WithContext(context.WithValue(r.Context(), csrfKey, csrf))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// unauthorized sends anonymous visitors to the login page. htmx requests
+// get an HX-Redirect so the whole page navigates rather than a fragment.
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("HX-Request") != "" {
+		w.Header().Set("HX-Redirect", "/login")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method == http.MethodGet {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		return
+	}
+	http.Error(w, "login required", http.StatusUnauthorized)
+}
+
+// requireUser allows any signed-in user.
+func requireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if currentUser(r) == nil {
+			unauthorized(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireGM allows only users with the global GM role, who may create
+// campaigns and accounts. Inside a campaign, requireCampaignGM applies.
+func requireGM(next http.HandlerFunc) http.HandlerFunc {
+	return requireUser(func(w http.ResponseWriter, r *http.Request) {
+		if !currentUser(r).IsGM() {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// IsAdmin reports whether u may take and restore snapshots. A snapshot
+// holds every campaign, so only a GM who runs all of them may.
+func (u *User) IsAdmin() bool {
+	if !u.IsGM() {
+		return false
+	}
+	var others int
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM campaigns c WHERE NOT EXISTS (SELECT 1 FROM campaign_members m
+		 WHERE m.campaign_id = c.id AND m.user_id = ? AND m.role = ?)`, u.ID, roleGM).Scan(&others)
+	return err == nil && others == 0
+}
+
+// requireAdmin allows only admins; see IsAdmin.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return requireUser(func(w http.ResponseWriter, r *http.Request) {
+		if !currentUser(r).IsAdmin() {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// safeNext returns the local path to continue to after login, refusing
+// anything that could send the browser to another site.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func renderLogin(w http.ResponseWriter, r *http.Request, status int, errMsg string) {
+	n, err := countUsers()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.WriteHeader(status)
+	tmpl.ExecuteTemplate(w, "login.html", map[string]any{
+		"Setup":     n == 0,
+		"Error":     errMsg,
+		"Next":      safeNext(r.FormValue("next")),
+		"CSRFToken": csrfToken(r),
+	})
+}
+
+func handleLoginForm(w http.ResponseWriter, r *http.Request) {
+	renderLogin(w, r, http.StatusOK, "")
+}
+
+// handleLogin signs a user in. On a fresh database with no accounts the
+// same form creates the first GM instead.
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	username := strings.TrimSpace(r.FormValue("username"))
+	password := r.FormValue("password")
+
+	n, err := countUsers()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	var u *User
+	if n == 0 {
+		if username == "" || len(password) < 8 {
+			renderLogin(w, r, http.StatusUnprocessableEntity, "Choose a username and a password of at least 8 characters.")
+			return
+		}
+		u, err = createUser(username, password, roleGM)
+		if err == nil {
+			err = addMember(defaultCampaignID, u.ID, roleGM)
+		}
+	} else {
+		u, err = authenticate(username, password)
+	}
+	if errors.Is(err, errBadCredentials) {
+		renderLogin(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	token, err := createSession(u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	setSessionCookie(w, r, token, int(sessionTTL.Seconds()))
+	http.Redirect(w, r, safeNext(r.FormValue("next")), http.StatusSeeOther)
+}
+
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		deleteSession(c.Value)
+	}
+	setSessionCookie(w, r, "", -1)
+	if r.Header.Get("HX-Request") != "" {
+		w.Header().Set("HX-Redirect", "/login")
+		return
+	}
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func handleUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := listUsers()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "users.html", map[string]any{
+		"User":      currentUser(r),
+		"Users":     users,
+		"CSRFToken": csrfToken(r),
+	})
+}
+
+func handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	username := strings.TrimSpace(r.FormValue("username"))
+	password := r.FormValue("password")
+	if username == "" || len(password) < 8 {
+		http.Error(w, "username and a password of at least 8 characters are required", http.StatusUnprocessableEntity)
+		return
+	}
+	u, err := createUser(username, password, r.FormValue("role"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "user-row", u)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCreateUserHashesPassword(t *testing.T) {
+	testDB := useTestDB(t)
+
+	u, _ := createTestUser(t, "gm", roleGM)
+
+	var hash string
+	if err := testDB.QueryRow("SELECT password_hash FROM users WHERE id = ?", u.ID).Scan(&hash); err != nil {
+		t.Fatalf("Query error: %v", err)
+	}
+	if hash == "" || contains(hash, "correct horse battery") {
+		t.Errorf("Expected a bcrypt hash, got %q", hash)
+	}
+
+	if _, err := authenticate("gm", "correct horse battery"); err != nil {
+		t.Errorf("Expected valid credentials to authenticate, got: %v", err)
+	}
+	if _, err := authenticate("gm", "wrong"); err != errBadCredentials {
+		t.Errorf("Expected errBadCredentials for wrong password, got: %v", err)
+	}
+	if _, err := authenticate("nobody", "correct horse battery"); err != errBadCredentials {
+		t.Errorf("Expected errBadCredentials for unknown user, got: %v", err)
+	}
+}
+
+func TestCreateUserRejectsUnknownRole(t *testing.T) {
+	useTestDB(t)
+
+	if _, err := createUser("x", "password123", "admin"); err == nil {
+		t.Error("Expected error for unknown role")
+	}
+}
+
+func TestFirstLoginCreatesGM(t *testing.T) {
+	useTestDB(t)
+
+	rec := serveAs(t, "", "GET", "/login", nil)
+	if !contains(rec.Body.String(), "Create GM account") {
+		t.Error("Expected setup form on an empty database")
+	}
+
+	form := url.Values{"username": {"dm"}, "password": {"hunter2hunter2"}}
+	rec = serveAs(t, "", "POST", "/login", strings.NewReader(form.Encode()))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected redirect after setup, got %d", rec.Code)
+	}
+
+	u, err := authenticate("dm", "hunter2hunter2")
+	if err != nil {
+		t.Fatalf("Expected setup account to exist: %v", err)
+	}
+	if !u.IsGM() {
+		t.Errorf("Expected first account to be a GM, got role %q", u.Role)
+	}
+
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly {
+		t.Fatal("Expected an HttpOnly session cookie")
+	}
+
+	rec = serveAs(t, cookie.Value, "GET", "/", nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected signed-in index to load, got %d", rec.Code)
+	}
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	useTestDB(t)
+	createTestUser(t, "gm", roleGM)
+
+	form := url.Values{"username": {"gm"}, "password": {"nope"}}
+	rec := serveAs(t, "", "POST", "/login", strings.NewReader(form.Encode()))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", rec.Code)
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookie && c.Value != "" {
+			t.Error("Expected no session cookie on failed login")
+		}
+	}
+}
+
+func TestLogout(t *testing.T) {
+	useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+
+	serveAs(t, token, "POST", "/logout", nil)
+
+	if _, _, err := lookupSession(token); err == nil {
+		t.Error("Expected session to be deleted on logout")
+	}
+	rec := serveAs(t, token, "GET", "/", nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("Expected redirect to login after logout, got %d", rec.Code)
+	}
+}
+
+func TestAnonymousRequestsRejected(t *testing.T) {
+	testDB := useTestDB(t)
+	createTestMinion(t, testDB, &Minion{Name: "Goblin", HP: 7, MaxHP: 7, AC: 13, Attack: 4})
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/", http.StatusSeeOther},
+		{"POST", "/c/default/minions", http.StatusUnauthorized},
+		{"PUT", "/c/default/minions/1", http.StatusUnauthorized},
+		{"DELETE", "/c/default/minions/1", http.StatusUnauthorized},
+		{"POST", "/c/default/minions/1/hp/dmg", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		rec := serveAs(t, "", tt.method, tt.path, strings.NewReader("amount=5"))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.want, rec.Code)
+		}
+	}
+
+	m, _ := getMinion(defaultCampaignID, 1)
+	if !m.Active || m.HP != 7 {
+		t.Errorf("Expected minion untouched, got active=%v hp=%d", m.Active, m.HP)
+	}
+}
+
+func TestHTMXAnonymousGetsRedirectHeader(t *testing.T) {
+	useTestDB(t)
+
+	req := httptest.NewRequest("DELETE", "/c/default/minions/1", nil)
+	req.Header.Set("HX-Request", "true")
+	rec := httptest.NewRecorder()
+	routes().ServeHTTP(rec, req)
+
+	if rec.Header().Get("HX-Redirect") != "/login" {
+		t.Errorf("Expected HX-Redirect to /login, got %q", rec.Header().Get("HX-Redirect"))
+	}
+}
+
+func TestPlayerPermissions(t *testing.T) {
+	testDB := useTestDB(t)
+	player, token := createTestUser(t, "pc", rolePlayer)
+
+	gmMinion := createTestMinion(t, testDB, &Minion{Name: "Ogre", HP: 59, MaxHP: 59, AC: 11, Attack: 6})
+	ownMinion := createTestMinion(t, testDB, &Minion{Name: "Familiar", HP: 1, MaxHP: 1, AC: 13, Attack: 0, OwnerID: player.ID})
+
+	// Players can read everything
+	if rec := serveAs(t, token, "GET", "/", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected player to read index, got %d", rec.Code)
+	}
+
+	// ...but not touch the GM's minions
+	rec := serveAs(t, token, "DELETE", "/c/default/minions/"+itoa64(gmMinion), nil)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 dismissing GM minion, got %d", rec.Code)
+	}
+	rec = serveAs(t, token, "POST", "/c/default/minions/"+itoa64(gmMinion)+"/hp/dmg", strings.NewReader("amount=5"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 damaging GM minion, got %d", rec.Code)
+	}
+	if m, _ := getMinion(defaultCampaignID, gmMinion); m.HP != 59 || !m.Active {
+		t.Errorf("Expected GM minion untouched, got hp=%d active=%v", m.HP, m.Active)
+	}
+
+	// Their own summons are fair game
+	rec = serveAs(t, token, "DELETE", "/c/default/minions/"+itoa64(ownMinion), nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected player to dismiss own minion, got %d", rec.Code)
+	}
+
+	// And new summons are recorded as theirs
+	form := url.Values{"name": {"Spirit"}, "hp": {"5"}, "ac": {"12"}, "attack": {"3"}}
+	rec = serveAs(t, token, "POST", "/c/default/minions", strings.NewReader(form.Encode()))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected player to summon, got %d", rec.Code)
+	}
+	var owner int64
+	testDB.QueryRow("SELECT owner_id FROM minions WHERE name = 'Spirit'").Scan(&owner)
+	if owner != player.ID {
+		t.Errorf("Expected summon owned by %d, got %d", player.ID, owner)
+	}
+}
+
+func TestGMCanManageEverything(t *testing.T) {
+	testDB := useTestDB(t)
+	player, _ := createTestUser(t, "pc", rolePlayer)
+	_, token := createTestUser(t, "gm", roleGM)
+
+	id := createTestMinion(t, testDB, &Minion{Name: "Familiar", HP: 1, MaxHP: 1, AC: 13, OwnerID: player.ID})
+
+	rec := serveAs(t, token, "POST", "/c/default/minions/"+itoa64(id)+"/hp/dmg", strings.NewReader("amount=1"))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected GM to damage player minion, got %d", rec.Code)
+	}
+	if rec := serveAs(t, token, "GET", "/users", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected GM to see users page, got %d", rec.Code)
+	}
+}
+
+func TestUserManagementIsGMOnly(t *testing.T) {
+	useTestDB(t)
+	_, playerToken := createTestUser(t, "pc", rolePlayer)
+	_, gmToken := createTestUser(t, "gm", roleGM)
+
+	form := url.Values{"username": {"new"}, "password": {"longenough"}, "role": {"gm"}}
+	rec := serveAs(t, playerToken, "POST", "/users", strings.NewReader(form.Encode()))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for player creating users, got %d", rec.Code)
+	}
+
+	form.Set("role", "player")
+	rec = serveAs(t, gmToken, "POST", "/users", strings.NewReader(form.Encode()))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected GM to create user, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !contains(rec.Body.String(), "new") {
+		t.Error("Expected new user row in response")
+	}
+	if _, err := authenticate("new", "longenough"); err != nil {
+		t.Errorf("Expected new user to log in: %v", err)
+	}
+}
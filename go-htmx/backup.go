@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// Snapshot kinds, recorded in the file name. Retention only ever removes
+// automatic snapshots; manual and pre-restore ones stay until deleted by
+// hand.
+const (
+	snapshotAuto       = "auto"
+	snapshotManual     = "manual"
+	snapshotPreRestore = "pre-restore"
+)
+
+const snapshotTimeFormat = "20060102-150405"
+
+// backupConfig says where snapshots go and how many automatic ones to keep.
+// serve fills it in from its flags.
+type backupConfig struct {
+	Dir   string
+	Every time.Duration
+	Keep  int
+}
+
+var backups = backupConfig{Dir: "backups", Every: time.Hour, Keep: 24}
+
+// snapshotMu serialises snapshots and restores so a restore never races a
+// scheduled backup.
+var snapshotMu sync.Mutex
+
+// snapshotInfo describes one snapshot file.
+type snapshotInfo struct {
+	Name    string
+	Kind    string
+	Created time.Time
+	Size    int64
+
+	seq int // orders snapshots taken within the same second
+}
+
+// KiB is the snapshot's size rounded up to whole kibibytes.
+func (s snapshotInfo) KiB() int64 {
+	return (s.Size + 1023) / 1024
+}
+
+// parseSnapshotName reads "minions-<time>-<kind>[-n].db", reporting false
+// for files that are not snapshots.
+func parseSnapshotName(name string) (snapshotInfo, bool) {
+	rest, ok := strings.CutPrefix(name, "minions-")
+	if !ok || !strings.HasSuffix(rest, ".db") || len(rest) < len(snapshotTimeFormat)+4 {
+		return snapshotInfo{}, false
+	}
+	created, err := time.Parse(snapshotTimeFormat, rest[:len(snapshotTimeFormat)])
+	if err != nil {
+		return snapshotInfo{}, false
+	}
+	kind := strings.TrimSuffix(rest[len(snapshotTimeFormat):], ".db")
+	kind, ok = strings.CutPrefix(kind, "-")
+	if !ok {
+		return snapshotInfo{}, false
+	}
+	seq := 1
+	if i := strings.LastIndexByte(kind, '-'); i > 0 {
+		if n, err := strconv.Atoi(kind[i+1:]); err == nil {
+			kind, seq = kind[:i], n
+		}
+	}
+	switch kind {
+	case snapshotAuto, snapshotManual, snapshotPreRestore:
+	default:
+		return snapshotInfo{}, false
+	}
+	return snapshotInfo{Name: name, Kind: kind, Created: created, seq: seq}, true
+}
+
+// takeSnapshot writes a consistent copy of the live database into dir with
+// VACUUM INTO, which runs online alongside normal traffic.
+func takeSnapshot(dir, kind string) (*snapshotInfo, error) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	return takeSnapshotLocked(dir, kind)
+}
+
+func takeSnapshotLocked(dir, kind string) (*snapshotInfo, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	base := "minions-" + now.Format(snapshotTimeFormat) + "-" + kind
+	name := base + ".db"
+	for n := 2; ; n++ {
+		if _, err := os.Stat(filepath.Join(dir, name)); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		name = fmt.Sprintf("%s-%d.db", base, n)
+	}
+
+	path := filepath.Join(dir, name)
+	if _, err := db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshotInfo{Name: name, Kind: kind, Created: now.Truncate(time.Second), Size: st.Size()}, nil
+}
+
+// listSnapshots returns the snapshots in dir, newest first. A missing
+// directory just means there are none yet.
+func listSnapshots(dir string) ([]snapshotInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snaps []snapshotInfo
+	for _, e := range entries {
+		s, ok := parseSnapshotName(e.Name())
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		if fi, err := e.Info(); err == nil {
+			s.Size = fi.Size()
+		}
+		snaps = append(snaps, s)
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		if !snaps[i].Created.Equal(snaps[j].Created) {
+			return snaps[i].Created.After(snaps[j].Created)
+		}
+		return snaps[i].seq > snaps[j].seq
+	})
+	return snaps, nil
+}
+
+// pruneSnapshots deletes automatic snapshots beyond the newest keep.
+func pruneSnapshots(dir string, keep int) error {
+	snaps, err := listSnapshots(dir)
+	if err != nil {
+		return err
+	}
+	kept := 0
+	for _, s := range snaps {
+		if s.Kind != snapshotAuto {
+			continue
+		}
+		if kept++; kept > keep {
+			if err := os.Remove(filepath.Join(dir, s.Name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findSnapshot resolves a name from a URL to a snapshot in dir. Only names
+// that listSnapshots reports are accepted, so a crafted name cannot reach
+// outside the directory.
+func findSnapshot(dir, name string) (*snapshotInfo, error) {
+	snaps, err := listSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range snaps {
+		if s.Name == name {
+			return &s, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// checkSnapshot opens a snapshot read-only and makes sure it is an intact
+// tracker database this build can migrate forward.
+func checkSnapshot(path string) error {
+	d, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	var result string
+	if err := d.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("snapshot is damaged: %s", result)
+	}
+	version, err := schemaVersion(d)
+	if err != nil {
+		return err
+	}
+	if version == 0 || version > len(migrations) {
+		return fmt.Errorf("snapshot has schema version %d; this tracker understands 1 to %d", version, len(migrations))
+	}
+	return nil
+}
+
+// restoreSnapshot replaces the live database with a snapshot while the
+// server keeps running. The current state is saved as a pre-restore
+// snapshot first, then SQLite's backup API copies the snapshot's pages
+// into the open database under a write lock, so every pooled connection
+// sees the restored data on its next query. Older snapshots are migrated
+// forward afterwards.
+func restoreSnapshot(dir, name string) (*snapshotInfo, error) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+
+	snap, err := findSnapshot(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, snap.Name)
+	if err := checkSnapshot(path); err != nil {
+		return nil, err
+	}
+
+	saved, err := takeSnapshotLocked(dir, snapshotPreRestore)
+	if err != nil {
+		return nil, fmt.Errorf("saving current state: %w", err)
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	err = conn.Raw(func(driverConn any) error {
+		restorer, ok := driverConn.(interface {
+			NewRestore(string) (*sqlite.Backup, error)
+		})
+		if !ok {
+			return errors.New("database driver cannot restore backups")
+		}
+		bk, err := restorer.NewRestore(path)
+		if err != nil {
+			return err
+		}
+		if _, err := bk.Step(-1); err != nil {
+			bk.Finish()
+			return err
+		}
+		return bk.Finish()
+	})
+	conn.Close()
+	if err != nil {
+		return nil, fmt.Errorf("restore failed, current state kept in %s: %w", saved.Name, err)
+	}
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// startBackups snapshots the database every cfg.Every and prunes old
+// automatic snapshots. A zero interval disables it.
+func startBackups(cfg backupConfig) {
+	if cfg.Every <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(cfg.Every) {
+			if _, err := takeSnapshot(cfg.Dir, snapshotAuto); err != nil {
+				log.Println("backup:", err)
+				continue
+			}
+			if err := pruneSnapshots(cfg.Dir, cfg.Keep); err != nil {
+				log.Println("backup:", err)
+			}
+		}
+	}()
+}
+
+func handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	snaps, err := listSnapshots(backups.Dir)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "snapshots.html", map[string]any{
+		"User":      currentUser(r),
+		"Snapshots": snaps,
+		"Backups":   backups,
+		"CSRFToken": csrfToken(r),
+		"Restored":  r.URL.Query().Get("restored"),
+		"Saved":     r.URL.Query().Get("saved"),
+	})
+}
+
+func handleCreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	snap, err := takeSnapshot(backups.Dir, snapshotManual)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if r.Header.Get("HX-Request") == "" {
+		http.Redirect(w, r, "/admin/snapshots", http.StatusSeeOther)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "snapshot-row", snap)
+}
+
+func handleRestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	saved, err := restoreSnapshot(backups.Dir, name)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	// The restored sessions table may no longer hold the caller's session,
+	// in which case the redirect lands on the login page.
+	target := "/admin/snapshots?restored=" + name + "&saved=" + saved.Name
+	if r.Header.Get("HX-Request") != "" {
+		w.Header().Set("HX-Redirect", target)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useBackupDir points the snapshot config at a fresh directory
+func useBackupDir(t *testing.T) string {
+	t.Helper()
+
+	original := backups
+	backups = backupConfig{Dir: t.TempDir(), Keep: 2}
+	t.Cleanup(func() { backups = original })
+	return backups.Dir
+}
+
+func TestParseSnapshotName(t *testing.T) {
+	for name, want := range map[string]string{
+		"minions-20261018-120000-auto.db":          snapshotAuto,
+		"minions-20261018-120000-manual-3.db":      snapshotManual,
+		"minions-20261018-120000-pre-restore.db":   snapshotPreRestore,
+		"minions-20261018-120000-pre-restore-2.db": snapshotPreRestore,
+		"minions-20261018-120000-other.db":         "",
+		"minions-2026-auto.db":                     "",
+		"minions.db":                               "",
+		"notes.txt":                                "",
+	} {
+		s, ok := parseSnapshotName(name)
+		if ok != (want != "") || s.Kind != want {
+			t.Errorf("%s: expected kind %q, got %q (%v)", name, want, s.Kind, ok)
+		}
+	}
+
+	s, _ := parseSnapshotName("minions-20261018-120304-auto.db")
+	if !s.Created.Equal(time.Date(2026, 10, 18, 12, 3, 4, 0, time.UTC)) {
+		t.Errorf("Unexpected time %v", s.Created)
+	}
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	testDB := useTestDB(t)
+	dir := useBackupDir(t)
+	createTestMinion(t, testDB, &Minion{Name: "Goblin", HP: 7, MaxHP: 7})
+
+	first, err := takeSnapshot(dir, snapshotManual)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	second, err := takeSnapshot(dir, snapshotManual)
+	if err != nil || second.Name == first.Name {
+		t.Fatalf("Expected a second, distinct snapshot, got %+v (%v)", second, err)
+	}
+
+	if err := checkSnapshot(filepath.Join(dir, first.Name)); err != nil {
+		t.Errorf("Snapshot failed its check: %v", err)
+	}
+	snaps, _ := listSnapshots(dir)
+	if len(snaps) != 2 || snaps[0].Name != second.Name || snaps[0].Size == 0 {
+		t.Errorf("Expected both snapshots newest first, got %+v", snaps)
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"minions-20261018-100000-auto.db",
+		"minions-20261018-110000-auto.db",
+		"minions-20261018-120000-auto.db",
+		"minions-20261018-090000-manual.db",
+		"minions-20261018-080000-pre-restore.db",
+		"unrelated.db",
+	} {
+		os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644)
+	}
+
+	if err := pruneSnapshots(dir, 2); err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	if len(left) != 5 || contains(left[0]+left[1], "100000-auto") {
+		t.Errorf("Expected only the oldest automatic snapshot removed, got %v", left)
+	}
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	testDB := useTestDB(t)
+	dir := useBackupDir(t)
+	goblin := createTestMinion(t, testDB, &Minion{Name: "Goblin", HP: 7, MaxHP: 7})
+
+	snap, err := takeSnapshot(dir, snapshotManual)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	// A bad edit after the snapshot
+	updateMinion(defaultCampaignID, &Minion{ID: goblin, Name: "", HP: 0, MaxHP: 0})
+	createTestMinion(t, testDB, &Minion{Name: "Orc", HP: 15, MaxHP: 15})
+
+	saved, err := restoreSnapshot(dir, snap.Name)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	all, _ := listAllMinions(defaultCampaignID)
+	if len(all) != 1 || all[0].Name != "Goblin" || all[0].HP != 7 {
+		t.Errorf("Expected the snapshot's single goblin, got %+v", all)
+	}
+	if saved.Kind != snapshotPreRestore {
+		t.Errorf("Expected a pre-restore snapshot, got %+v", saved)
+	}
+
+	// Restoring the pre-restore snapshot brings the orc back
+	if _, err := restoreSnapshot(dir, saved.Name); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if all, _ := listAllMinions(defaultCampaignID); len(all) != 2 {
+		t.Errorf("Expected undo to restore both minions, got %d", len(all))
+	}
+
+	if _, err := restoreSnapshot(dir, "../minions.db"); !os.IsNotExist(err) {
+		t.Errorf("Expected unknown snapshot to be rejected, got %v", err)
+	}
+	bogus := "minions-20261018-120000-manual-9.db"
+	os.WriteFile(filepath.Join(dir, bogus), []byte("not a database"), 0o644)
+	if _, err := restoreSnapshot(dir, bogus); err == nil {
+		t.Error("Expected a corrupt snapshot to be refused")
+	}
+}
+
+func TestSnapshotHandlers(t *testing.T) {
+	useTestDB(t)
+	useBackupDir(t)
+	_, gm := createTestUser(t, "gm", roleGM)
+	_, player := createTestUser(t, "pc", rolePlayer)
+
+	if rec := serveAs(t, player, "POST", "/admin/snapshot", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for player, got %d", rec.Code)
+	}
+
+	// A GM who runs only some campaigns may not roll back the others
+	other, _ := createUser("gm2", "correct horse battery", roleGM)
+	otherToken, _ := createSession(other.ID)
+	elsewhere, _ := createCampaign("Elsewhere", other.ID)
+	for _, path := range []string{"/admin/snapshot", "/admin/snapshots/x.db/restore"} {
+		if rec := serveAs(t, otherToken, "POST", path, nil); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 for %s by a GM of some campaigns, got %d", path, rec.Code)
+		}
+		if rec := serveAs(t, gm, "POST", path, nil); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 for %s before joining every campaign, got %d", path, rec.Code)
+		}
+	}
+	if rec := serveAs(t, gm, "GET", "/c/default/", nil); contains(rec.Body.String(), "/admin/snapshots") {
+		t.Error("Expected no backups link for a GM who is not an admin")
+	}
+	u, _, _ := lookupSession(gm)
+	addMember(elsewhere.ID, u.ID, roleGM)
+
+	rec := serveAs(t, gm, "POST", "/admin/snapshot", nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected redirect after snapshot, got %d: %s", rec.Code, rec.Body.String())
+	}
+	snaps, _ := listSnapshots(backups.Dir)
+	if len(snaps) != 1 || snaps[0].Kind != snapshotManual {
+		t.Fatalf("Expected one manual snapshot, got %+v", snaps)
+	}
+
+	rec = serveAs(t, gm, "GET", "/admin/snapshots", nil)
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), snaps[0].Name) {
+		t.Errorf("Expected listing to show %s, got %d", snaps[0].Name, rec.Code)
+	}
+
+	rec = serveAs(t, gm, "POST", "/admin/snapshots/"+snaps[0].Name+"/restore", nil)
+	if rec.Code != http.StatusSeeOther || !contains(rec.Header().Get("Location"), "restored="+snaps[0].Name) {
+		t.Errorf("Expected redirect after restore, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := serveAs(t, gm, "POST", "/admin/snapshots/nope.db/restore", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown snapshot, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxSpawn bounds how many copies one spawn request may create.
+const maxSpawn = 50
+
+func listBestiary(campaignID int64) ([]Minion, error) {
+	rows, err := db.Query(minionSelect+` WHERE m.campaign_id = ? AND m.bestiary = 1 ORDER BY m.name`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var minions []Minion
+	for rows.Next() {
+		var m Minion
+		if err := scanMinion(rows, &m); err != nil {
+			return nil, err
+		}
+		minions = append(minions, m)
+	}
+	return minions, rows.Err()
+}
+
+// spawnFromBestiary puts count fresh copies of a bestiary entry into play.
+// Copies after the first are numbered so they can be told apart.
+func spawnFromBestiary(campaignID, id int64, count int, ownerID int64) ([]*Minion, error) {
+	entry, err := getMinion(campaignID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.Bestiary {
+		return nil, sql.ErrNoRows
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	spawned := make([]*Minion, 0, count)
+	for i := 1; i <= count; i++ {
+		m := *entry
+		m.HP = m.MaxHP
+		m.Active = true
+		m.Bestiary = false
+		m.OwnerID = ownerID
+		if count > 1 {
+			m.Name = fmt.Sprintf("%s %d", entry.Name, i)
+		}
+		if err := insertMinion(tx, campaignID, &m); err != nil {
+			return nil, err
+		}
+		spawned = append(spawned, &m)
+	}
+	return spawned, tx.Commit()
+}
+
+func deleteBestiaryEntry(campaignID, id int64) error {
+	return expectRow(db.Exec(`DELETE FROM minions WHERE campaign_id = ? AND id = ? AND bestiary = 1`, campaignID, id))
+}
+
+func handleBestiary(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	entries, err := listBestiary(c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "bestiary.html", map[string]any{
+		"Campaign":  c,
+		"Bestiary":  entries,
+		"User":      currentUser(r),
+		"CSRFToken": csrfToken(r),
+	})
+}
+
+// handleSRDImport accepts 5e SRD or Open5e monster JSON and files it in
+// the bestiary, or spawns it straight into play with target=active.
+func handleSRDImport(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	data, err := readUpload(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bestiary := r.FormValue("target") != "active"
+	minions, err := importSRD(c.ID, data, bestiary, currentUser(r).ID)
+	var verr validationError
+	if errors.As(err, &verr) {
+		http.Error(w, verr.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	names := make([]string, len(minions))
+	for i, m := range minions {
+		names[i] = m.Name
+	}
+	if r.Header.Get("HX-Request") != "" {
+		w.Header().Set("HX-Refresh", "true")
+	}
+	fmt.Fprintf(w, "Imported %d monster(s): %s", len(minions), strings.Join(names, ", "))
+}
+
+// handleSpawnFromBestiary creates copies of the bestiary entry named by the
+// id form value and returns their rows for appending to the list.
+func handleSpawnFromBestiary(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	id, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	count, _ := strconv.Atoi(r.FormValue("count"))
+	if count < 1 {
+		count = 1
+	}
+	if count > maxSpawn {
+		count = maxSpawn
+	}
+
+	var owner int64
+	if u := currentUser(r); u != nil {
+		owner = u.ID
+	}
+	if count > 1 && r.FormValue("mob") != "" {
+		m, err := spawnMob(campaignID(r), id, count, owner)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "not found", 404)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		tmpl.ExecuteTemplate(w, "minion-row", m)
+		return
+	}
+	spawned, err := spawnFromBestiary(campaignID(r), id, count, owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	for _, m := range spawned {
+		tmpl.ExecuteTemplate(w, "minion-row", m)
+	}
+}
+
+func handleDeleteBestiaryEntry(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	err := deleteBestiaryEntry(campaignID(r), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.WriteHeader(200)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSpawnFromBestiary(t *testing.T) {
+	useTestDB(t)
+
+	entry := &Minion{Name: "Skeleton", HP: 13, MaxHP: 13, AC: 13, Attack: 4, Damage: "1d6+2", Bestiary: true}
+	if err := createMinion(defaultCampaignID, entry); err != nil {
+		t.Fatalf("Failed to create entry: %v", err)
+	}
+	if entry.Active {
+		t.Error("Expected bestiary entry to be inactive")
+	}
+
+	spawned, err := spawnFromBestiary(defaultCampaignID, entry.ID, 3, 0)
+	if err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	if len(spawned) != 3 || spawned[2].Name != "Skeleton 3" {
+		t.Errorf("Expected three numbered skeletons, got %+v", spawned)
+	}
+
+	active, _ := listActiveMinions(defaultCampaignID)
+	if len(active) != 3 {
+		t.Errorf("Expected 3 in play, got %d", len(active))
+	}
+	for _, m := range active {
+		if m.Bestiary || m.HP != 13 || m.Damage != "1d6+2" {
+			t.Errorf("Unexpected spawned minion %+v", m)
+		}
+	}
+
+	// Damage to a copy never reaches the template
+	adjustHP(defaultCampaignID, active[0].ID, -5)
+	if e, _ := getMinion(defaultCampaignID, entry.ID); e.HP != 13 {
+		t.Errorf("Expected template untouched, got HP %d", e.HP)
+	}
+
+	// Active minions are not templates
+	if _, err := spawnFromBestiary(defaultCampaignID, active[0].ID, 1, 0); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows spawning from a non-bestiary minion, got %v", err)
+	}
+}
+
+func TestDeleteBestiaryEntry(t *testing.T) {
+	testDB := useTestDB(t)
+
+	entry := &Minion{Name: "Wolf", HP: 11, MaxHP: 11, AC: 13, Bestiary: true}
+	createMinion(defaultCampaignID, entry)
+	live := createTestMinion(t, testDB, &Minion{Name: "Goblin", HP: 7, MaxHP: 7})
+
+	if err := deleteBestiaryEntry(defaultCampaignID, live); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected active minions to be out of reach, got %v", err)
+	}
+	if err := deleteBestiaryEntry(defaultCampaignID, entry.ID); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if entries, _ := listBestiary(defaultCampaignID); len(entries) != 0 {
+		t.Errorf("Expected empty bestiary, got %d", len(entries))
+	}
+}
+
+func TestHandleSRDImportAndSpawn(t *testing.T) {
+	useTestDB(t)
+	_, gm := createTestUser(t, "gm", roleGM)
+	player, playerToken := createTestUser(t, "pc", rolePlayer)
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("target", "bestiary")
+	fw, _ := mw.CreateFormFile("file", "owlbear.json")
+	fw.Write(readFixture(t, "srd", "open5e-owlbear.json"))
+	mw.Close()
+
+	_, csrf, _ := lookupSession(gm)
+	req := httptest.NewRequest("POST", "/c/default/bestiary/import", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set(csrfHeader, csrf)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: gm})
+	rec := httptest.NewRecorder()
+	routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), "Owlbear") {
+		t.Fatalf("Expected import to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serveAs(t, gm, "GET", "/c/default/bestiary", nil)
+	if !contains(rec.Body.String(), "Keen Sight and Smell") {
+		t.Error("Expected bestiary page to list the owlbear's traits")
+	}
+	rec = serveAs(t, gm, "GET", "/c/default/", nil)
+	if !contains(rec.Body.String(), "Spawn from Bestiary") {
+		t.Error("Expected spawn-from-bestiary form on the campaign page")
+	}
+
+	entries, _ := listBestiary(defaultCampaignID)
+	form := url.Values{"id": {itoa64(entries[0].ID)}, "count": {"2"}}
+	rec = serveAs(t, playerToken, "POST", "/c/default/bestiary/spawn", strings.NewReader(form.Encode()))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected player to summon from bestiary, got %d", rec.Code)
+	}
+	if strings.Count(rec.Body.String(), `class="minion-row"`) != 2 {
+		t.Error("Expected two minion rows in response")
+	}
+	active, _ := listActiveMinions(defaultCampaignID)
+	if len(active) != 2 || active[0].OwnerID != player.ID {
+		t.Errorf("Expected two owlbears owned by the player, got %+v", active)
+	}
+
+	// Players may not curate the bestiary
+	rec = serveAs(t, playerToken, "DELETE", "/c/default/bestiary/"+itoa64(entries[0].ID), nil)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for player deleting bestiary entry, got %d", rec.Code)
+	}
+	rec = serveAs(t, playerToken, "POST", "/c/default/bestiary/import", strings.NewReader(`{}`))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for player import, got %d", rec.Code)
+	}
+}
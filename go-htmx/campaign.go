@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const inviteTTL = 7 * 24 * time.Hour
+
+// campaignFor returns the campaign resolved for r by requireMember, or nil
+// when none was resolved.
+func campaignFor(r *http.Request) *Campaign {
+	c, _ := r.Context().Value(campaignKey).(*Campaign)
+	return c
+}
+
+// campaignID is shorthand for handlers that only need the scope.
+func campaignID(r *http.Request) int64 {
+	if c := campaignFor(r); c != nil {
+		return c.ID
+	}
+	return 0
+}
+
+func getCampaign(id int64) (*Campaign, error) {
+	c := &Campaign{}
+	err := db.QueryRow(`SELECT id, slug, name FROM campaigns WHERE id = ?`, id).Scan(&c.ID, &c.Slug, &c.Name)
+	return c, err
+}
+
+func getCampaignBySlug(slug string) (*Campaign, error) {
+	c := &Campaign{}
+	err := db.QueryRow(`SELECT id, slug, name FROM campaigns WHERE slug = ?`, slug).Scan(&c.ID, &c.Slug, &c.Name)
+	return c, err
+}
+
+// memberCampaign looks up a campaign by slug as seen by userID. Campaigns
+// the user does not belong to are reported as sql.ErrNoRows.
+func memberCampaign(slug string, userID int64) (*Campaign, error) {
+	c := &Campaign{}
+	err := db.QueryRow(
+		`SELECT c.id, c.slug, c.name, m.role FROM campaigns c
+		 JOIN campaign_members m ON m.campaign_id = c.id
+		 WHERE c.slug = ? AND m.user_id = ?`, slug, userID).
+		Scan(&c.ID, &c.Slug, &c.Name, &c.Role)
+	return c, err
+}
+
+func listCampaigns(userID int64) ([]Campaign, error) {
+	rows, err := db.Query(
+		`SELECT c.id, c.slug, c.name, m.role FROM campaigns c
+		 JOIN campaign_members m ON m.campaign_id = c.id
+		 WHERE m.user_id = ? ORDER BY c.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []Campaign
+	for rows.Next() {
+		var c Campaign
+		if err := rows.Scan(&c.ID, &c.Slug, &c.Name, &c.Role); err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, c)
+	}
+	return campaigns, rows.Err()
+}
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+func slugify(name string) string {
+	return strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// createCampaign makes a new campaign run by ownerID. The slug is derived
+// from the name and suffixed until it is unique.
+func createCampaign(name string, ownerID int64) (*Campaign, error) {
+	base := slugify(name)
+	if base == "" {
+		base = "campaign"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	slug := base
+	for n := 2; ; n++ {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM campaigns WHERE slug = ?)`, slug).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			break
+		}
+		slug = base + "-" + strconv.Itoa(n)
+	}
+
+	res, err := tx.Exec(`INSERT INTO campaigns (slug, name) VALUES (?, ?)`, slug, name)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	if _, err := tx.Exec(`INSERT INTO campaign_members (campaign_id, user_id, role) VALUES (?, ?, ?)`,
+		id, ownerID, roleGM); err != nil {
+		return nil, err
+	}
+	return &Campaign{ID: id, Slug: slug, Name: name, Role: roleGM}, tx.Commit()
+}
+
+// addMember grants userID role in a campaign. An existing GM is never
+// demoted by joining again as a player.
+func addMember(campaignID, userID int64, role string) error {
+	_, err := db.Exec(
+		`INSERT INTO campaign_members (campaign_id, user_id, role) VALUES (?, ?, ?)
+		 ON CONFLICT (campaign_id, user_id) DO UPDATE SET role = CASE WHEN role = 'gm' THEN 'gm' ELSE excluded.role END`,
+		campaignID, userID, role)
+	return err
+}
+
+func createInvite(campaignID int64, role string) (string, error) {
+	if role != roleGM && role != rolePlayer {
+		return "", errors.New("unknown role " + strconv.Quote(role))
+	}
+	token := randomToken()
+	_, err := db.Exec(`INSERT INTO campaign_invites (token, campaign_id, role, expires_at) VALUES (?, ?, ?, ?)`,
+		token, campaignID, role, time.Now().Add(inviteTTL).Unix())
+	return token, err
+}
+
+// lookupInvite returns the campaign an unexpired invite is for, with Role
+// set to the role it grants.
+func lookupInvite(token string) (*Campaign, error) {
+	c := &Campaign{}
+	err := db.QueryRow(
+		`SELECT c.id, c.slug, c.name, i.role FROM campaign_invites i JOIN campaigns c ON c.id = i.campaign_id
+		 WHERE i.token = ? AND i.expires_at > ?`, token, time.Now().Unix()).
+		Scan(&c.ID, &c.Slug, &c.Name, &c.Role)
+	return c, err
+}
+
+// requireMember resolves {campaign} for a signed-in member and stores it
+// in the request context. Non-members get a 404 so campaign names do not
+// leak between tables.
+func requireMember(next http.HandlerFunc) http.HandlerFunc {
+	return requireUser(func(w http.ResponseWriter, r *http.Request) {
+		c, err := memberCampaign(r.PathValue("campaign"), currentUser(r).ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), campaignKey, c)))
+	})
+}
+
+// requireCampaignGM allows only the campaign's GMs.
+func requireCampaignGM(next http.HandlerFunc) http.HandlerFunc {
+	return requireMember(func(w http.ResponseWriter, r *http.Request) {
+		if !campaignFor(r).IsGM() {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// requireOwner allows the campaign's GMs, and players acting on a minion
+// they summoned. The minion is taken from the {id} path value.
+func requireOwner(next http.HandlerFunc) http.HandlerFunc {
+	return requireMember(func(w http.ResponseWriter, r *http.Request) {
+		c := campaignFor(r)
+		if !c.IsGM() {
+			id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+			m, err := getMinion(c.ID, id)
+			if err != nil {
+				http.Error(w, "not found", 404)
+				return
+			}
+			if m.OwnerID != currentUser(r).ID {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		next(w, r)
+	})
+}
+
+func handleCampaigns(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r)
+	campaigns, err := listCampaigns(u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "campaigns.html", map[string]any{
+		"User":      u,
+		"Campaigns": campaigns,
+		"CSRFToken": csrfToken(r),
+	})
+}
+
+func handleCreateCampaign(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		http.Error(w, "name is required", http.StatusUnprocessableEntity)
+		return
+	}
+	c, err := createCampaign(name, currentUser(r).ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	http.Redirect(w, r, "/c/"+c.Slug+"/", http.StatusSeeOther)
+}
+
+func handleCreateInvite(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	c := campaignFor(r)
+	token, err := createInvite(c.ID, r.FormValue("role"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	tmpl.ExecuteTemplate(w, "invite-link", map[string]any{
+		"URL":     scheme + "://" + r.Host + "/invite/" + token,
+		"Role":    r.FormValue("role"),
+		"Expires": time.Now().Add(inviteTTL).Format("2 Jan 2006"),
+	})
+}
+
+func handleInviteForm(w http.ResponseWriter, r *http.Request) {
+	c, err := lookupInvite(r.PathValue("token"))
+	if err != nil {
+		http.Error(w, "this invite link is invalid or has expired", http.StatusNotFound)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "invite.html", map[string]any{
+		"User":      currentUser(r),
+		"Invite":    c,
+		"Token":     r.PathValue("token"),
+		"CSRFToken": csrfToken(r),
+	})
+}
+
+func handleAcceptInvite(w http.ResponseWriter, r *http.Request) {
+	c, err := lookupInvite(r.PathValue("token"))
+	if err != nil {
+		http.Error(w, "this invite link is invalid or has expired", http.StatusNotFound)
+		return
+	}
+	if err := addMember(c.ID, currentUser(r).ID, c.Role); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	http.Redirect(w, r, "/c/"+c.Slug+"/", http.StatusSeeOther)
+}
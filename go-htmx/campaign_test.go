@@ -0,0 +1,233 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Curse of Strahd":      "curse-of-strahd",
+		"  Tuesday  Table #2 ": "tuesday-table-2",
+		"!!!":                  "",
+	}
+	for in, want := range tests {
+		if got := slugify(in); got != want {
+			t.Errorf("slugify(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCreateCampaignUniqueSlug(t *testing.T) {
+	useTestDB(t)
+	u, _ := createTestUser(t, "gm", roleGM)
+
+	a, err := createCampaign("Tomb of Annihilation", u.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	b, err := createCampaign("Tomb of Annihilation", u.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if a.Slug != "tomb-of-annihilation" || b.Slug != "tomb-of-annihilation-2" {
+		t.Errorf("Expected distinct slugs, got %q and %q", a.Slug, b.Slug)
+	}
+	if c, err := memberCampaign(b.Slug, u.ID); err != nil || !c.IsGM() {
+		t.Errorf("Expected creator to be GM of new campaign, got %+v, %v", c, err)
+	}
+}
+
+func TestStorageIsCampaignScoped(t *testing.T) {
+	testDB := useTestDB(t)
+	u, _ := createTestUser(t, "gm", roleGM)
+	other, _ := createCampaign("Other Table", u.ID)
+
+	id := createTestMinion(t, testDB, &Minion{Name: "Wolf", HP: 11, MaxHP: 11, AC: 13, Attack: 4, CampaignID: other.ID})
+
+	if _, err := getMinion(defaultCampaignID, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("getMinion: expected ErrNoRows across campaigns, got %v", err)
+	}
+	if err := updateMinion(defaultCampaignID, &Minion{ID: id, Name: "Hijacked", Active: true}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("updateMinion: expected ErrNoRows across campaigns, got %v", err)
+	}
+	if err := deleteMinion(defaultCampaignID, id, false); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleteMinion: expected ErrNoRows across campaigns, got %v", err)
+	}
+	if _, err := adjustHP(defaultCampaignID, id, -5); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("adjustHP: expected ErrNoRows across campaigns, got %v", err)
+	}
+	if minions, _ := listActiveMinions(defaultCampaignID); len(minions) != 0 {
+		t.Errorf("Expected default campaign to list nothing, got %d", len(minions))
+	}
+
+	m, err := getMinion(other.ID, id)
+	if err != nil {
+		t.Fatalf("Expected minion in its own campaign: %v", err)
+	}
+	if m.Name != "Wolf" || m.HP != 11 || !m.Active {
+		t.Errorf("Expected minion untouched, got %+v", m)
+	}
+	if m.Path() != "/c/other-table/minions/"+itoa64(id) {
+		t.Errorf("Unexpected path %q", m.Path())
+	}
+}
+
+func TestGMCannotTouchAnotherCampaign(t *testing.T) {
+	testDB := useTestDB(t)
+	owner, _ := createTestUser(t, "alice", roleGM)
+	_, intruder := createTestUser(t, "bob", roleGM)
+	theirs, _ := createCampaign("Alice Table", owner.ID)
+
+	id := createTestMinion(t, testDB, &Minion{Name: "Lich", HP: 135, MaxHP: 135, AC: 17, Attack: 12, CampaignID: theirs.ID})
+	path := "/c/alice-table/minions/" + itoa64(id)
+
+	tests := []struct{ method, path string }{
+		{"GET", "/c/alice-table/"},
+		{"POST", "/c/alice-table/minions"},
+		{"GET", path + "/view"},
+		{"PUT", path},
+		{"DELETE", path},
+		{"POST", path + "/hp/dmg"},
+		{"POST", "/c/alice-table/invites"},
+		// The id exists, but not in a campaign bob can reach through his own
+		{"DELETE", "/c/default/minions/" + itoa64(id)},
+		{"POST", "/c/default/minions/" + itoa64(id) + "/hp/dmg"},
+	}
+	for _, tt := range tests {
+		form := url.Values{"name": {"x"}, "hp": {"1"}, "max_hp": {"1"}, "amount": {"100"}, "role": {"gm"}}
+		rec := serveAs(t, intruder, tt.method, tt.path, strings.NewReader(form.Encode()))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404, got %d", tt.method, tt.path, rec.Code)
+		}
+	}
+
+	m, _ := getMinion(theirs.ID, id)
+	if m.HP != 135 || !m.Active || m.Name != "Lich" {
+		t.Errorf("Expected minion untouched, got %+v", m)
+	}
+}
+
+func TestCampaignsPageListsMemberships(t *testing.T) {
+	useTestDB(t)
+	u, token := createTestUser(t, "gm", roleGM)
+	createCampaign("Waterdeep", u.ID)
+	other, _ := createTestUser(t, "someone", roleGM)
+	createCampaign("Secret Table", other.ID)
+
+	rec := serveAs(t, token, "GET", "/", nil)
+	body := rec.Body.String()
+	if !contains(body, "Waterdeep") || !contains(body, "/c/default/") {
+		t.Error("Expected own campaigns to be listed")
+	}
+	if contains(body, "Secret Table") {
+		t.Error("Expected other GMs' campaigns to be hidden")
+	}
+}
+
+func TestCreateCampaignRoute(t *testing.T) {
+	useTestDB(t)
+	_, gm := createTestUser(t, "gm", roleGM)
+	_, player := createTestUser(t, "pc", rolePlayer)
+
+	form := url.Values{"name": {"Phandelver"}}
+	if rec := serveAs(t, player, "POST", "/campaigns", strings.NewReader(form.Encode())); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for player, got %d", rec.Code)
+	}
+	rec := serveAs(t, gm, "POST", "/campaigns", strings.NewReader(form.Encode()))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/c/phandelver/" {
+		t.Errorf("Expected redirect to new campaign, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestInviteFlow(t *testing.T) {
+	testDB := useTestDB(t)
+	owner, gm := createTestUser(t, "gm", roleGM)
+	camp, _ := createCampaign("Saltmarsh", owner.ID)
+
+	bcryptUser, _ := createUser("newbie", "correct horse battery", rolePlayer)
+	newbie, _ := createSession(bcryptUser.ID)
+
+	if rec := serveAs(t, newbie, "GET", "/c/saltmarsh/", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 before joining, got %d", rec.Code)
+	}
+
+	rec := serveAs(t, gm, "POST", "/c/saltmarsh/invites", strings.NewReader("role=player"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected invite to be created, got %d", rec.Code)
+	}
+	var token string
+	testDB.QueryRow("SELECT token FROM campaign_invites WHERE campaign_id = ?", camp.ID).Scan(&token)
+	if token == "" || !contains(rec.Body.String(), "/invite/"+token) {
+		t.Fatal("Expected invite link in response")
+	}
+
+	// Anonymous visitors are sent to log in and come back
+	rec = serveAs(t, "", "GET", "/invite/"+token, nil)
+	if loc := rec.Header().Get("Location"); loc != "/login?next="+url.QueryEscape("/invite/"+token) {
+		t.Errorf("Expected login redirect with next, got %q", loc)
+	}
+
+	rec = serveAs(t, newbie, "GET", "/invite/"+token, nil)
+	if !contains(rec.Body.String(), "Saltmarsh") {
+		t.Error("Expected invite page to name the campaign")
+	}
+	rec = serveAs(t, newbie, "POST", "/invite/"+token, nil)
+	if rec.Header().Get("Location") != "/c/saltmarsh/" {
+		t.Errorf("Expected redirect into campaign, got %q", rec.Header().Get("Location"))
+	}
+
+	c, err := memberCampaign("saltmarsh", bcryptUser.ID)
+	if err != nil || c.Role != rolePlayer {
+		t.Fatalf("Expected player membership, got %+v, %v", c, err)
+	}
+	if rec := serveAs(t, newbie, "GET", "/c/saltmarsh/", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected access after joining, got %d", rec.Code)
+	}
+	// Players cannot mint invites of their own
+	if rec := serveAs(t, newbie, "POST", "/c/saltmarsh/invites", strings.NewReader("role=gm")); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for player invites, got %d", rec.Code)
+	}
+}
+
+func TestInviteNeverDemotesGM(t *testing.T) {
+	useTestDB(t)
+	owner, _ := createTestUser(t, "gm", roleGM)
+	camp, _ := createCampaign("Icewind Dale", owner.ID)
+
+	if err := addMember(camp.ID, owner.ID, rolePlayer); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if c, _ := memberCampaign(camp.Slug, owner.ID); !c.IsGM() {
+		t.Error("Expected GM to remain GM after accepting a player invite")
+	}
+}
+
+func TestExpiredInvite(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "pc", rolePlayer)
+
+	testDB.Exec(`INSERT INTO campaign_invites (token, campaign_id, role, expires_at) VALUES ('old', 1, 'gm', 0)`)
+	if rec := serveAs(t, token, "POST", "/invite/old", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for expired invite, got %d", rec.Code)
+	}
+}
+
+func TestLoginNextIsLocalOnly(t *testing.T) {
+	tests := map[string]string{
+		"/invite/abc":          "/invite/abc",
+		"https://evil.example": "/",
+		"//evil.example":       "/",
+		"/\\evil.example":      "/",
+		"":                     "/",
+	}
+	for in, want := range tests {
+		if got := safeNext(in); got != want {
+			t.Errorf("safeNext(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const defaultDBPath = "minions.db"
+
+// errUsage marks a command line that could not be understood; the flag
+// package has already explained why.
+var errUsage = errors.New("usage")
+
+// cli carries what every subcommand shares: where to write, and the flags
+// common to the database commands.
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+
+	dbPath   string
+	campaign string
+	json     bool
+
+	opened *sql.DB // closed once the command returns
+}
+
+type command struct {
+	usage string
+	run   func(c *cli, args []string) error
+}
+
+var commands = map[string]command{
+	"serve":   {"serve [-addr :8080] [-db path] [-backup-dir dir] [-backup-every 1h] [-backup-keep 24] [-dismiss-dead 0]", (*cli).serve},
+	"list":    {"list [-all] [-bestiary]", (*cli).list},
+	"spawn":   {"spawn -name NAME -hp N [-ac N] [-attack N] [-damage DICE] [-notes TEXT] | spawn -from ID [-count N] [-mob]", (*cli).spawn},
+	"damage":  {"damage ID AMOUNT", (*cli).damage},
+	"heal":    {"heal ID AMOUNT", (*cli).heal},
+	"dismiss": {"dismiss [-defeated] ID...", (*cli).dismiss},
+	"export":  {"export [-o file]", (*cli).export},
+	"import":  {"import [-mode merge|replace] FILE|-", (*cli).importFile},
+	"migrate": {"migrate [-db path]", (*cli).migrate},
+	"tui":     {"tui [-campaign slug]", (*cli).tui},
+}
+
+var commandOrder = []string{"serve", "list", "spawn", "damage", "heal", "dismiss", "export", "import", "migrate", "tui"}
+
+// run executes one command line and returns the process exit code: 0 on
+// success, 1 when the command failed and 2 when it was misused. With no
+// arguments the tracker serves HTTP, as it always has.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+	name, args := args[0], args[1:]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		c.usage()
+		return 0
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", name)
+		c.usage()
+		return 2
+	}
+
+	err := cmd.run(c, args)
+	if c.opened != nil {
+		c.opened.Close()
+	}
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		fmt.Fprintf(stderr, "usage: minion-tracker %s\n", cmd.usage)
+		return 2
+	case err != nil:
+		fmt.Fprintf(stderr, "%s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+func (c *cli) usage() {
+	fmt.Fprintln(c.stderr, "usage: minion-tracker <command> [flags] [args]")
+	fmt.Fprintln(c.stderr, "\nCommands (run one with -h for its flags):")
+	for _, name := range commandOrder {
+		fmt.Fprintf(c.stderr, "  %s\n", commands[name].usage)
+	}
+}
+
+// flags starts a flag set for a subcommand. Every command gets -db;
+// database commands also get -campaign and -json.
+func (c *cli) flags(name string, database bool) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.StringVar(&c.dbPath, "db", defaultDBPath, "SQLite database file")
+	if database {
+		fs.StringVar(&c.campaign, "campaign", "default", "campaign slug")
+		fs.BoolVar(&c.json, "json", false, "print JSON instead of a table")
+	}
+	return fs
+}
+
+func (c *cli) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
+
+// open opens and migrates the database, exactly as the server does, and
+// resolves -campaign.
+func (c *cli) open() (*Campaign, error) {
+	d, err := openDB(c.dbPath)
+	if err != nil {
+		return nil, err
+	}
+	db, c.opened = d, d
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+	camp, err := getCampaignBySlug(c.campaign)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no campaign %q", c.campaign)
+	}
+	return camp, err
+}
+
+func (c *cli) serve(args []string) error {
+	fs := c.flags("serve", false)
+	addr := fs.String("addr", ":8080", "listen address")
+	fs.StringVar(&backups.Dir, "backup-dir", backups.Dir, "directory for database snapshots")
+	fs.DurationVar(&backups.Every, "backup-every", backups.Every, "interval between automatic snapshots; 0 disables them")
+	fs.IntVar(&backups.Keep, "backup-keep", backups.Keep, "number of automatic snapshots to keep")
+	fs.DurationVar(&dismissDeadAfter, "dismiss-dead", dismissDeadAfter, "dismiss minions this long after they die; 0 keeps them")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	initDB(c.dbPath)
+	initTemplates()
+	startBackups(backups)
+	startReaper(dismissDeadAfter)
+
+	log.Println("Listening on " + *addr)
+	return http.ListenAndServe(*addr, routes())
+}
+
+func (c *cli) list(args []string) error {
+	fs := c.flags("list", true)
+	all := fs.Bool("all", false, "include dismissed minions")
+	bestiary := fs.Bool("bestiary", false, "list the bestiary instead")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	camp, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	var minions []Minion
+	switch {
+	case *bestiary:
+		minions, err = listBestiary(camp.ID)
+	case *all:
+		minions, err = listAllMinions(camp.ID)
+	default:
+		minions, err = listActiveMinions(camp.ID)
+	}
+	if err != nil {
+		return err
+	}
+	return c.printMinions(minions)
+}
+
+func (c *cli) spawn(args []string) error {
+	fs := c.flags("spawn", true)
+	m := &Minion{}
+	fs.StringVar(&m.Name, "name", "", "name")
+	fs.IntVar(&m.MaxHP, "hp", 0, "hit points")
+	fs.IntVar(&m.AC, "ac", 10, "armor class")
+	fs.IntVar(&m.Attack, "attack", 0, "attack bonus")
+	fs.StringVar(&m.Damage, "damage", "", "damage dice, e.g. 1d6+2")
+	fs.StringVar(&m.Notes, "notes", "", "notes")
+	from := fs.Int64("from", 0, "bestiary entry to spawn from")
+	count := fs.Int("count", 1, "copies to spawn from the bestiary entry")
+	mob := fs.Bool("mob", false, "spawn the copies as one mob")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 || (*from == 0 && (m.Name == "" || m.MaxHP <= 0)) {
+		return errUsage
+	}
+	camp, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	if *from != 0 {
+		if *count < 1 || *count > maxSpawn {
+			return fmt.Errorf("count must be between 1 and %d", maxSpawn)
+		}
+		var spawned []*Minion
+		if *mob {
+			var m *Minion
+			m, err = spawnMob(camp.ID, *from, *count, 0)
+			spawned = []*Minion{m}
+		} else {
+			spawned, err = spawnFromBestiary(camp.ID, *from, *count, 0)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no bestiary entry %d", *from)
+		}
+		if err != nil {
+			return err
+		}
+		minions := make([]Minion, len(spawned))
+		for i, s := range spawned {
+			minions[i] = *s
+		}
+		return c.printMinions(minions)
+	}
+
+	m.HP = m.MaxHP
+	if err := createMinion(camp.ID, m); err != nil {
+		return err
+	}
+	return c.printMinions([]Minion{*m})
+}
+
+func (c *cli) damage(args []string) error { return c.adjust("damage", args, -1) }
+func (c *cli) heal(args []string) error   { return c.adjust("heal", args, 1) }
+
+// adjust applies AMOUNT of damage or healing, sign giving the direction.
+func (c *cli) adjust(name string, args []string, sign int) error {
+	fs := c.flags(name, true)
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errUsage
+	}
+	id, err := parseID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	amount, err := strconv.Atoi(fs.Arg(1))
+	if err != nil || amount < 0 {
+		return fmt.Errorf("amount %q must be a whole number of at least 0", fs.Arg(1))
+	}
+	camp, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	m, err := adjustHP(camp.ID, id, sign*amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no minion %d", id)
+	}
+	if err != nil {
+		return err
+	}
+	return c.printMinions([]Minion{*m})
+}
+
+func (c *cli) dismiss(args []string) error {
+	fs := c.flags("dismiss", true)
+	defeated := fs.Bool("defeated", false, "credit them to the ledger as defeated")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errUsage
+	}
+	ids := make([]int64, fs.NArg())
+	for i, arg := range fs.Args() {
+		id, err := parseID(arg)
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+	}
+	camp, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := deleteMinion(camp.ID, id, *defeated)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no minion %d", id)
+		}
+		if err != nil {
+			return err
+		}
+		if !c.json {
+			fmt.Fprintf(c.stdout, "dismissed %d\n", id)
+		}
+	}
+	if c.json {
+		return c.printJSON(map[string]any{"dismissed": ids})
+	}
+	return nil
+}
+
+func (c *cli) export(args []string) error {
+	fs := c.flags("export", true)
+	out := fs.String("o", "", "write to this file instead of stdout")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	camp, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	doc, err := exportCampaign(camp)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return c.printJSON(doc)
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*out, append(data, '\n'), 0o644)
+}
+
+// importFile reads a JSON export from FILE, or stdin when FILE is "-".
+func (c *cli) importFile(args []string) error {
+	fs := c.flags("import", true)
+	mode := fs.String("mode", importMerge, "merge with or replace the campaign's minions")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+	var data []byte
+	var err error
+	if fs.Arg(0) == "-" {
+		data, err = io.ReadAll(c.stdin)
+	} else {
+		data, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	var doc exportDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	camp, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	ids, err := importCampaign(camp.ID, &doc, *mode)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(map[string]any{"mode": *mode, "imported": len(doc.Minions), "ids": ids})
+	}
+	fmt.Fprintf(c.stdout, "imported %d minion(s) into %s (%s)\n", len(doc.Minions), camp.Slug, *mode)
+	return nil
+}
+
+func (c *cli) migrate(args []string) error {
+	fs := c.flags("migrate", false)
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	d, err := openDB(c.dbPath)
+	if err != nil {
+		return err
+	}
+	db, c.opened = d, d
+
+	before, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if err := migrate(db); err != nil {
+		return err
+	}
+	if before == len(migrations) {
+		fmt.Fprintf(c.stdout, "%s is up to date (schema version %d)\n", c.dbPath, before)
+	} else {
+		fmt.Fprintf(c.stdout, "migrated %s from schema version %d to %d\n", c.dbPath, before, len(migrations))
+	}
+	return nil
+}
+
+func parseID(arg string) (int64, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%q is not a minion id", arg)
+	}
+	return id, nil
+}
+
+func (c *cli) printJSON(v any) error {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printMinions writes minions as a table, or with -json as an array in the
+// same shape as the export document.
+func (c *cli) printMinions(minions []Minion) error {
+	if c.json {
+		owners, err := usernamesByID()
+		if err != nil {
+			return err
+		}
+		out := make([]exportMinion, len(minions))
+		for i, m := range minions {
+			out[i] = toExportMinion(m, owners)
+		}
+		return c.printJSON(out)
+	}
+
+	tw := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tHP\tAC\tATTACK\tDAMAGE\tSTATUS")
+	for _, m := range minions {
+		status := "active"
+		switch {
+		case m.Bestiary:
+			status = "bestiary"
+		case !m.Active:
+			status = "dismissed"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d/%d\t%d\t%+d\t%s\t%s\n",
+			m.ID, m.Name, m.HP, m.MaxHP, m.AC, m.Attack, strings.TrimSpace(m.Damage), status)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCLI runs one command line against the database at path and returns
+// its exit code and output. The global db is restored afterwards.
+func runCLI(t *testing.T, path string, args ...string) (int, string, string) {
+	t.Helper()
+	return runCLIInput(t, path, "", args...)
+}
+
+// runCLIInput is runCLI with stdin reading input
+func runCLIInput(t *testing.T, path, input string, args ...string) (int, string, string) {
+	t.Helper()
+
+	original := db
+	defer func() { db = original }()
+
+	var stdout, stderr bytes.Buffer
+	args = append([]string{args[0], "-db", path}, args[1:]...)
+	code := run(args, strings.NewReader(input), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCLIMinionLifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cli.db")
+
+	code, out, _ := runCLI(t, path, "migrate")
+	if code != 0 || !contains(out, "to "+itoa64(int64(len(migrations)))) {
+		t.Fatalf("Expected fresh database to be migrated, got %d %q", code, out)
+	}
+	if _, out, _ := runCLI(t, path, "migrate"); !contains(out, "up to date") {
+		t.Errorf("Expected second migrate to be a no-op, got %q", out)
+	}
+
+	code, out, errOut := runCLI(t, path, "spawn", "-json", "-name", "Goblin", "-hp", "7", "-ac", "15", "-attack", "4", "-damage", "1d6+2")
+	if code != 0 {
+		t.Fatalf("spawn failed: %s", errOut)
+	}
+	var spawned []exportMinion
+	if err := json.Unmarshal([]byte(out), &spawned); err != nil || len(spawned) != 1 || spawned[0].HP != 7 {
+		t.Fatalf("Unexpected spawn output %q (%v)", out, err)
+	}
+	id := itoa64(spawned[0].ID)
+
+	if code, out, _ := runCLI(t, path, "damage", id, "5"); code != 0 || !contains(out, "2/7") {
+		t.Errorf("Expected goblin at 2/7, got %d %q", code, out)
+	}
+	if code, out, _ := runCLI(t, path, "heal", id, "20"); code != 0 || !contains(out, "7/7") {
+		t.Errorf("Expected healing to stop at max, got %d %q", code, out)
+	}
+
+	code, out, _ = runCLI(t, path, "list")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if code != 0 || len(lines) != 2 || !strings.HasPrefix(lines[0], "ID") || !contains(lines[1], "Goblin") {
+		t.Errorf("Expected a header and one row, got %q", out)
+	}
+
+	if code, _, _ := runCLI(t, path, "dismiss", id); code != 0 {
+		t.Errorf("dismiss failed with %d", code)
+	}
+	if _, out, _ := runCLI(t, path, "list", "-json"); strings.TrimSpace(out) != "[]" {
+		t.Errorf("Expected no active minions, got %q", out)
+	}
+	if _, out, _ := runCLI(t, path, "list", "-all"); !contains(out, "dismissed") {
+		t.Errorf("Expected -all to show the dismissed goblin, got %q", out)
+	}
+}
+
+func TestCLIExportImport(t *testing.T) {
+	dir := t.TempDir()
+	source, target := filepath.Join(dir, "source.db"), filepath.Join(dir, "target.db")
+	file := filepath.Join(dir, "export.json")
+
+	runCLI(t, source, "spawn", "-name", "Wolf", "-hp", "11", "-ac", "13")
+	runCLI(t, source, "spawn", "-name", "Bandit", "-hp", "11", "-ac", "12")
+	if code, _, errOut := runCLI(t, source, "export", "-o", file); code != 0 {
+		t.Fatalf("export failed: %s", errOut)
+	}
+
+	code, out, errOut := runCLI(t, target, "import", "-mode", "replace", file)
+	if code != 0 || !contains(out, "imported 2 minion(s)") {
+		t.Fatalf("import failed: %d %q %s", code, out, errOut)
+	}
+	if _, out, _ := runCLI(t, target, "list"); !contains(out, "Wolf") || !contains(out, "Bandit") {
+		t.Errorf("Expected both minions in target, got %q", out)
+	}
+
+	// import - reads the export from stdin
+	data, _ := os.ReadFile(file)
+	code, out, errOut = runCLIInput(t, target, string(data), "import", "-")
+	if code != 0 || !contains(out, "imported 2 minion(s) into default (merge)") {
+		t.Fatalf("import from stdin failed: %d %q %s", code, out, errOut)
+	}
+	if _, out, _ := runCLI(t, target, "list", "-json"); strings.Count(out, `"Wolf"`) != 2 {
+		t.Errorf("Expected a second wolf merged in, got %q", out)
+	}
+	if code, _, errOut := runCLIInput(t, target, "not json", "import", "-"); code != 1 || !contains(errOut, "invalid JSON") {
+		t.Errorf("Expected bad stdin refused, got %d %q", code, errOut)
+	}
+}
+
+func TestCLIErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cli.db")
+
+	for _, tt := range []struct {
+		args []string
+		code int
+		want string
+	}{
+		{[]string{"damage", "1"}, 2, "usage: minion-tracker damage"},
+		{[]string{"damage", "1", "-3"}, 1, "at least 0"},
+		{[]string{"damage", "99", "3"}, 1, "no minion 99"},
+		{[]string{"heal", "goblin", "3"}, 1, "not a minion id"},
+		{[]string{"spawn", "-name", "Nobody"}, 2, "usage"},
+		{[]string{"list", "-campaign", "nowhere"}, 1, `no campaign "nowhere"`},
+		{[]string{"list", "-bogus"}, 2, "flag provided but not defined"},
+	} {
+		code, _, errOut := runCLI(t, path, tt.args...)
+		if code != tt.code || !contains(errOut, tt.want) {
+			t.Errorf("%v: expected exit %d with %q, got %d %q", tt.args, tt.code, tt.want, code, errOut)
+		}
+	}
+
+	var stderr bytes.Buffer
+	if code := run([]string{"frobnicate"}, strings.NewReader(""), &stderr, &stderr); code != 2 || !contains(stderr.String(), "unknown command") {
+		t.Errorf("Expected unknown command to be rejected, got %d %q", code, stderr.String())
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxTurnLimit bounds the per-turn time limit; zero means no limit.
+const maxTurnLimit = 3600
+
+// clockWarnAt is the share of the limit a turn can use before the clock
+// warns that time is running out.
+const clockWarnAt = 0.75
+
+// Clock states, as the turn clock's CSS classes.
+const (
+	clockRunning = "running"
+	clockWarning = "warning"
+	clockOver    = "over"
+)
+
+// turnClock times the current turn. The start is stored server-side, so
+// every viewer sees the same clock however often they poll.
+type turnClock struct {
+	Started time.Time
+	Elapsed time.Duration
+	Limit   time.Duration // zero for none
+}
+
+// State says how the turn is doing against its limit.
+func (c *turnClock) State() string {
+	switch {
+	case c.Limit <= 0:
+		return clockRunning
+	case c.Elapsed >= c.Limit:
+		return clockOver
+	case float64(c.Elapsed) >= clockWarnAt*float64(c.Limit):
+		return clockWarning
+	}
+	return clockRunning
+}
+
+// Remaining is the time left before the limit, never negative.
+func (c *turnClock) Remaining() time.Duration {
+	return max(c.Limit-c.Elapsed, 0)
+}
+
+// formatClock shows a duration as a clock does, "1:05", rounding down to
+// the second.
+func formatClock(d time.Duration) string {
+	s := int(d / time.Second)
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// finishTurn logs how long the current turn took, if one is running, to
+// the campaign's current encounter.
+func finishTurn(q querier, campaignID int64, now time.Time) error {
+	var turnID, started sql.NullInt64
+	var round, encounter int
+	if err := q.QueryRow(`SELECT turn_id, turn_started, round, encounter FROM campaigns WHERE id = ?`, campaignID).
+		Scan(&turnID, &started, &round, &encounter); err != nil {
+		return err
+	}
+	if !turnID.Valid || !started.Valid {
+		return nil
+	}
+	name, minionID := "Lair actions", sql.NullInt64{}
+	if turnID.Int64 != lairTurn {
+		minionID = turnID
+		if err := q.QueryRow(`SELECT name FROM minions WHERE id = ?`, turnID.Int64).Scan(&name); err != nil {
+			return err
+		}
+	}
+	_, err := q.Exec(`INSERT INTO turn_times (campaign_id, encounter, minion_id, name, round, started, seconds)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		campaignID, encounter, minionID, name, round, started.Int64, max(now.Unix()-started.Int64, 0))
+	return err
+}
+
+// turnStat is how long one combatant's turns took in an encounter.
+type turnStat struct {
+	Name    string
+	Turns   int
+	Total   time.Duration
+	Longest time.Duration
+}
+
+// Average is the combatant's mean turn length.
+func (s turnStat) Average() time.Duration {
+	if s.Turns == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Turns)
+}
+
+// loadTurnStats totals an encounter's turn times per combatant, slowest on
+// average first.
+func loadTurnStats(campaignID int64, encounter int) ([]turnStat, error) {
+	rows, err := db.Query(`SELECT name, COUNT(*), SUM(seconds), MAX(seconds) FROM turn_times
+		WHERE campaign_id = ? AND encounter = ? GROUP BY minion_id, name
+		ORDER BY SUM(seconds) * 1.0 / COUNT(*) DESC, name`, campaignID, encounter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []turnStat
+	for rows.Next() {
+		var s turnStat
+		var total, longest int64
+		if err := rows.Scan(&s.Name, &s.Turns, &total, &longest); err != nil {
+			return nil, err
+		}
+		s.Total, s.Longest = time.Duration(total)*time.Second, time.Duration(longest)*time.Second
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+var errTurnLimit = fmt.Errorf("the turn limit must be from 0 to %d seconds", maxTurnLimit)
+
+func setTurnLimit(campaignID int64, seconds int) error {
+	if seconds < 0 || seconds > maxTurnLimit {
+		return errTurnLimit
+	}
+	_, err := db.Exec(`UPDATE campaigns SET turn_limit = ? WHERE id = ?`, seconds, campaignID)
+	return err
+}
+
+func handleTurnLimit(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	r.ParseForm()
+	// A blank limit turns the limit off.
+	var seconds int
+	var err error
+	if v := r.FormValue("limit"); v != "" {
+		seconds, err = strconv.Atoi(v)
+	}
+	if err != nil {
+		err = errTurnLimit
+	} else {
+		err = setTurnLimit(c.ID, seconds)
+	}
+	if errors.Is(err, errTurnLimit) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	t, err := loadTurnOrder(db, c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "turn-order", map[string]any{"Campaign": c, "Turns": t})
+}
+
+// handleTurnClock answers the clock's poll. The poll says which turn it
+// was showing; when the turn has moved on since, the turn order and the
+// list are told to refresh.
+func handleTurnClock(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	t, err := loadTurnOrder(db, c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if r.URL.Query().Get("turn") != t.Key() {
+		w.Header().Set("HX-Trigger", "turn-changed, minions-changed")
+	}
+	tmpl.ExecuteTemplate(w, "turn-clock", map[string]any{"Campaign": c, "Turns": t})
+}
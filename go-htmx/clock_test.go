@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTurnClockState(t *testing.T) {
+	tests := []struct {
+		elapsed, limit time.Duration
+		want           string
+	}{
+		{5 * time.Minute, 0, clockRunning},
+		{30 * time.Second, time.Minute, clockRunning},
+		{45 * time.Second, time.Minute, clockWarning},
+		{time.Minute, time.Minute, clockOver},
+	}
+	for _, tt := range tests {
+		c := &turnClock{Elapsed: tt.elapsed, Limit: tt.limit}
+		if got := c.State(); got != tt.want {
+			t.Errorf("State() at %v of %v = %q, want %q", tt.elapsed, tt.limit, got, tt.want)
+		}
+	}
+	if c := (&turnClock{Elapsed: 90 * time.Second, Limit: time.Minute}); c.Remaining() != 0 {
+		t.Errorf("Expected no time remaining, got %v", c.Remaining())
+	}
+	if got := formatClock(65*time.Second + 900*time.Millisecond); got != "1:05" {
+		t.Errorf("formatClock = %q, want 1:05", got)
+	}
+}
+
+// rewindTurn moves the current turn's start back, as if it began d ago.
+func rewindTurn(t *testing.T, d time.Duration) {
+	t.Helper()
+
+	if _, err := db.Exec(`UPDATE campaigns SET turn_started = turn_started - ? WHERE id = ?`,
+		int64(d/time.Second), defaultCampaignID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// about reports whether d is s seconds, give or take the second a slow
+// test may tick over.
+func about(d time.Duration, s int) bool {
+	return d >= time.Duration(s)*time.Second && d <= time.Duration(s+1)*time.Second
+}
+
+func TestTurnTimes(t *testing.T) {
+	useTestDB(t)
+	insertTestMinion(t, inOrder("Goblin", 15))
+	insertTestMinion(t, inOrder("Wolf", 12))
+
+	advanceTurn(defaultCampaignID)
+	rewindTurn(t, 30*time.Second)
+	advanceTurn(defaultCampaignID)
+	rewindTurn(t, 50*time.Second)
+	turns, _ := advanceTurn(defaultCampaignID)
+	if turns.Clock == nil || turns.Round != 2 || !about(turns.Clock.Elapsed, 0) {
+		t.Fatalf("Expected a fresh clock in round 2, got %+v", turns.Clock)
+	}
+	rewindTurn(t, 10*time.Second)
+	if turns, _ = endCombat(defaultCampaignID); turns.Clock != nil {
+		t.Errorf("Expected the clock stopped, got %+v", turns.Clock)
+	}
+
+	l, err := loadCurrentLedger(defaultCampaignID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Turns) != 2 || l.Turns[0].Name != "Wolf" || l.Turns[1].Name != "Goblin" {
+		t.Fatalf("Expected the wolf's slow turn first, got %+v", l.Turns)
+	}
+	wolf, goblin := l.Turns[0], l.Turns[1]
+	if wolf.Turns != 1 || !about(wolf.Average(), 50) || goblin.Turns != 2 || !about(goblin.Average(), 20) || !about(goblin.Longest, 30) {
+		t.Errorf("Unexpected turn stats %+v", l.Turns)
+	}
+	if md := l.Markdown(); !contains(md, "## Turns") || !contains(md, "| Goblin | 2 |") {
+		t.Errorf("Expected the turn stats in the markdown, got %s", md)
+	}
+
+	// Turns in the next encounter are counted afresh
+	endEncounter(defaultCampaignID)
+	if l, _ := loadCurrentLedger(defaultCampaignID); len(l.Turns) != 0 {
+		t.Errorf("Expected no turns yet, got %+v", l.Turns)
+	}
+}
+
+func TestHandleTurnClock(t *testing.T) {
+	useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	_, playerToken := createTestUser(t, "pc", rolePlayer)
+	insertTestMinion(t, inOrder("Goblin", 12))
+
+	for _, limit := range []string{"-5", "soon", "7200"} {
+		if rec := serveAs(t, token, "POST", "/c/default/turns/limit", strings.NewReader("limit="+limit)); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for limit %q, got %d", limit, rec.Code)
+		}
+	}
+	rec := serveAs(t, token, "POST", "/c/default/turns/limit", strings.NewReader("limit=60"))
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), `name="limit" type="number" min="0" max="3600" step="5" value="60"`) {
+		t.Errorf("Expected a 60 second limit, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveAs(t, playerToken, "POST", "/c/default/turns/limit", strings.NewReader("limit=0")); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a player, got %d", rec.Code)
+	}
+
+	rec = serveAs(t, token, "POST", "/c/default/turns/next", nil)
+	if !contains(rec.Body.String(), `class="turn-clock running"`) || !contains(rec.Body.String(), "turns/clock?turn=1-") {
+		t.Errorf("Expected the clock to start, got %s", rec.Body.String())
+	}
+	turns, _ := loadTurnOrder(db, defaultCampaignID)
+	path := "/c/default/turns/clock?turn=" + turns.Key()
+
+	rewindTurn(t, 50*time.Second)
+	rec = serveAs(t, token, "GET", path, nil)
+	if !contains(rec.Body.String(), `class="turn-clock warning"`) || !contains(rec.Body.String(), "left</small>") {
+		t.Errorf("Expected a warning near the limit, got %s", rec.Body.String())
+	}
+	if rec.Header().Get("HX-Trigger") != "" {
+		t.Errorf("Expected no refresh while the turn lasts, got %q", rec.Header().Get("HX-Trigger"))
+	}
+	rewindTurn(t, 20*time.Second)
+	if rec := serveAs(t, token, "GET", path, nil); !contains(rec.Body.String(), `class="turn-clock over"`) ||
+		!contains(rec.Body.String(), "<mark>Time's up</mark>") {
+		t.Errorf("Expected time to be up, got %s", rec.Body.String())
+	}
+
+	// Once the turn passes, a poll for the old one refreshes the order
+	serveAs(t, token, "POST", "/c/default/turns/next", nil)
+	if rec := serveAs(t, token, "GET", path, nil); !contains(rec.Header().Get("HX-Trigger"), "turn-changed") {
+		t.Errorf("Expected turn-changed, got %q", rec.Header().Get("HX-Trigger"))
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Kinds of combatant. Minions are the GM's side and everything in the
+// tracker is built for them; PCs and allies share the turn order and can
+// be attacked, but are not dismissed, filed in the bestiary, rated in the
+// encounter or credited to the ledger.
+const (
+	kindMinion = "minion"
+	kindPC     = "pc"
+	kindAlly   = "ally"
+)
+
+// combatantKinds are the kinds added through the party panel.
+var combatantKinds = []string{kindPC, kindAlly}
+
+// IsMinion reports whether m is one of the GM's minions.
+func (m Minion) IsMinion() bool {
+	return m.Kind == "" || m.Kind == kindMinion
+}
+
+// KindLabel names m's kind for the turn order and the party panel.
+func (m Minion) KindLabel() string {
+	switch m.Kind {
+	case kindPC:
+		return "PC"
+	case kindAlly:
+		return "Ally"
+	}
+	return ""
+}
+
+// TracksHP reports whether the GM keeps m's hit points. A PC added with
+// only a name and initiative leaves them to the player.
+func (m Minion) TracksHP() bool {
+	return m.MaxHP > 0
+}
+
+var (
+	errNotMinion      = errors.New("only minions can be dismissed")
+	errNoCombatant    = errors.New("give the combatant a name")
+	errCombatantKind  = errors.New("a combatant is a PC or an ally")
+	errCombatantStats = errors.New("AC and HP must not be negative")
+	errUntrackedHP    = errors.New("this combatant's HP is not tracked")
+)
+
+// parseCombatantForm reads the party panel's add and edit forms. Only the
+// name is required.
+func parseCombatantForm(r *http.Request) (*Minion, error) {
+	m := &Minion{Name: strings.TrimSpace(r.FormValue("name")), Kind: r.FormValue("kind"), Active: true}
+	if m.Name == "" {
+		return nil, errNoCombatant
+	}
+	if m.Kind == "" {
+		m.Kind = kindPC
+	}
+	if m.Kind != kindPC && m.Kind != kindAlly {
+		return nil, errCombatantKind
+	}
+	if n, err := strconv.Atoi(r.FormValue("initiative")); err == nil {
+		m.Initiative = &n
+	}
+	number := func(key string) (int, error) {
+		v := r.FormValue(key)
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, errCombatantStats
+		}
+		return n, nil
+	}
+	var err error
+	if m.AC, err = number("ac"); err != nil {
+		return nil, err
+	}
+	if m.MaxHP, err = number("max_hp"); err != nil {
+		return nil, err
+	}
+	m.HP = m.MaxHP
+	if _, ok := r.Form["hp"]; ok {
+		if m.HP, err = number("hp"); err != nil {
+			return nil, err
+		}
+		m.HP = min(m.HP, m.MaxHP)
+	}
+	// PCs fall unconscious and make death saves; allies die like anyone.
+	m.DeathPolicy = deathDies
+	if m.Kind == kindPC {
+		m.DeathPolicy = deathUnconscious
+	}
+	return m, nil
+}
+
+// listCombatants lists the PCs and allies in play, in initiative order
+// and those who have not rolled last.
+func listCombatants(campaignID int64) ([]Minion, error) {
+	rows, err := db.Query(minionSelect+` WHERE m.campaign_id = ? AND m.active = 1 AND m.kind != ?
+		ORDER BY m.initiative IS NULL, m.initiative DESC, m.name COLLATE NOCASE`, campaignID, kindMinion)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var combatants []Minion
+	for rows.Next() {
+		var m Minion
+		if err := scanMinion(rows, &m); err != nil {
+			return nil, err
+		}
+		combatants = append(combatants, m)
+	}
+	return combatants, rows.Err()
+}
+
+// getCombatant loads a PC or ally in play; minions and the dismissed are
+// not found.
+func getCombatant(campaignID, id int64) (*Minion, error) {
+	m, err := getMinion(campaignID, id)
+	if err == nil && (m.IsMinion() || !m.Active) {
+		err = sql.ErrNoRows
+	}
+	return m, err
+}
+
+// updateCombatant writes the party panel's edit form over a PC or ally.
+// Like updateMinion, giving a fallen combatant HP brings them back.
+func updateCombatant(campaignID int64, m *Minion) error {
+	return expectRow(db.Exec(`UPDATE minions SET name = ?, kind = ?, initiative = ?, ac = ?, hp = ?, max_hp = ?,
+		 died_at = CASE WHEN ? > 0 THEN NULL ELSE died_at END,
+		 death_successes = CASE WHEN ? > 0 THEN 0 ELSE death_successes END,
+		 death_failures = CASE WHEN ? > 0 THEN 0 ELSE death_failures END,
+		 version = version + 1
+		 WHERE campaign_id = ? AND id = ? AND kind != ? AND active = 1`,
+		m.Name, m.Kind, m.Initiative, m.AC, m.HP, m.MaxHP, m.HP, m.HP, m.HP, campaignID, m.ID, kindMinion))
+}
+
+// removeCombatant takes a PC or ally out of play. Unlike dismissing a
+// minion it logs nothing and credits nothing.
+func removeCombatant(campaignID, id int64) error {
+	return expectRow(db.Exec(`UPDATE minions SET active = 0, version = version + 1
+		WHERE campaign_id = ? AND id = ? AND kind != ? AND active = 1`, campaignID, id, kindMinion))
+}
+
+// attackTarget reads the attack forms' optional target, a PC or ally
+// picked in the party panel. It returns nil when none was picked and
+// sql.ErrNoRows when the pick is not one.
+func attackTarget(r *http.Request) (*Minion, error) {
+	v := r.FormValue("target")
+	if v == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, sql.ErrNoRows
+	}
+	return getCombatant(campaignID(r), id)
+}
+
+// renderCombatants answers the party panel's actions. The turn order is
+// told to refresh, since initiatives may have changed.
+func renderCombatants(w http.ResponseWriter, c *Campaign) {
+	combatants, err := listCombatants(c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("HX-Trigger", "turn-changed")
+	tmpl.ExecuteTemplate(w, "combatants", map[string]any{"Campaign": c, "Combatants": combatants})
+}
+
+func handleCombatants(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	combatants, err := listCombatants(c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "combatants", map[string]any{"Campaign": c, "Combatants": combatants})
+}
+
+func handleAddCombatant(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	r.ParseForm()
+	m, err := parseCombatantForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.OwnerID = currentUser(r).ID
+	if err := insertMinion(db, c.ID, m); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	renderCombatants(w, c)
+}
+
+func handleUpdateCombatant(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	r.ParseForm()
+	m, err := parseCombatantForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.ID = id
+	err = updateCombatant(c.ID, m)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	renderCombatants(w, c)
+}
+
+// handleCombatantHP applies damage or healing to a PC or ally, e.g. from
+// a minion's attack on them.
+func handleCombatantHP(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	r.ParseForm()
+	amount, err := strconv.Atoi(r.FormValue("amount"))
+	if err != nil || amount <= 0 {
+		http.Error(w, "amount must be a positive number", http.StatusBadRequest)
+		return
+	}
+	switch r.PathValue("action") {
+	case "damage":
+		amount = -amount
+	case "heal":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	m, err := getCombatant(c.ID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !m.TracksHP() {
+		http.Error(w, errUntrackedHP.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := adjustHP(c.ID, id, amount); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	renderCombatants(w, c)
+}
+
+func handleRemoveCombatant(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	err := removeCombatant(c.ID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	renderCombatants(w, c)
+}
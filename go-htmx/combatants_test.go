@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// partyMember is a PC with the given initiative, AC and HP.
+func partyMember(name string, n, ac, hp int) *Minion {
+	return &Minion{Name: name, Kind: kindPC, Active: true, Initiative: initiative(n), AC: ac, HP: hp, MaxHP: hp,
+		DeathPolicy: deathUnconscious}
+}
+
+func TestParseCombatantForm(t *testing.T) {
+	parse := func(form url.Values) (*Minion, error) {
+		r := &http.Request{Form: form}
+		return parseCombatantForm(r)
+	}
+	m, err := parse(url.Values{"name": {" Aria "}, "initiative": {"17"}, "ac": {"16"}, "max_hp": {"32"}})
+	if err != nil || m.Name != "Aria" || m.Kind != kindPC || *m.Initiative != 17 || m.AC != 16 || m.HP != 32 ||
+		m.DeathPolicy != deathUnconscious {
+		t.Errorf("Unexpected PC %+v, %v", m, err)
+	}
+	m, err = parse(url.Values{"name": {"Guard"}, "kind": {"ally"}})
+	if err != nil || m.Initiative != nil || m.TracksHP() || m.DeathPolicy != deathDies || m.KindLabel() != "Ally" {
+		t.Errorf("Unexpected ally %+v, %v", m, err)
+	}
+	if m, _ := parse(url.Values{"name": {"Aria"}, "max_hp": {"32"}, "hp": {"40"}}); m.HP != 32 {
+		t.Errorf("Expected HP capped at the max, got %d", m.HP)
+	}
+	for _, form := range []url.Values{
+		{"name": {""}},
+		{"name": {"Aria"}, "kind": {"minion"}},
+		{"name": {"Aria"}, "ac": {"-1"}},
+		{"name": {"Aria"}, "max_hp": {"lots"}},
+	} {
+		if _, err := parse(form); err == nil {
+			t.Errorf("Expected %v to be rejected", form)
+		}
+	}
+}
+
+func TestCombatantsAreNotMinions(t *testing.T) {
+	useTestDB(t)
+	aria := insertTestMinion(t, partyMember("Aria", 17, 16, 10))
+	insertTestMinion(t, inOrder("Goblin", 12))
+
+	turns, _ := loadTurnOrder(db, defaultCampaignID)
+	if got := turnNames(turns); got != "Aria Goblin" {
+		t.Errorf("Expected the PC in the turn order, got %q", got)
+	}
+	if minions, _ := listActiveMinions(defaultCampaignID); len(minions) != 1 || minions[0].Name != "Goblin" {
+		t.Errorf("Expected only the goblin as a minion, got %+v", minions)
+	}
+	if page, _ := listMinions(defaultCampaignID, minionQuery{}); page.Total != 1 {
+		t.Errorf("Expected the list to leave the PC out, got %d", page.Total)
+	}
+	if err := deleteMinion(defaultCampaignID, aria.ID, false); !errors.Is(err, errNotMinion) {
+		t.Errorf("Expected a PC not to be dismissed, got %v", err)
+	}
+
+	// A fallen PC is worth nothing and is not reaped
+	db.Exec(`UPDATE minions SET xp = 200 WHERE id = ?`, aria.ID)
+	adjustHP(defaultCampaignID, aria.ID, -10)
+	for range 3 {
+		adjustHP(defaultCampaignID, aria.ID, -1)
+	}
+	if m, _ := getMinion(defaultCampaignID, aria.ID); !m.Dead {
+		t.Fatalf("Expected Aria dead after three failed saves, got %+v", m)
+	}
+	dismissDead(time.Now().Add(time.Hour))
+	if m, _ := getCombatant(defaultCampaignID, aria.ID); m == nil || !m.Active {
+		t.Errorf("Expected the reaper to leave the PC alone")
+	}
+	if l, _ := loadCurrentLedger(defaultCampaignID); len(l.Awards) != 0 {
+		t.Errorf("Expected no award for a PC, got %+v", l.Awards)
+	}
+
+	if err := removeCombatant(defaultCampaignID, aria.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getCombatant(defaultCampaignID, aria.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected Aria out of play, got %v", err)
+	}
+}
+
+func TestHandleCombatants(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	_, playerToken := createTestUser(t, "pc", rolePlayer)
+
+	if rec := serveAs(t, token, "POST", "/c/default/combatants", strings.NewReader("name=")); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a name, got %d", rec.Code)
+	}
+	form := url.Values{"name": {"Aria"}, "kind": {"pc"}, "initiative": {"17"}, "ac": {"16"}, "max_hp": {"32"}}
+	rec := serveAs(t, token, "POST", "/c/default/combatants", strings.NewReader(form.Encode()))
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), `">Aria (AC 16)</option>`) ||
+		rec.Header().Get("HX-Trigger") != "turn-changed" {
+		t.Fatalf("Expected Aria as an attack target, got %d: %s", rec.Code, rec.Body.String())
+	}
+	serveAs(t, token, "POST", "/c/default/combatants", strings.NewReader("name=Bram&kind=ally&initiative=5"))
+	combatants, _ := listCombatants(defaultCampaignID)
+	if len(combatants) != 2 || combatants[0].Name != "Aria" || combatants[1].Kind != kindAlly {
+		t.Fatalf("Unexpected combatants %+v", combatants)
+	}
+	aria, bram := itoa64(combatants[0].ID), itoa64(combatants[1].ID)
+
+	if rec := serveAs(t, token, "GET", "/c/default/", nil); !contains(rec.Body.String(), "Party &amp; allies") ||
+		!contains(rec.Body.String(), `Aria <mark class="tag">PC</mark>`) {
+		t.Errorf("Expected the party panel on the page, got %s", rec.Body.String())
+	}
+
+	// Minions attack Aria at her AC and the damage can be applied
+	id := createTestMinion(t, testDB, &Minion{Name: "Ogre", HP: 59, MaxHP: 59, Attack: 6, Damage: "2d8+4"})
+	fixedRolls(t, 10, 3, 3)
+	rec = serveAs(t, token, "POST", "/c/default/minions/"+itoa64(id)+"/attacks/roll", strings.NewReader("target="+aria))
+	if body := rec.Body.String(); !contains(body, "10 damage</strong> against Aria (AC 16)") ||
+		!contains(body, `hx-vals='{"amount": 10}'`) {
+		t.Errorf("Expected a hit on Aria with damage to apply, got %s", body)
+	}
+	// Only the GM is offered the button; players may not damage the party
+	fixedRolls(t, 10, 3, 3)
+	rec = serveAs(t, playerToken, "POST", "/c/default/minions/"+itoa64(id)+"/attacks/roll", strings.NewReader("target="+aria))
+	if body := rec.Body.String(); !contains(body, "10 damage</strong> against Aria (AC 16)") || contains(body, "Apply") {
+		t.Errorf("Expected the hit without a damage button for a player, got %s", body)
+	}
+	rec = serveAs(t, token, "POST", "/c/default/combatants/"+aria+"/damage", strings.NewReader("amount=10"))
+	if c, _ := getCombatant(defaultCampaignID, combatants[0].ID); c.HP != 22 {
+		t.Errorf("Expected Aria on 22 HP, got %d", c.HP)
+	}
+	if rec := serveAs(t, token, "POST", "/c/default/minions/"+itoa64(id)+"/attacks/roll", strings.NewReader("target="+itoa64(id))); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a minion as the target, got %d", rec.Code)
+	}
+	if rec := serveAs(t, token, "POST", "/c/default/combatants/"+bram+"/damage", strings.NewReader("amount=3")); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for untracked HP, got %d", rec.Code)
+	}
+
+	form = url.Values{"name": {"Bram"}, "kind": {"ally"}, "initiative": {"21"}, "ac": {"14"}, "max_hp": {"20"}, "hp": {"12"}}
+	serveAs(t, token, "PUT", "/c/default/combatants/"+bram, strings.NewReader(form.Encode()))
+	if turns, _ := loadTurnOrder(db, defaultCampaignID); turnNames(turns) != "Bram Aria" {
+		t.Errorf("Expected Bram to go first now, got %q", turnNames(turns))
+	}
+
+	if rec := serveAs(t, token, "DELETE", "/c/default/minions/"+aria, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 dismissing a PC, got %d", rec.Code)
+	}
+	if rec := serveAs(t, token, "DELETE", "/c/default/combatants/"+itoa64(id), nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 removing a minion as a combatant, got %d", rec.Code)
+	}
+	if rec := serveAs(t, playerToken, "POST", "/c/default/combatants", strings.NewReader("name=Sneaky")); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a player, got %d", rec.Code)
+	}
+	rec = serveAs(t, token, "DELETE", "/c/default/combatants/"+aria, nil)
+	if contains(rec.Body.String(), "Aria") {
+		t.Errorf("Expected Aria gone from the panel, got %s", rec.Body.String())
+	}
+}
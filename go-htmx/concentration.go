@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// concentrationDC is the Constitution save a concentrating creature makes
+// when it takes damage: 10 or half the damage, whichever is higher.
+func concentrationDC(damage int) int {
+	return max(10, damage/2)
+}
+
+// checkConcentration runs after a minion took damage and ended up in
+// state s. A concentrating minion rolls its Constitution save and drops
+// the spell on a failure; one knocked to 0 HP drops it without a save.
+func checkConcentration(q querier, campaignID, id int64, damage int, s lifeState) error {
+	m := &Minion{}
+	var saves string
+	sc := &m.Scores
+	err := q.QueryRow(
+		`SELECT concentration, str_score, dex_score, con_score, int_score, wis_score, cha_score, saves, prof_bonus
+		 FROM minions WHERE campaign_id = ? AND id = ?`, campaignID, id).
+		Scan(&m.Concentration, &sc[0], &sc[1], &sc[2], &sc[3], &sc[4], &sc[5], &saves, &m.ProfBonus)
+	if err != nil || m.Concentration == "" {
+		return err
+	}
+	m.Saves = parseSaves(saves)
+
+	e := minionEvent{Kind: eventConcentration}
+	held := false
+	switch {
+	case s.HP == 0 && s.Dead:
+		e.Detail = "lost " + m.Concentration + ", died"
+	case s.HP == 0:
+		e.Detail = "lost " + m.Concentration + ", unconscious"
+	default:
+		res := rollSave(m, abilityCon, concentrationDC(damage), rollNormal)
+		held = res.Passed
+		verb := "lost "
+		if held {
+			verb = "kept "
+		}
+		e.Detail = verb + m.Concentration + ", CON " + strconv.Itoa(res.Total) + " vs DC " + strconv.Itoa(res.DC)
+	}
+	if !held {
+		if _, err := q.Exec(`UPDATE minions SET concentration = '' WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+	return logEvent(q, campaignID, id, e)
+}
+
+// setConcentration starts concentration on spell, ending any spell held
+// before, or just ends it when spell is empty.
+func setConcentration(campaignID, id int64, spell string) (*Minion, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRow(`SELECT concentration FROM minions WHERE campaign_id = ? AND id = ?`, campaignID, id).
+		Scan(&current); err != nil {
+		return nil, err
+	}
+	if current == spell {
+		return getMinion(campaignID, id)
+	}
+	if _, err := tx.Exec(`UPDATE minions SET concentration = ?, version = version + 1 WHERE id = ?`, spell, id); err != nil {
+		return nil, err
+	}
+	if current != "" {
+		if err := logEvent(tx, campaignID, id, minionEvent{Kind: eventConcentration, Detail: "ended " + current}); err != nil {
+			return nil, err
+		}
+	}
+	if spell != "" {
+		if err := logEvent(tx, campaignID, id, minionEvent{Kind: eventConcentration, Detail: "started " + spell}); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return getMinion(campaignID, id)
+}
+
+func handleConcentration(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	r.ParseForm()
+	m, err := setConcentration(campaignID(r), id, strings.TrimSpace(r.FormValue("spell")))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "minion-row", m)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestConcentrationDC(t *testing.T) {
+	for damage, want := range map[int]int{1: 10, 19: 10, 21: 10, 22: 11, 45: 22} {
+		if got := concentrationDC(damage); got != want {
+			t.Errorf("concentrationDC(%d) = %d, want %d", damage, got, want)
+		}
+	}
+}
+
+// concentratingMage puts a mage with CON 14 and a +2 proficient CON save
+// into play, concentrating on spell.
+// cultFanatic is a caster proficient in CON saves, at +4, who stays up
+// at 0 HP.
+func cultFanatic() *Minion {
+	return &Minion{Name: "Cult Fanatic", HP: 33, MaxHP: 33, Active: true, DeathPolicy: deathUnconscious,
+		Scores: abilityScores{11, 14, 14, 10, 13, 14}, Saves: []string{"con"}, ProfBonus: 2}
+}
+
+func lastEvent(t *testing.T, id int64) minionEvent {
+	t.Helper()
+
+	events, err := listEvents(defaultCampaignID, id)
+	if err != nil || len(events) == 0 {
+		t.Fatalf("Expected events, got %v, %v", events, err)
+	}
+	return events[len(events)-1]
+}
+
+func TestConcentrationSave(t *testing.T) {
+	useTestDB(t)
+	id := insertTestMinion(t, cultFanatic()).ID
+	setConcentration(defaultCampaignID, id, "Hold Person")
+
+	// 8 on the d20 +4 meets DC 10
+	fixedRolls(t, 8)
+	m, err := adjustMemberHP(defaultCampaignID, id, anyMember, -5)
+	if err != nil {
+		t.Fatalf("Damage failed: %v", err)
+	}
+	if m.Concentration != "Hold Person" || lastEvent(t, id).Detail != "kept Hold Person, CON 12 vs DC 10" {
+		t.Errorf("Expected concentration kept, got %q, %+v", m.Concentration, lastEvent(t, id))
+	}
+
+	// 24 damage makes it DC 12, which 7+4 misses
+	fixedRolls(t, 7)
+	m, _ = adjustMemberHP(defaultCampaignID, id, anyMember, -24)
+	if m.Concentration != "" || lastEvent(t, id).Detail != "lost Hold Person, CON 11 vs DC 12" {
+		t.Errorf("Expected concentration lost, got %q, %+v", m.Concentration, lastEvent(t, id))
+	}
+
+	// Healing never asks for a save
+	setConcentration(defaultCampaignID, id, "Bless")
+	adjustMemberHP(defaultCampaignID, id, anyMember, 3)
+	if e := lastEvent(t, id); e.Kind != eventHeal {
+		t.Errorf("Expected no concentration check on healing, got %+v", e)
+	}
+}
+
+func TestConcentrationLostAtZero(t *testing.T) {
+	useTestDB(t)
+	id := insertTestMinion(t, cultFanatic()).ID
+	setConcentration(defaultCampaignID, id, "Spiritual Weapon")
+
+	fixedRolls(t, 20)
+	m, _ := adjustMemberHP(defaultCampaignID, id, anyMember, -40)
+	if m.Concentration != "" || lastEvent(t, id).Detail != "lost Spiritual Weapon, unconscious" {
+		t.Errorf("Expected concentration to end without a save at 0 HP, got %q, %+v", m.Concentration, lastEvent(t, id))
+	}
+}
+
+func TestHandleConcentration(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	id := createTestMinion(t, testDB, &Minion{Name: "Acolyte", HP: 9, MaxHP: 9})
+	path := "/c/default/minions/" + itoa64(id)
+
+	rec := serveAs(t, token, "POST", path+"/concentration", strings.NewReader("spell=Bless"))
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), "<strong>Conc</strong> Bless") {
+		t.Errorf("Expected the row to show Bless, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// An edit leaves concentration alone
+	serveAs(t, token, "PUT", path, strings.NewReader("name=Acolyte&hp=9&max_hp=9&ac=10&attack=2"))
+	if m, _ := getMinion(defaultCampaignID, id); m.Concentration != "Bless" {
+		t.Errorf("Expected an edit to keep concentration, got %q", m.Concentration)
+	}
+
+	rec = serveAs(t, token, "POST", path+"/concentration", strings.NewReader("spell="))
+	if contains(rec.Body.String(), "<strong>Conc</strong>") {
+		t.Errorf("Expected concentration dropped, got %s", rec.Body.String())
+	}
+	events, _ := listEvents(defaultCampaignID, id)
+	if len(events) != 2 || events[0].Detail != "started Bless" || events[1].Detail != "ended Bless" {
+		t.Errorf("Expected start and end in the history, got %+v", events)
+	}
+	if rec := serveAs(t, token, "POST", "/c/default/minions/999/concentration", strings.NewReader("spell=Bless")); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", rec.Code)
+	}
+}
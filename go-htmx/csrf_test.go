@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRFTokenRenderedInLayout(t *testing.T) {
+	useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	_, csrf, _ := lookupSession(token)
+
+	rec := serveAs(t, token, "GET", "/c/default/", nil)
+	body := rec.Body.String()
+	if !contains(body, `hx-headers='{"X-CSRF-Token": "`+csrf+`"}'`) {
+		t.Error("Expected layout to send the session CSRF token via hx-headers")
+	}
+}
+
+func TestForgedRequestsRejected(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	_, csrf, _ := lookupSession(token)
+	createTestMinion(t, testDB, &Minion{Name: "Goblin", HP: 7, MaxHP: 7, AC: 13, Attack: 4})
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+	}{
+		{"create without token", "POST", "/c/default/minions", nil},
+		{"update without token", "PUT", "/c/default/minions/1", nil},
+		{"dismiss without token", "DELETE", "/c/default/minions/1", nil},
+		{"heal without token", "POST", "/c/default/minions/1/hp/heal", nil},
+		{"damage without token", "POST", "/c/default/minions/1/hp/dmg", nil},
+		{"wrong token", "POST", "/c/default/minions/1/hp/dmg", map[string]string{csrfHeader: strings.Repeat("0", 64)}},
+		{"valid token from another site", "POST", "/c/default/minions/1/hp/dmg", map[string]string{
+			csrfHeader: csrf, "Sec-Fetch-Site": "cross-site"}},
+		{"valid token from sibling subdomain", "DELETE", "/c/default/minions/1", map[string]string{
+			csrfHeader: csrf, "Sec-Fetch-Site": "same-site"}},
+		{"valid token with foreign Origin", "DELETE", "/c/default/minions/1", map[string]string{
+			csrfHeader: csrf, "Origin": "https://evil.example"}},
+		{"valid token with null Origin", "DELETE", "/c/default/minions/1", map[string]string{
+			csrfHeader: csrf, "Origin": "null"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"name": {"Forged"}, "hp": {"1"}, "max_hp": {"1"}, "ac": {"1"}, "attack": {"1"}, "amount": {"7"}}
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			routes().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("Expected 403, got %d", rec.Code)
+			}
+		})
+	}
+
+	m, _ := getMinion(defaultCampaignID, 1)
+	if m.Name != "Goblin" || m.HP != 7 || !m.Active {
+		t.Errorf("Expected minion untouched, got %+v", m)
+	}
+	var n int
+	testDB.QueryRow("SELECT COUNT(*) FROM minions").Scan(&n)
+	if n != 1 {
+		t.Errorf("Expected no forged minion to be created, got %d minions", n)
+	}
+}
+
+func TestCSRFAcceptsLegitimateRequests(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	_, csrf, _ := lookupSession(token)
+	createTestMinion(t, testDB, &Minion{Name: "Goblin", HP: 7, MaxHP: 7, AC: 13, Attack: 4})
+
+	// htmx request: header token, same-origin fetch metadata
+	req := httptest.NewRequest("POST", "/c/default/minions/1/hp/dmg", strings.NewReader("amount=2"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set(csrfHeader, csrf)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+	rec := httptest.NewRecorder()
+	routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected htmx request to pass, got %d", rec.Code)
+	}
+
+	// Plain form post: hidden field, no fetch metadata
+	form := url.Values{"csrf_token": {csrf}, "amount": {"2"}}
+	req = httptest.NewRequest("POST", "/c/default/minions/1/hp/dmg", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+	rec = httptest.NewRecorder()
+	routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected form post to pass, got %d", rec.Code)
+	}
+
+	if m, _ := getMinion(defaultCampaignID, 1); m.HP != 3 {
+		t.Errorf("Expected HP 3, got %d", m.HP)
+	}
+}
+
+func TestLoginRequiresCSRFCookie(t *testing.T) {
+	useTestDB(t)
+
+	// The login page hands out a double-submit cookie
+	rec := httptest.NewRecorder()
+	routes().ServeHTTP(rec, httptest.NewRequest("GET", "/login", nil))
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == csrfCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("Expected login page to set a CSRF cookie")
+	}
+
+	// A forged login that lacks the cookie is refused
+	form := url.Values{"username": {"attacker"}, "password": {"attackerpass"}, "csrf_token": {cookie.Value}}
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for login without CSRF cookie, got %d", rec.Code)
+	}
+	if n, _ := countUsers(); n != 0 {
+		t.Errorf("Expected no account to be created, got %d", n)
+	}
+}
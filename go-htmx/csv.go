@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// csvColumns is the column order written by the CSV export, and assumed
+// for uploads that have no header row.
+var csvColumns = []string{"name", "hp", "max_hp", "ac", "attack", "damage", "notes"}
+
+// csvAliases maps the headings spreadsheets tend to use onto csvColumns.
+var csvAliases = map[string]string{
+	"hit_points":   "max_hp",
+	"maxhp":        "max_hp",
+	"hp_max":       "max_hp",
+	"current_hp":   "hp",
+	"armor_class":  "ac",
+	"armour_class": "ac",
+	"to_hit":       "attack",
+	"attack_bonus": "attack",
+	"dmg":          "damage",
+}
+
+// csvRow is one data row of an upload, with the line it came from and
+// everything wrong with it.
+type csvRow struct {
+	Line   int
+	Minion Minion
+	Errors []string
+
+	missingHP bool // neither hp nor max_hp was given
+}
+
+// HasHP reports whether the row gave any hit points to preview.
+func (r csvRow) HasHP() bool {
+	return !r.missingHP
+}
+
+// csvImport is a parsed upload, ready to preview or commit.
+type csvImport struct {
+	Header  bool     // the first row named the columns
+	Columns []string // field each column was mapped to; "" when ignored
+	Ignored []string // headings that matched no field
+	Rows    []csvRow
+}
+
+// ErrorCount is the number of rows that cannot be imported.
+func (c *csvImport) ErrorCount() int {
+	n := 0
+	for _, row := range c.Rows {
+		if len(row.Errors) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func csvColumn(heading string) string {
+	key := strings.ToLower(strings.TrimSpace(heading))
+	key = strings.NewReplacer(" ", "_", "-", "_").Replace(key)
+	if alias, ok := csvAliases[key]; ok {
+		return alias
+	}
+	for _, c := range csvColumns {
+		if c == key {
+			return c
+		}
+	}
+	return ""
+}
+
+// parseMinionCSV reads an upload. A first row naming at least one known
+// column is taken as the header; otherwise columns are read in
+// csvColumns order. Blank rows are skipped.
+func parseMinionCSV(data []byte) (*csvImport, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // Excel's UTF-8 BOM
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	imp := &csvImport{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+
+		if imp.Columns == nil {
+			imp.Columns = csvColumns
+			if cols, ignored, ok := csvHeader(record); ok {
+				imp.Header, imp.Columns, imp.Ignored = true, cols, ignored
+				continue
+			}
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		imp.Rows = append(imp.Rows, csvRecord(line, imp.Columns, record))
+	}
+	if len(imp.Rows) == 0 {
+		return nil, errors.New("no minions found in the file")
+	}
+	return imp, nil
+}
+
+func csvHeader(record []string) (cols, ignored []string, ok bool) {
+	cols = make([]string, len(record))
+	for i, heading := range record {
+		cols[i] = csvColumn(heading)
+		if cols[i] != "" {
+			ok = true
+		} else if strings.TrimSpace(heading) != "" {
+			ignored = append(ignored, heading)
+		}
+	}
+	return cols, ignored, ok
+}
+
+// csvRecord maps one record onto a minion. A missing hp means full health
+// and a missing max_hp is taken from hp.
+func csvRecord(line int, cols, record []string) csvRow {
+	row := csvRow{Line: line}
+	m := &row.Minion
+	hp, maxHP := -1, -1
+
+	for i, value := range record {
+		if i >= len(cols) {
+			if strings.TrimSpace(value) != "" {
+				row.Errors = append(row.Errors, fmt.Sprintf("unexpected value %q in column %d", value, i+1))
+			}
+			continue
+		}
+		value = strings.TrimSpace(value)
+		number := func(dst *int) {
+			if value == "" {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimPrefix(value, "+"))
+			if err != nil {
+				row.Errors = append(row.Errors, fmt.Sprintf("%s: %q is not a whole number", cols[i], value))
+				return
+			}
+			if n < 0 && cols[i] != "attack" {
+				row.Errors = append(row.Errors, fmt.Sprintf("%s must not be negative", cols[i]))
+				return
+			}
+			*dst = n
+		}
+		switch cols[i] {
+		case "name":
+			m.Name = value
+		case "hp":
+			number(&hp)
+		case "max_hp":
+			number(&maxHP)
+		case "ac":
+			number(&m.AC)
+		case "attack":
+			number(&m.Attack)
+		case "damage":
+			m.Damage = value
+		case "notes":
+			m.Notes = value
+		}
+	}
+
+	switch {
+	case hp < 0 && maxHP < 0:
+		row.Errors = append(row.Errors, "hp or max_hp is required")
+		row.missingHP, hp, maxHP = true, 0, 0
+	case maxHP < 0:
+		maxHP = hp
+	case hp < 0:
+		hp = maxHP
+	}
+	m.HP, m.MaxHP = hp, maxHP
+
+	if m.Name == "" {
+		row.Errors = append(row.Errors, "name is required")
+	}
+	if maxHP >= 0 && hp > maxHP {
+		row.Errors = append(row.Errors, fmt.Sprintf("hp %d is more than max_hp %d", hp, maxHP))
+	}
+	return row
+}
+
+// importCSV adds every row of imp to the campaign in one transaction. It
+// refuses the whole file if any row is invalid.
+func importCSV(campaignID int64, imp *csvImport, ownerID int64) ([]*Minion, error) {
+	if n := imp.ErrorCount(); n > 0 {
+		return nil, validationError{fmt.Sprintf("%d row(s) have errors", n)}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	minions := make([]*Minion, 0, len(imp.Rows))
+	for _, row := range imp.Rows {
+		m := row.Minion
+		m.Active = true
+		m.OwnerID = ownerID
+		if err := insertMinion(tx, campaignID, &m); err != nil {
+			return nil, err
+		}
+		minions = append(minions, &m)
+	}
+	return minions, tx.Commit()
+}
+
+func handleCSVExport(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	minions, err := listActiveMinions(c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+c.Slug+`-minions.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write(csvColumns)
+	for _, m := range minions {
+		cw.Write([]string{
+			m.Name,
+			strconv.Itoa(m.HP),
+			strconv.Itoa(m.MaxHP),
+			strconv.Itoa(m.AC),
+			strconv.Itoa(m.Attack),
+			m.Damage,
+			m.Notes,
+		})
+	}
+	cw.Flush()
+}
+
+// handleCSVImport previews an upload by default and only writes it when
+// the form's action is "import". Either way it answers with the
+// csv-preview fragment so row errors can be fixed and re-uploaded.
+func handleCSVImport(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	data, err := readUpload(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	view := map[string]any{"Campaign": c}
+	imp, err := parseMinionCSV(data)
+	if err != nil {
+		view["Error"] = err.Error()
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		tmpl.ExecuteTemplate(w, "csv-preview", view)
+		return
+	}
+	view["Import"] = imp
+
+	if r.FormValue("action") != "import" {
+		tmpl.ExecuteTemplate(w, "csv-preview", view)
+		return
+	}
+
+	minions, err := importCSV(c.ID, imp, currentUser(r).ID)
+	var verr validationError
+	if errors.As(err, &verr) {
+		view["Error"] = "Nothing was imported: " + strings.Join(verr, "; ")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		tmpl.ExecuteTemplate(w, "csv-preview", view)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	if r.Header.Get("HX-Request") != "" {
+		w.Header().Set("HX-Refresh", "true")
+	}
+	view["Imported"] = len(minions)
+	tmpl.ExecuteTemplate(w, "csv-preview", view)
+}
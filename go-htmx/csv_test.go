@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMinionCSVHeader(t *testing.T) {
+	data := "\xef\xbb\xbfName,Max HP,Armor Class,To Hit,Damage,Source\n" +
+		"Goblin,7,15,+4,1d6+2,MM p166\n" +
+		"\n" +
+		"Wolf,11,13,4,2d4+2,\n"
+
+	imp, err := parseMinionCSV([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !imp.Header {
+		t.Error("Expected header row to be detected")
+	}
+	if len(imp.Ignored) != 1 || imp.Ignored[0] != "Source" {
+		t.Errorf("Expected Source to be ignored, got %v", imp.Ignored)
+	}
+	if len(imp.Rows) != 2 || imp.ErrorCount() != 0 {
+		t.Fatalf("Expected 2 clean rows, got %+v", imp.Rows)
+	}
+	want := Minion{Name: "Goblin", HP: 7, MaxHP: 7, AC: 15, Attack: 4, Damage: "1d6+2"}
+	if got := imp.Rows[0].Minion; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+	if imp.Rows[1].Line != 4 {
+		t.Errorf("Expected the wolf on line 4, got %d", imp.Rows[1].Line)
+	}
+}
+
+func TestParseMinionCSVNoHeader(t *testing.T) {
+	imp, err := parseMinionCSV([]byte("Skeleton,9,13,13,4,1d6+2,\"Vulnerable, bludgeoning\"\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if imp.Header {
+		t.Error("Expected no header row")
+	}
+	m := imp.Rows[0].Minion
+	if m.Name != "Skeleton" || m.HP != 9 || m.MaxHP != 13 || m.AC != 13 || m.Notes != "Vulnerable, bludgeoning" {
+		t.Errorf("Unexpected minion %+v", m)
+	}
+}
+
+func TestParseMinionCSVRowErrors(t *testing.T) {
+	data := "name,hp,max_hp,ac\n" +
+		",5,5,10\n" +
+		"Zombie,30,22,8\n" +
+		"Ghoul,lots,,12\n" +
+		"Shade,,,-1\n" +
+		"Rat,1,1,10\n"
+
+	imp, err := parseMinionCSV([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if imp.ErrorCount() != 4 {
+		t.Fatalf("Expected 4 bad rows, got %d: %+v", imp.ErrorCount(), imp.Rows)
+	}
+	for i, want := range []string{"name is required", "more than max_hp", "not a whole number", "ac must not be negative"} {
+		if got := strings.Join(imp.Rows[i].Errors, "; "); !contains(got, want) {
+			t.Errorf("Row %d: expected %q in %q", i, want, got)
+		}
+	}
+	if len(imp.Rows[4].Errors) != 0 {
+		t.Errorf("Expected the rat to be fine, got %v", imp.Rows[4].Errors)
+	}
+
+	if _, err := parseMinionCSV([]byte("name,hp\n")); err == nil {
+		t.Error("Expected a header-only file to be rejected")
+	}
+}
+
+func TestImportCSVAllOrNothing(t *testing.T) {
+	useTestDB(t)
+
+	imp, _ := parseMinionCSV([]byte("name,hp\nGoblin,7\nBroken,\n"))
+	if _, err := importCSV(defaultCampaignID, imp, 0); err == nil {
+		t.Fatal("Expected import with a bad row to fail")
+	}
+	if all, _ := listAllMinions(defaultCampaignID); len(all) != 0 {
+		t.Errorf("Expected nothing imported, got %d minions", len(all))
+	}
+
+	imp, _ = parseMinionCSV([]byte("name,hp\nGoblin,7\nWolf,11\n"))
+	minions, err := importCSV(defaultCampaignID, imp, 0)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if active, _ := listActiveMinions(defaultCampaignID); len(active) != 2 || len(minions) != 2 {
+		t.Errorf("Expected 2 active minions, got %d", len(active))
+	}
+}
+
+func postCSV(t *testing.T, token, action, data string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("action", action)
+	fw, _ := mw.CreateFormFile("file", "prep.csv")
+	fw.Write([]byte(data))
+	mw.Close()
+
+	_, csrf, _ := lookupSession(token)
+	req := httptest.NewRequest("POST", "/c/default/minions.csv", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set(csrfHeader, csrf)
+	req.Header.Set("HX-Request", "true")
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+	rec := httptest.NewRecorder()
+	routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandleCSVImport(t *testing.T) {
+	useTestDB(t)
+	_, gm := createTestUser(t, "gm", roleGM)
+	_, player := createTestUser(t, "pc", rolePlayer)
+	data := "name,hp,ac\nGoblin,7,15\nOrc,15,13\n"
+
+	if rec := postCSV(t, player, "import", data); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for player, got %d", rec.Code)
+	}
+
+	rec := postCSV(t, gm, "preview", data)
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), "Orc") {
+		t.Fatalf("Expected preview listing the rows, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if all, _ := listAllMinions(defaultCampaignID); len(all) != 0 {
+		t.Errorf("Expected preview to write nothing, got %d minions", len(all))
+	}
+
+	rec = postCSV(t, gm, "preview", "name,hp,attack\nKobold,5,-1\nShade,,2\n")
+	if body := rec.Body.String(); !contains(body, "<td>-1</td>") || contains(body, "+-1") ||
+		!contains(body, "<td>—</td>") || contains(body, "-1/-1") {
+		t.Errorf("Expected a signed attack and a dash for missing HP, got %s", body)
+	}
+
+	rec = postCSV(t, gm, "import", "name,hp\nGoblin,7\n,3\n")
+	if rec.Code != http.StatusUnprocessableEntity || !contains(rec.Body.String(), "name is required") {
+		t.Errorf("Expected 422 with row errors, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = postCSV(t, gm, "import", data)
+	if rec.Code != http.StatusOK || rec.Header().Get("HX-Refresh") != "true" {
+		t.Fatalf("Expected import to succeed and refresh, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if active, _ := listActiveMinions(defaultCampaignID); len(active) != 2 {
+		t.Errorf("Expected 2 imported minions, got %d", len(active))
+	}
+}
+
+func TestHandleCSVExport(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "pc", rolePlayer)
+	createTestMinion(t, testDB, &Minion{Name: "Goblin, Boss", HP: 15, MaxHP: 21, AC: 17, Attack: 4, Damage: "1d6+2", Notes: "Redirect Attack"})
+
+	rec := serveAs(t, token, "GET", "/c/default/minions.csv", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Export is not valid CSV: %v", err)
+	}
+	if len(records) != 2 || strings.Join(records[0], ",") != "name,hp,max_hp,ac,attack,damage,notes" {
+		t.Fatalf("Unexpected export %v", records)
+	}
+
+	// The export reads back unchanged
+	var buf bytes.Buffer
+	csv.NewWriter(&buf).WriteAll(records)
+	imp, err := parseMinionCSV(buf.Bytes())
+	if err != nil || imp.Rows[0].Minion.Name != "Goblin, Boss" || imp.Rows[0].Minion.HP != 15 {
+		t.Errorf("Round trip failed: %+v (%v)", imp, err)
+	}
+}
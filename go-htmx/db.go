@@ -2,60 +2,353 @@ package main
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
 
 	_ "modernc.org/sqlite"
 )
 
 var db *sql.DB
 
+// migrations are applied in order; PRAGMA user_version records how many
+// have run, so existing databases pick up only the new ones.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS minions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		hp INTEGER NOT NULL,
+		max_hp INTEGER NOT NULL,
+		ac INTEGER NOT NULL,
+		attack INTEGER NOT NULL,
+		damage TEXT NOT NULL DEFAULT '',
+		notes TEXT NOT NULL DEFAULT '',
+		active INTEGER NOT NULL DEFAULT 1
+	)`,
+	`CREATE TABLE users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		role TEXT NOT NULL DEFAULT 'player'
+	);
+	CREATE TABLE sessions (
+		token TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		expires_at INTEGER NOT NULL
+	);
+	ALTER TABLE minions ADD COLUMN owner_id INTEGER NOT NULL DEFAULT 0;`,
+	`DELETE FROM sessions;
+	ALTER TABLE sessions ADD COLUMN csrf_token TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE campaigns (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		slug TEXT NOT NULL UNIQUE,
+		name TEXT NOT NULL
+	);
+	INSERT INTO campaigns (id, slug, name) VALUES (1, 'default', 'Default campaign');
+	CREATE TABLE campaign_members (
+		campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		role TEXT NOT NULL,
+		PRIMARY KEY (campaign_id, user_id)
+	);
+	INSERT INTO campaign_members (campaign_id, user_id, role) SELECT 1, id, role FROM users;
+	CREATE TABLE campaign_invites (
+		token TEXT PRIMARY KEY,
+		campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+		role TEXT NOT NULL,
+		expires_at INTEGER NOT NULL
+	);
+	ALTER TABLE minions ADD COLUMN campaign_id INTEGER NOT NULL DEFAULT 1;
+	CREATE INDEX minions_campaign ON minions (campaign_id, active);`,
+	`ALTER TABLE minions ADD COLUMN bestiary INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE minions ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+	`ALTER TABLE minions ADD COLUMN initiative INTEGER;`,
+	`CREATE TABLE tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+		name TEXT NOT NULL COLLATE NOCASE,
+		UNIQUE (campaign_id, name)
+	);
+	CREATE TABLE minion_tags (
+		minion_id INTEGER NOT NULL REFERENCES minions(id) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+		PRIMARY KEY (minion_id, tag_id)
+	);
+	CREATE INDEX minion_tags_tag ON minion_tags (tag_id);`,
+	`ALTER TABLE minions ADD COLUMN members TEXT;`,
+	`ALTER TABLE minions ADD COLUMN death_policy TEXT NOT NULL DEFAULT 'dies';
+	ALTER TABLE minions ADD COLUMN death_successes INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE minions ADD COLUMN death_failures INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE minions ADD COLUMN died_at INTEGER;
+	CREATE TABLE minion_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+		minion_id INTEGER NOT NULL REFERENCES minions(id) ON DELETE CASCADE,
+		at INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		amount INTEGER NOT NULL DEFAULT 0,
+		detail TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX minion_events_minion ON minion_events (minion_id, id);`,
+	`ALTER TABLE minions ADD COLUMN str_score INTEGER NOT NULL DEFAULT 10;
+	ALTER TABLE minions ADD COLUMN dex_score INTEGER NOT NULL DEFAULT 10;
+	ALTER TABLE minions ADD COLUMN con_score INTEGER NOT NULL DEFAULT 10;
+	ALTER TABLE minions ADD COLUMN int_score INTEGER NOT NULL DEFAULT 10;
+	ALTER TABLE minions ADD COLUMN wis_score INTEGER NOT NULL DEFAULT 10;
+	ALTER TABLE minions ADD COLUMN cha_score INTEGER NOT NULL DEFAULT 10;
+	ALTER TABLE minions ADD COLUMN saves TEXT NOT NULL DEFAULT '';
+	ALTER TABLE minions ADD COLUMN prof_bonus INTEGER NOT NULL DEFAULT 2;`,
+	`CREATE TABLE attacks (
+		id INTEGER PRIMARY KEY,
+		minion_id INTEGER NOT NULL REFERENCES minions(id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		to_hit INTEGER NOT NULL DEFAULT 0,
+		damage TEXT NOT NULL DEFAULT '',
+		reach TEXT NOT NULL DEFAULT '',
+		damage_type TEXT NOT NULL DEFAULT '',
+		uses INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX attacks_minion ON attacks (minion_id, position);`,
+	`ALTER TABLE minions ADD COLUMN concentration TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE resources (
+		id INTEGER PRIMARY KEY,
+		minion_id INTEGER NOT NULL REFERENCES minions(id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		max INTEGER NOT NULL,
+		current INTEGER NOT NULL,
+		reset TEXT NOT NULL,
+		recharge INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX resources_minion ON resources (minion_id, position);
+	ALTER TABLE campaigns ADD COLUMN round INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE campaigns ADD COLUMN turn_id INTEGER;
+	ALTER TABLE campaigns ADD COLUMN turn_initiative INTEGER;`,
+	`ALTER TABLE resources ADD COLUMN level INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE resources ADD COLUMN regain TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE minions ADD COLUMN cr TEXT NOT NULL DEFAULT '';
+	ALTER TABLE minions ADD COLUMN xp INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE campaigns ADD COLUMN party TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE loot (
+		id INTEGER PRIMARY KEY,
+		minion_id INTEGER NOT NULL REFERENCES minions(id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		quantity INTEGER NOT NULL,
+		coins INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX loot_minion ON loot (minion_id, position);
+	CREATE TABLE awards (
+		id INTEGER PRIMARY KEY,
+		campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+		encounter INTEGER NOT NULL,
+		minion_id INTEGER REFERENCES minions(id) ON DELETE SET NULL,
+		name TEXT NOT NULL,
+		xp INTEGER NOT NULL,
+		loot TEXT NOT NULL DEFAULT '[]',
+		at INTEGER NOT NULL
+	);
+	CREATE INDEX awards_encounter ON awards (campaign_id, encounter);
+	ALTER TABLE minions ADD COLUMN awarded INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE campaigns ADD COLUMN encounter INTEGER NOT NULL DEFAULT 1;`,
+	`ALTER TABLE campaigns ADD COLUMN turn_started INTEGER;
+	ALTER TABLE campaigns ADD COLUMN turn_limit INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE turn_times (
+		id INTEGER PRIMARY KEY,
+		campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+		encounter INTEGER NOT NULL,
+		minion_id INTEGER REFERENCES minions(id) ON DELETE SET NULL,
+		name TEXT NOT NULL,
+		round INTEGER NOT NULL,
+		started INTEGER NOT NULL,
+		seconds INTEGER NOT NULL
+	);
+	CREATE INDEX turn_times_encounter ON turn_times (campaign_id, encounter);`,
+	`ALTER TABLE minions ADD COLUMN kind TEXT NOT NULL DEFAULT 'minion';`,
+}
+
 func initDB(path string) {
 	var err error
-	db, err = sql.Open("sqlite", path)
+	db, err = openDB(path)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err := migrate(db); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// openDB opens the SQLite database at path without migrating it.
+func openDB(path string) (*sql.DB, error) {
+	return sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+}
 
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS minions (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			hp INTEGER NOT NULL,
-			max_hp INTEGER NOT NULL,
-			ac INTEGER NOT NULL,
-			attack INTEGER NOT NULL,
-			damage TEXT NOT NULL DEFAULT '',
-			notes TEXT NOT NULL DEFAULT '',
-			active INTEGER NOT NULL DEFAULT 1
-		)
-	`)
+func schemaVersion(d *sql.DB) (int, error) {
+	var version int
+	err := d.QueryRow(`PRAGMA user_version`).Scan(&version)
+	return version, err
+}
+
+// migrate brings the schema of d up to date.
+func migrate(d *sql.DB) error {
+	version, err := schemaVersion(d)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := d.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// minionSelect reads minions together with their campaign slug, which
+// the templates need to build URLs, their tags joined by tagSep and their
+// attacks, resources and loot as JSON arrays.
+const minionSelect = `SELECT m.id, m.name, m.hp, m.max_hp, m.ac, m.attack, m.damage, m.notes, m.active, m.owner_id,
+	m.bestiary, m.version, m.initiative, m.members,
+	m.death_policy, m.death_successes, m.death_failures, m.died_at IS NOT NULL,
+	m.str_score, m.dex_score, m.con_score, m.int_score, m.wis_score, m.cha_score, m.saves, m.prof_bonus,
+	m.concentration, m.cr, m.xp, m.kind, m.campaign_id, c.slug,
+	(SELECT group_concat(name, ',') FROM (SELECT t.name FROM minion_tags mt JOIN tags t ON t.id = mt.tag_id
+		WHERE mt.minion_id = m.id ORDER BY t.name COLLATE NOCASE)),
+	(SELECT json_group_array(json_object('name', name, 'to_hit', to_hit, 'damage', damage, 'reach', reach,
+		'damage_type', damage_type, 'uses', uses)) FROM (SELECT * FROM attacks WHERE minion_id = m.id ORDER BY position)),
+	(SELECT json_group_array(json_object('id', id, 'name', name, 'max', max, 'current', current, 'reset', reset,
+		'recharge', recharge, 'level', level, 'regain', regain)) FROM (SELECT * FROM resources WHERE minion_id = m.id ORDER BY position)),
+	` + lootSelect + `
+	FROM minions m JOIN campaigns c ON c.id = m.campaign_id`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMinion(s scanner, m *Minion) error {
+	var tags, members sql.NullString
+	var saves, attacks, resources, loot string
+	sc := &m.Scores
+	err := s.Scan(&m.ID, &m.Name, &m.HP, &m.MaxHP, &m.AC, &m.Attack, &m.Damage, &m.Notes, &m.Active, &m.OwnerID,
+		&m.Bestiary, &m.Version, &m.Initiative, &members,
+		&m.DeathPolicy, &m.DeathSuccesses, &m.DeathFailures, &m.Dead,
+		&sc[0], &sc[1], &sc[2], &sc[3], &sc[4], &sc[5], &saves, &m.ProfBonus,
+		&m.Concentration, &m.CR, &m.XP, &m.Kind, &m.CampaignID, &m.Campaign, &tags, &attacks, &resources, &loot)
+	if err != nil {
+		return err
+	}
+	m.Saves = parseSaves(saves)
+	if m.Attacks, err = parseAttacks(attacks); err != nil {
+		return err
+	}
+	if m.Resources, err = parseResources(resources); err != nil {
+		return err
 	}
+	if m.Loot, err = parseLootJSON(loot); err != nil {
+		return err
+	}
+	m.Tags = nil
+	if tags.Valid {
+		m.Tags = strings.Split(tags.String, tagSep)
+	}
+	m.Members = parseMembers(members)
+	return err
 }
 
-func createMinion(m *Minion) error {
-	res, err := db.Exec(
-		`INSERT INTO minions (name, hp, max_hp, ac, attack, damage, notes, active)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, 1)`,
-		m.Name, m.HP, m.MaxHP, m.AC, m.Attack, m.Damage, m.Notes,
+// Every query below is scoped to a campaign; a minion id from another
+// campaign behaves exactly like one that does not exist.
+
+// querier is satisfied by both *sql.DB and *sql.Tx, so storage helpers can
+// run standalone or as part of a larger transaction.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// createMinion spawns m into a campaign, or files it in the campaign's
+// bestiary when m.Bestiary is set.
+func createMinion(campaignID int64, m *Minion) error {
+	m.Active = !m.Bestiary
+	return insertMinion(db, campaignID, m)
+}
+
+// insertMinion stores m exactly as given, Active included, and fills in
+// its id and campaign. Unset ability scores, proficiency bonus, death
+// policy and kind get their defaults.
+func insertMinion(q querier, campaignID int64, m *Minion) error {
+	if m.DeathPolicy == "" {
+		m.DeathPolicy = deathDies
+	}
+	if m.Kind == "" {
+		m.Kind = kindMinion
+	}
+	for i, score := range m.Scores {
+		if score == 0 {
+			m.Scores[i] = defaultScore
+		}
+	}
+	if m.ProfBonus == 0 {
+		m.ProfBonus = defaultProfBonus
+	}
+	m.Saves = normalizeSaves(m.Saves)
+	if m.XP == 0 {
+		m.XP = crXP[m.CR]
+	}
+	sc := m.Scores
+	res, err := q.Exec(
+		`INSERT INTO minions (campaign_id, name, hp, max_hp, ac, attack, damage, notes, active, owner_id, bestiary, initiative, members,
+		 death_policy, str_score, dex_score, con_score, int_score, wis_score, cha_score, saves, prof_bonus, concentration, cr, xp, kind)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		campaignID, m.Name, m.HP, m.MaxHP, m.AC, m.Attack, m.Damage, m.Notes, m.Active, m.OwnerID, m.Bestiary, m.Initiative,
+		encodeMembers(m.Members), m.DeathPolicy, sc[0], sc[1], sc[2], sc[3], sc[4], sc[5],
+		strings.Join(m.Saves, ","), m.ProfBonus, m.Concentration, m.CR, m.XP, m.Kind,
 	)
 	if err != nil {
 		return err
 	}
 	m.ID, _ = res.LastInsertId()
-	return nil
+	m.Version = 1
+	m.CampaignID = campaignID
+	if err := setMinionTags(q, campaignID, m.ID, m.Tags); err != nil {
+		return err
+	}
+	if err := setMinionAttacks(q, m.ID, m.Attacks); err != nil {
+		return err
+	}
+	if err := setMinionResources(q, m.ID, m.Resources); err != nil {
+		return err
+	}
+	if err := setMinionLoot(q, m.ID, m.Loot); err != nil {
+		return err
+	}
+	return q.QueryRow(`SELECT slug FROM campaigns WHERE id = ?`, campaignID).Scan(&m.Campaign)
 }
 
-func getMinion(id int64) (*Minion, error) {
+func getMinion(campaignID, id int64) (*Minion, error) {
 	m := &Minion{}
-	err := db.QueryRow(`SELECT id, name, hp, max_hp, ac, attack, damage, notes, active FROM minions WHERE id = ?`, id).
-		Scan(&m.ID, &m.Name, &m.HP, &m.MaxHP, &m.AC, &m.Attack, &m.Damage, &m.Notes, &m.Active)
+	err := scanMinion(db.QueryRow(minionSelect+` WHERE m.campaign_id = ? AND m.id = ?`, campaignID, id), m)
 	return m, err
 }
 
-func listActiveMinions() ([]Minion, error) {
-	rows, err := db.Query(`SELECT id, name, hp, max_hp, ac, attack, damage, notes, active FROM minions WHERE active = 1 ORDER BY id`)
+// listActiveMinions lists the minions in play; PCs and allies are not
+// minions.
+func listActiveMinions(campaignID int64) ([]Minion, error) {
+	rows, err := db.Query(minionSelect+` WHERE m.campaign_id = ? AND m.active = 1 AND m.kind = ? ORDER BY m.id`,
+		campaignID, kindMinion)
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +357,7 @@ func listActiveMinions() ([]Minion, error) {
 	var minions []Minion
 	for rows.Next() {
 		var m Minion
-		if err := rows.Scan(&m.ID, &m.Name, &m.HP, &m.MaxHP, &m.AC, &m.Attack, &m.Damage, &m.Notes, &m.Active); err != nil {
+		if err := scanMinion(rows, &m); err != nil {
 			return nil, err
 		}
 		minions = append(minions, m)
@@ -72,23 +365,142 @@ func listActiveMinions() ([]Minion, error) {
 	return minions, rows.Err()
 }
 
-func updateMinion(m *Minion) error {
-	_, err := db.Exec(
-		`UPDATE minions SET name=?, hp=?, max_hp=?, ac=?, attack=?, damage=?, notes=?, active=? WHERE id=?`,
-		m.Name, m.HP, m.MaxHP, m.AC, m.Attack, m.Damage, m.Notes, m.Active, m.ID,
-	)
-	return err
+// expectRow turns an UPDATE that matched nothing into sql.ErrNoRows.
+func expectRow(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-func deleteMinion(id int64) error {
-	_, err := db.Exec(`UPDATE minions SET active = 0 WHERE id = ?`, id)
-	return err
+// errConflict reports an edit based on a version of the minion that has
+// since been changed.
+var errConflict = errors.New("minion was changed by someone else")
+
+// updateMinion writes m, tags included, over the stored minion and bumps
+// its version. A mob's HP belongs to its members, so edits leave it alone;
+// giving anyone else HP brings them back from death. An empty DeathPolicy
+// or CR, zero ability scores, proficiency bonus or XP, and nil Saves,
+// Attacks, Resources or Loot keep what is stored. When m.Version is set the
+// write only happens if the stored version still matches, and errConflict
+// is returned otherwise; a zero Version writes unconditionally.
+func updateMinion(campaignID int64, m *Minion) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE minions SET name=?,
+		 hp=CASE WHEN members IS NULL THEN ? ELSE hp END, max_hp=CASE WHEN members IS NULL THEN ? ELSE max_hp END,
+		 died_at=CASE WHEN members IS NULL AND ? > 0 THEN NULL ELSE died_at END,
+		 death_successes=CASE WHEN members IS NULL AND ? > 0 THEN 0 ELSE death_successes END,
+		 death_failures=CASE WHEN members IS NULL AND ? > 0 THEN 0 ELSE death_failures END,
+		 death_policy=COALESCE(NULLIF(?, ''), death_policy), ac=?, attack=?, damage=?, notes=?, active=?, initiative=?,
+		 str_score=COALESCE(NULLIF(?, 0), str_score), dex_score=COALESCE(NULLIF(?, 0), dex_score),
+		 con_score=COALESCE(NULLIF(?, 0), con_score), int_score=COALESCE(NULLIF(?, 0), int_score),
+		 wis_score=COALESCE(NULLIF(?, 0), wis_score), cha_score=COALESCE(NULLIF(?, 0), cha_score),
+		 saves=COALESCE(?, saves), prof_bonus=COALESCE(NULLIF(?, 0), prof_bonus),
+		 cr=COALESCE(NULLIF(?, ''), cr), xp=COALESCE(NULLIF(?, 0), xp),
+		 version=version+1 WHERE campaign_id=? AND id=?`
+	var saves any
+	if m.Saves != nil {
+		saves = strings.Join(normalizeSaves(m.Saves), ",")
+	}
+	sc := m.Scores
+	args := []any{m.Name, m.HP, m.MaxHP, m.HP, m.HP, m.HP, m.DeathPolicy,
+		m.AC, m.Attack, m.Damage, m.Notes, m.Active, m.Initiative,
+		sc[0], sc[1], sc[2], sc[3], sc[4], sc[5], saves, m.ProfBonus, m.CR, m.XP, campaignID, m.ID}
+	if m.Version != 0 {
+		query += ` AND version=?`
+		args = append(args, m.Version)
+	}
+	err = expectRow(tx.Exec(query, args...))
+	if errors.Is(err, sql.ErrNoRows) && m.Version != 0 {
+		var exists bool
+		tx.QueryRow(`SELECT 1 FROM minions WHERE campaign_id = ? AND id = ?`, campaignID, m.ID).Scan(&exists)
+		if exists {
+			return errConflict
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := setMinionTags(tx, campaignID, m.ID, m.Tags); err != nil {
+		return err
+	}
+	if m.Attacks != nil {
+		if err := setMinionAttacks(tx, m.ID, m.Attacks); err != nil {
+			return err
+		}
+	}
+	if m.Resources != nil {
+		if err := setMinionResources(tx, m.ID, m.Resources); err != nil {
+			return err
+		}
+	}
+	if m.Loot != nil {
+		if err := setMinionLoot(tx, m.ID, m.Loot); err != nil {
+			return err
+		}
+	}
+	if err := tx.QueryRow(`SELECT version FROM minions WHERE id = ?`, m.ID).Scan(&m.Version); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func adjustHP(id int64, delta int) (*Minion, error) {
-	_, err := db.Exec(`UPDATE minions SET hp = MAX(0, MIN(hp + ?, max_hp)) WHERE id = ?`, delta, id)
+// deleteMinion dismisses a minion, crediting it to the ledger when it was
+// defeated. PCs and allies are removed with removeCombatant instead.
+func deleteMinion(campaignID, id int64, defeated bool) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer tx.Rollback()
+	if err := dismissMinion(tx, campaignID, id, "", defeated); err != nil {
+		return err
 	}
-	return getMinion(id)
+	return tx.Commit()
+}
+
+// dismissMinion takes a minion out of play and logs it in the minion's
+// history with detail saying why. Every way of dismissing goes through it.
+// Only a defeated minion is credited to the ledger: one that fled or was
+// never fought earns nothing, and one that died was credited when it died.
+func dismissMinion(q querier, campaignID, id int64, detail string, defeated bool) error {
+	var kind string
+	if err := q.QueryRow(`SELECT kind FROM minions WHERE campaign_id = ? AND id = ?`, campaignID, id).Scan(&kind); err != nil {
+		return err
+	}
+	if kind != kindMinion {
+		return errNotMinion
+	}
+	err := expectRow(q.Exec(`UPDATE minions SET active = 0, version = version + 1 WHERE campaign_id = ? AND id = ?`,
+		campaignID, id))
+	if err != nil {
+		return err
+	}
+	if defeated {
+		detail = strings.TrimPrefix(detail+", defeated", ", ")
+	}
+	if err := logEvent(q, campaignID, id, minionEvent{Kind: eventDismissed, Detail: detail}); err != nil {
+		return err
+	}
+	if defeated {
+		return creditDefeat(q, campaignID, id)
+	}
+	return nil
+}
+
+// adjustHP applies a relative change, so it never conflicts with other
+// writers; it still bumps the version so open edit forms notice. Mobs
+// spread the change across their members.
+func adjustHP(campaignID, id int64, delta int) (*Minion, error) {
+	return adjustMemberHP(campaignID, id, anyMember, delta)
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"testing"
 )
 
@@ -39,7 +41,7 @@ func TestCreateMinion(t *testing.T) {
 		Notes:  "Test notes",
 	}
 
-	err := createMinion(m)
+	err := createMinion(defaultCampaignID, m)
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
 	}
@@ -82,7 +84,7 @@ func TestGetMinion(t *testing.T) {
 	id := createTestMinion(t, testDB, expected)
 
 	// Get minion
-	result, err := getMinion(id)
+	result, err := getMinion(defaultCampaignID, id)
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
 	}
@@ -126,7 +128,7 @@ func TestGetMinionNotFound(t *testing.T) {
 	defer func() { db = originalDB }()
 
 	// Try to get non-existent minion
-	_, err := getMinion(999)
+	_, err := getMinion(defaultCampaignID, 999)
 	if err == nil {
 		t.Error("Expected error for non-existent minion, got nil")
 	}
@@ -154,7 +156,7 @@ func TestListActiveMinions(t *testing.T) {
 	}
 
 	// List active minions
-	minions, err := listActiveMinions()
+	minions, err := listActiveMinions(defaultCampaignID)
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
 	}
@@ -197,13 +199,13 @@ func TestUpdateMinion(t *testing.T) {
 		Active: true,
 	}
 
-	err := updateMinion(updated)
+	err := updateMinion(defaultCampaignID, updated)
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
 	}
 
 	// Verify update
-	result, err := getMinion(id)
+	result, err := getMinion(defaultCampaignID, id)
 	if err != nil {
 		t.Fatalf("Failed to retrieve updated minion: %v", err)
 	}
@@ -232,13 +234,13 @@ func TestDeleteMinion(t *testing.T) {
 	id := createTestMinion(t, testDB, m)
 
 	// Delete minion
-	err := deleteMinion(id)
+	err := deleteMinion(defaultCampaignID, id, false)
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
 	}
 
 	// Verify not in active list
-	minions, err := listActiveMinions()
+	minions, err := listActiveMinions(defaultCampaignID)
 	if err != nil {
 		t.Fatalf("Failed to list active minions: %v", err)
 	}
@@ -291,7 +293,7 @@ func TestAdjustHP(t *testing.T) {
 			id := createTestMinion(t, testDB, m)
 
 			// Adjust HP
-			result, err := adjustHP(id, tt.delta)
+			result, err := adjustHP(defaultCampaignID, id, tt.delta)
 			if err != nil {
 				t.Fatalf("Expected no error, got: %v", err)
 			}
@@ -309,3 +311,46 @@ func TestAdjustHP(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateMinionVersion(t *testing.T) {
+	testDB := useTestDB(t)
+	id := createTestMinion(t, testDB, &Minion{Name: "Orc", HP: 15, MaxHP: 15, AC: 13})
+
+	m, _ := getMinion(defaultCampaignID, id)
+	if m.Version != 1 {
+		t.Fatalf("Expected new minion at version 1, got %d", m.Version)
+	}
+
+	// Another writer saves first
+	theirs := *m
+	theirs.Name = "Orc Captain"
+	if err := updateMinion(defaultCampaignID, &theirs); err != nil {
+		t.Fatalf("First update failed: %v", err)
+	}
+	if theirs.Version != 2 {
+		t.Errorf("Expected update to bump the version to 2, got %d", theirs.Version)
+	}
+
+	mine := *m
+	mine.AC = 16
+	if err := updateMinion(defaultCampaignID, &mine); !errors.Is(err, errConflict) {
+		t.Fatalf("Expected errConflict for stale version, got %v", err)
+	}
+	if got, _ := getMinion(defaultCampaignID, id); got.Name != "Orc Captain" || got.AC != 13 {
+		t.Errorf("Expected the stale write to change nothing, got %+v", got)
+	}
+
+	// HP deltas never conflict but do bump the version
+	if got, err := adjustHP(defaultCampaignID, id, -5); err != nil || got.Version != 3 || got.HP != 10 {
+		t.Errorf("Expected HP 10 at version 3, got %+v (%v)", got, err)
+	}
+	theirs.HP = 15
+	if err := updateMinion(defaultCampaignID, &theirs); !errors.Is(err, errConflict) {
+		t.Errorf("Expected an edit made before the damage to conflict, got %v", err)
+	}
+
+	missing := &Minion{ID: 999, Name: "Ghost", Version: 1}
+	if err := updateMinion(defaultCampaignID, missing); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows for a missing minion, got %v", err)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Death policies say what happens to a minion at 0 HP.
+const (
+	deathDies        = "dies"        // dead at 0 HP
+	deathUnconscious = "unconscious" // falls unconscious and makes death saves
+	deathMinion      = "minion"      // any hit kills outright
+)
+
+// deathPolicies lists the policies in the order the edit form offers them.
+var deathPolicies = []string{deathDies, deathUnconscious, deathMinion}
+
+func validDeathPolicy(p string) bool {
+	for _, known := range deathPolicies {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Down reports whether m is at 0 HP but not dead: unconscious or stable.
+func (m Minion) Down() bool {
+	return m.HP == 0 && !m.Dead && !m.IsMob()
+}
+
+// Stable reports whether a downed minion has made its three death saves.
+func (m Minion) Stable() bool {
+	return m.Down() && m.DeathSuccesses >= 3
+}
+
+// lifeState is the part of a single minion that HP changes act on.
+type lifeState struct {
+	HP, MaxHP           int
+	Policy              string
+	Successes, Failures int
+	Dead                bool
+}
+
+// applyHPChange works out the result of damage (negative delta) or healing
+// under s.Policy, and the history events it produces. The dead take no
+// further damage or healing; bringing one back takes an edit.
+func applyHPChange(s lifeState, delta int) (lifeState, []minionEvent) {
+	if s.Dead || delta == 0 {
+		return s, nil
+	}
+	var events []minionEvent
+
+	if delta > 0 {
+		heal := min(delta, s.MaxHP-s.HP)
+		if heal <= 0 {
+			return s, nil
+		}
+		if s.HP == 0 {
+			events = append(events, minionEvent{Kind: eventRevived})
+			s.Successes, s.Failures = 0, 0
+		}
+		s.HP += heal
+		return s, append(events, minionEvent{Kind: eventHeal, Amount: heal})
+	}
+
+	damage := -delta
+	if s.HP == 0 {
+		events = append(events, minionEvent{Kind: eventDamage, Amount: damage, Detail: "while down"})
+		if s.Policy != deathUnconscious {
+			s.Dead = true
+			return s, append(events, minionEvent{Kind: eventDied, Amount: damage})
+		}
+		// Unconscious, so the death-save rules apply: each hit is a failed
+		// save, and one as big as max HP is fatal.
+		s.Successes = 0
+		s.Failures++
+		if damage >= s.MaxHP || s.Failures >= 3 {
+			s.Dead = true
+			events = append(events, minionEvent{Kind: eventDied, Amount: damage, Detail: "while down"})
+		}
+		return s, events
+	}
+
+	overkill := damage - s.HP
+	if s.Policy == deathMinion {
+		overkill = max(0, overkill)
+		events = append(events, minionEvent{Kind: eventDamage, Amount: damage})
+		s.HP, s.Dead = 0, true
+		return s, append(events, minionEvent{Kind: eventDied, Amount: overkill, Detail: "minion rule"})
+	}
+	s.HP = max(0, s.HP-damage)
+	events = append(events, minionEvent{Kind: eventDamage, Amount: damage})
+	if s.HP > 0 {
+		return s, events
+	}
+
+	switch {
+	case s.Policy != deathUnconscious:
+		s.Dead = true
+		events = append(events, minionEvent{Kind: eventDied, Amount: overkill})
+	case overkill >= s.MaxHP:
+		s.Dead = true
+		events = append(events, minionEvent{Kind: eventDied, Amount: overkill, Detail: "massive damage"})
+	default:
+		s.Successes, s.Failures = 0, 0
+		events = append(events, minionEvent{Kind: eventDown, Amount: overkill})
+	}
+	return s, events
+}
+
+// applyDeathSave records a d20 death save for a downed minion: 10 or more
+// succeeds, a 1 counts twice and a 20 brings it back with 1 HP.
+func applyDeathSave(s lifeState, roll int) (lifeState, []minionEvent) {
+	detail := strconv.Itoa(roll)
+	switch {
+	case roll == 20:
+		s.HP, s.Successes, s.Failures = 1, 0, 0
+		return s, []minionEvent{{Kind: eventDeathSave, Detail: detail + ", back on its feet"}, {Kind: eventRevived}}
+	case roll == 1:
+		s.Failures += 2
+		detail += ", two failures"
+	case roll >= 10:
+		s.Successes++
+		detail += ", success"
+	default:
+		s.Failures++
+		detail += ", failure"
+	}
+	events := []minionEvent{{Kind: eventDeathSave, Detail: detail}}
+	switch {
+	case s.Failures >= 3:
+		s.Dead = true
+		events = append(events, minionEvent{Kind: eventDied, Detail: "failed death saves"})
+	case s.Successes >= 3:
+		events = append(events, minionEvent{Kind: eventStable})
+	}
+	return s, events
+}
+
+var errNotDying = errors.New("minion is not making death saves")
+
+// rollDeathSave rolls a death save for a minion that is down under the
+// unconscious policy and not yet stable.
+func rollDeathSave(campaignID, id int64) (*Minion, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	s, err := loadLifeState(tx, campaignID, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.Policy != deathUnconscious || s.HP > 0 || s.Dead || s.Successes >= 3 {
+		return nil, errNotDying
+	}
+	next, events := applyDeathSave(s, rollDie(20))
+	if err := storeLifeState(tx, campaignID, id, next, events); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return getMinion(campaignID, id)
+}
+
+func loadLifeState(q querier, campaignID, id int64) (lifeState, error) {
+	var s lifeState
+	err := q.QueryRow(
+		`SELECT hp, max_hp, death_policy, death_successes, death_failures, died_at IS NOT NULL
+		 FROM minions WHERE campaign_id = ? AND id = ?`, campaignID, id).
+		Scan(&s.HP, &s.MaxHP, &s.Policy, &s.Successes, &s.Failures, &s.Dead)
+	return s, err
+}
+
+// storeLifeState writes s back and logs events. died_at keeps the first
+// time of death so the reaper's delay runs from it. A death is credited to
+// the ledger.
+func storeLifeState(q querier, campaignID, id int64, s lifeState, events []minionEvent) error {
+	_, err := q.Exec(
+		`UPDATE minions SET hp = ?, death_successes = ?, death_failures = ?,
+		 died_at = CASE WHEN ? THEN COALESCE(died_at, ?) END, version = version + 1 WHERE id = ?`,
+		s.HP, s.Successes, s.Failures, s.Dead, time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if err := logEvent(q, campaignID, id, e); err != nil {
+			return err
+		}
+	}
+	if s.Dead {
+		return creditDefeat(q, campaignID, id)
+	}
+	return nil
+}
+
+// dismissDeadAfter is how long the dead stay in the list before being
+// dismissed automatically; zero keeps them until dismissed by hand.
+// serve sets it from its flags.
+var dismissDeadAfter time.Duration
+
+// dismissDead dismisses every active minion that died at or before cutoff
+// and reports how many it dismissed.
+func dismissDead(cutoff time.Time) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT campaign_id, id FROM minions WHERE active = 1 AND kind = ? AND died_at <= ?`,
+		kindMinion, cutoff.Unix())
+	if err != nil {
+		return 0, err
+	}
+	var dead [][2]int64
+	for rows.Next() {
+		var d [2]int64
+		if err := rows.Scan(&d[0], &d[1]); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		dead = append(dead, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, d := range dead {
+		if err := dismissMinion(tx, d[0], d[1], "dead", false); err != nil {
+			return 0, err
+		}
+	}
+	return len(dead), tx.Commit()
+}
+
+// startReaper dismisses the dead once they have been dead for after. A
+// zero delay disables it.
+func startReaper(after time.Duration) {
+	if after <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(min(after, time.Minute)) {
+			if _, err := dismissDead(time.Now().Add(-after)); err != nil {
+				log.Println("reaper:", err)
+			}
+		}
+	}()
+}
+
+func handleDeathSave(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	m, err := rollDeathSave(campaignID(r), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if errors.Is(err, errNotDying) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "minion-row", m)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func eventKinds(events []minionEvent) []string {
+	kinds := make([]string, len(events))
+	for i, e := range events {
+		kinds[i] = e.Kind
+	}
+	return kinds
+}
+
+func TestApplyHPChangeDies(t *testing.T) {
+	s := lifeState{HP: 7, MaxHP: 7, Policy: deathDies}
+
+	s, events := applyHPChange(s, -3)
+	if s.HP != 4 || s.Dead || !reflect.DeepEqual(eventKinds(events), []string{eventDamage}) {
+		t.Errorf("Expected a plain hit, got %+v %v", s, events)
+	}
+
+	s, events = applyHPChange(s, -10)
+	if s.HP != 0 || !s.Dead {
+		t.Errorf("Expected death at 0 HP, got %+v", s)
+	}
+	if len(events) != 2 || events[1].Kind != eventDied || events[1].Amount != 6 {
+		t.Errorf("Expected a death with 6 overkill, got %+v", events)
+	}
+
+	if s, events = applyHPChange(s, 5); s.HP != 0 || events != nil {
+		t.Errorf("Expected healing to do nothing for the dead, got %+v %v", s, events)
+	}
+}
+
+func TestApplyHPChangeUnconscious(t *testing.T) {
+	s := lifeState{HP: 10, MaxHP: 20, Policy: deathUnconscious}
+
+	s, events := applyHPChange(s, -14)
+	if s.HP != 0 || s.Dead || events[1].Kind != eventDown || events[1].Amount != 4 {
+		t.Fatalf("Expected to fall unconscious with 4 overkill, got %+v %+v", s, events)
+	}
+
+	// Each hit while down is a failed death save; the third kills
+	s.Successes = 2
+	s, _ = applyHPChange(s, -1)
+	s, _ = applyHPChange(s, -1)
+	if s.Successes != 0 || s.Failures != 2 || s.Dead {
+		t.Errorf("Expected two failures and no successes, got %+v", s)
+	}
+	s, events = applyHPChange(s, -1)
+	if !s.Dead || events[len(events)-1].Kind != eventDied {
+		t.Errorf("Expected death on the third failure, got %+v", s)
+	}
+
+	// Healing a downed minion brings it back and clears its saves
+	down := lifeState{HP: 0, MaxHP: 20, Policy: deathUnconscious, Successes: 1, Failures: 2}
+	up, events := applyHPChange(down, 5)
+	if up.HP != 5 || up.Failures != 0 || !reflect.DeepEqual(eventKinds(events), []string{eventRevived, eventHeal}) {
+		t.Errorf("Expected a revival, got %+v %v", up, events)
+	}
+
+	// Massive damage kills outright
+	s, events = applyHPChange(lifeState{HP: 10, MaxHP: 20, Policy: deathUnconscious}, -30)
+	if !s.Dead || events[1].Detail != "massive damage" || events[1].Amount != 20 {
+		t.Errorf("Expected death from massive damage, got %+v %+v", s, events)
+	}
+}
+
+func TestApplyHPChangeMinionRule(t *testing.T) {
+	s, events := applyHPChange(lifeState{HP: 20, MaxHP: 20, Policy: deathMinion}, -1)
+	if s.HP != 0 || !s.Dead || events[1].Amount != 0 || events[1].Detail != "minion rule" {
+		t.Errorf("Expected one hit to kill, got %+v %+v", s, events)
+	}
+	if s, _ := applyHPChange(lifeState{HP: 20, MaxHP: 20, Policy: deathMinion}, 5); s.HP != 20 {
+		t.Errorf("Expected healing at full HP to do nothing, got %+v", s)
+	}
+}
+
+func TestApplyDeathSave(t *testing.T) {
+	down := lifeState{MaxHP: 20, Policy: deathUnconscious}
+	for _, tt := range []struct {
+		name  string
+		start lifeState
+		roll  int
+		check func(lifeState) bool
+	}{
+		{"success", down, 12, func(s lifeState) bool { return s.Successes == 1 && s.Failures == 0 }},
+		{"failure", down, 9, func(s lifeState) bool { return s.Failures == 1 }},
+		{"natural 1", down, 1, func(s lifeState) bool { return s.Failures == 2 && !s.Dead }},
+		{"natural 20", down, 20, func(s lifeState) bool { return s.HP == 1 }},
+		{"third success", lifeState{MaxHP: 20, Successes: 2}, 15, func(s lifeState) bool { return s.Successes == 3 && !s.Dead }},
+		{"third failure", lifeState{MaxHP: 20, Failures: 2}, 5, func(s lifeState) bool { return s.Dead }},
+	} {
+		if got, _ := applyDeathSave(tt.start, tt.roll); !tt.check(got) {
+			t.Errorf("%s: unexpected %+v", tt.name, got)
+		}
+	}
+}
+
+func TestRollDeathSave(t *testing.T) {
+	useTestDB(t)
+	m := &Minion{Name: "Cultist", HP: 9, MaxHP: 9, DeathPolicy: deathUnconscious}
+	createMinion(defaultCampaignID, m)
+
+	if _, err := rollDeathSave(defaultCampaignID, m.ID); !errors.Is(err, errNotDying) {
+		t.Errorf("Expected errNotDying while standing, got %v", err)
+	}
+	got, _ := adjustHP(defaultCampaignID, m.ID, -9)
+	if !got.Down() || got.Dead {
+		t.Fatalf("Expected the cultist down, got %+v", got)
+	}
+
+	fixedRolls(t, 4, 3, 2)
+	for range 3 {
+		got, _ = rollDeathSave(defaultCampaignID, m.ID)
+	}
+	if !got.Dead || got.DeathFailures != 3 {
+		t.Errorf("Expected three failed saves to kill, got %+v", got)
+	}
+
+	// Edits that give HP back bring the dead back
+	got.HP = 5
+	got.Version = 0
+	if err := updateMinion(defaultCampaignID, got); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if got, _ := getMinion(defaultCampaignID, m.ID); got.Dead || got.DeathFailures != 0 || got.DeathPolicy != deathUnconscious {
+		t.Errorf("Expected the edit to revive and keep the policy, got %+v", got)
+	}
+}
+
+func TestMobDeath(t *testing.T) {
+	useTestDB(t)
+	entry := &Minion{Name: "Rat", HP: 2, MaxHP: 2, Bestiary: true}
+	createMinion(defaultCampaignID, entry)
+	mob, _ := spawnMob(defaultCampaignID, entry.ID, 3, 0)
+
+	got, _ := adjustHP(defaultCampaignID, mob.ID, -4)
+	if got.Dead || got.Survivors() != 1 {
+		t.Errorf("Expected one rat left, got %+v", got)
+	}
+	got, _ = adjustHP(defaultCampaignID, mob.ID, -5)
+	if !got.Dead {
+		t.Errorf("Expected the mob dead once every rat is, got %+v", got)
+	}
+	events, _ := listEvents(defaultCampaignID, mob.ID)
+	last := events[len(events)-1]
+	if last.Kind != eventDied || last.Amount != 3 {
+		t.Errorf("Expected the death logged with 3 overkill, got %+v", last)
+	}
+}
+
+func TestDismissDead(t *testing.T) {
+	useTestDB(t)
+	dead := &Minion{Name: "Goblin", HP: 7, MaxHP: 7}
+	alive := &Minion{Name: "Orc", HP: 15, MaxHP: 15}
+	createMinion(defaultCampaignID, dead)
+	createMinion(defaultCampaignID, alive)
+	adjustHP(defaultCampaignID, dead.ID, -7)
+
+	if n, err := dismissDead(time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("Expected nothing old enough to dismiss, got %d (%v)", n, err)
+	}
+	if n, err := dismissDead(time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Errorf("Expected the goblin dismissed, got %d (%v)", n, err)
+	}
+	active, _ := listActiveMinions(defaultCampaignID)
+	if got := names(active); !reflect.DeepEqual(got, []string{"Orc"}) {
+		t.Errorf("Expected only the orc left, got %v", got)
+	}
+}
+
+func TestHandleDeathSave(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	id := createTestMinion(t, testDB, &Minion{Name: "Bandit", HP: 11, MaxHP: 11})
+	path := "/c/default/minions/" + itoa64(id)
+
+	form := strings.NewReader("name=Bandit&hp=11&max_hp=11&ac=12&attack=3&death_policy=unconscious")
+	serveAs(t, token, "PUT", path, form)
+	rec := serveAs(t, token, "POST", path+"/hp/dmg", strings.NewReader("amount=11"))
+	if body := rec.Body.String(); !contains(body, "Unconscious") || !contains(body, "Death save") {
+		t.Fatalf("Expected an unconscious row with a death save button, got %s", body)
+	}
+
+	fixedRolls(t, 20)
+	rec = serveAs(t, token, "POST", path+"/deathsave", nil)
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), "1/11") {
+		t.Errorf("Expected a natural 20 to bring the bandit back to 1 HP, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveAs(t, token, "POST", path+"/deathsave", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 once standing, got %d", rec.Code)
+	}
+}
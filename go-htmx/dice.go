@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rollDie returns a uniform roll of one die; tests swap it for fixed rolls.
+var rollDie = func(sides int) int {
+	return rand.IntN(sides) + 1
+}
+
+// dice is a damage expression such as "2d6+3". A flat number is zero dice
+// with a bonus.
+type dice struct {
+	Count int
+	Sides int
+	Bonus int
+}
+
+// diceRe matches the leading expression of a damage string, so trailing
+// words like "slashing" are ignored. The bonus must end at a word boundary,
+// or the "2" of "1d8 + 2d6" would be read as one.
+var diceRe = regexp.MustCompile(`^\s*(?:(\d*)\s*[dD]\s*(\d+))?\s*(?:([+-])\s*(\d+)\b)?`)
+
+// parseDice reads a dice expression: "1d8", "d6", "2d6+3", "1d4 - 1" or a
+// flat "5".
+func parseDice(expr string) (dice, error) {
+	expr = strings.TrimSpace(expr)
+	if n, err := strconv.Atoi(expr); err == nil && n >= 0 {
+		return dice{Bonus: n}, nil
+	}
+	sub := diceRe.FindStringSubmatch(expr)
+	if sub == nil || sub[2] == "" {
+		return dice{}, fmt.Errorf("%q is not a dice expression", expr)
+	}
+	d := dice{Count: 1}
+	if sub[1] != "" {
+		d.Count, _ = strconv.Atoi(sub[1])
+	}
+	d.Sides, _ = strconv.Atoi(sub[2])
+	if sub[4] != "" {
+		d.Bonus, _ = strconv.Atoi(sub[4])
+		if sub[3] == "-" {
+			d.Bonus = -d.Bonus
+		}
+	}
+	if d.Count < 1 || d.Count > 100 || d.Sides < 2 || d.Sides > 1000 {
+		return dice{}, fmt.Errorf("%q is out of range", expr)
+	}
+	return d, nil
+}
+
+// damageRoll is a damage string of one or more "+"-joined dice terms, such
+// as the SRD's "1d8+4 + 2d6" for a bite that also deals acid damage.
+type damageRoll []dice
+
+// parseDamage reads every term of a damage string. Like parseDice it stops
+// at trailing words, so "2d6 + 3 + 1d8 fire" is 2d6+3 and 1d8.
+func parseDamage(expr string) (damageRoll, error) {
+	d, err := parseDice(expr)
+	if err != nil {
+		return nil, err
+	}
+	roll := damageRoll{d}
+	rest := expr[len(diceRe.FindString(expr)):]
+	for {
+		term, ok := strings.CutPrefix(strings.TrimSpace(rest), "+")
+		if !ok {
+			return roll, nil
+		}
+		match := diceRe.FindStringSubmatch(term)
+		if match[2] == "" {
+			return roll, nil
+		}
+		d, err := parseDice(match[0])
+		if err != nil {
+			return nil, err
+		}
+		roll = append(roll, d)
+		rest = term[len(match[0]):]
+	}
+}
+
+// Roll rolls every term and sums them, never going below zero.
+func (r damageRoll) Roll() int {
+	total := 0
+	for _, d := range r {
+		total += d.Roll()
+	}
+	return total
+}
+
+// String writes the terms back out, joined as the SRD joins them.
+func (r damageRoll) String() string {
+	terms := make([]string, len(r))
+	for i, d := range r {
+		terms[i] = d.String()
+	}
+	return strings.Join(terms, " + ")
+}
+
+// Crit doubles every term's dice, as a critical hit does.
+func (r damageRoll) Crit() damageRoll {
+	out := make(damageRoll, len(r))
+	for i, d := range r {
+		d.Count *= 2
+		out[i] = d
+	}
+	return out
+}
+
+// Roll rolls the dice and adds the bonus, never going below zero.
+func (d dice) Roll() int {
+	total := d.Bonus
+	for range d.Count {
+		total += rollDie(d.Sides)
+	}
+	return max(0, total)
+}
+
+// Average is the expected roll rounded down, as printed in stat blocks.
+func (d dice) Average() int {
+	return max(0, d.Count*(d.Sides+1)/2+d.Bonus)
+}
+
+func (d dice) String() string {
+	s := ""
+	if d.Count > 0 {
+		s = fmt.Sprintf("%dd%d", d.Count, d.Sides)
+	}
+	switch {
+	case d.Bonus > 0 && s != "":
+		s += fmt.Sprintf("+%d", d.Bonus)
+	case d.Bonus < 0:
+		s += strconv.Itoa(d.Bonus)
+	case s == "":
+		s = strconv.Itoa(d.Bonus)
+	}
+	return s
+}
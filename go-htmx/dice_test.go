@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// fixedRolls makes rollDie return the given rolls in order, then 1s
+func fixedRolls(t *testing.T, rolls ...int) {
+	t.Helper()
+
+	orig := rollDie
+	t.Cleanup(func() { rollDie = orig })
+	rollDie = func(sides int) int {
+		if len(rolls) == 0 {
+			return 1
+		}
+		r := rolls[0]
+		rolls = rolls[1:]
+		return r
+	}
+}
+
+func TestParseDice(t *testing.T) {
+	for _, tt := range []struct {
+		expr    string
+		want    dice
+		average int
+	}{
+		{"1d6+2", dice{1, 6, 2}, 5},
+		{"2d8 + 4 slashing", dice{2, 8, 4}, 13},
+		{"d12", dice{1, 12, 0}, 6},
+		{"1d4-1", dice{1, 4, -1}, 1},
+		{"7", dice{0, 0, 7}, 7},
+	} {
+		got, err := parseDice(tt.expr)
+		if err != nil {
+			t.Errorf("parseDice(%q): %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want || got.Average() != tt.average {
+			t.Errorf("parseDice(%q): expected %+v averaging %d, got %+v averaging %d", tt.expr, tt.want, tt.average, got, got.Average())
+		}
+	}
+	for _, bad := range []string{"", "claws", "0d6", "1d1", "500d6"} {
+		if _, err := parseDice(bad); err == nil {
+			t.Errorf("parseDice(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestParseDamage(t *testing.T) {
+	for _, tt := range []struct {
+		expr string
+		want damageRoll
+	}{
+		{"1d6+2", damageRoll{{1, 6, 2}}},
+		{"1d8+3 + 2d8", damageRoll{{1, 8, 3}, {2, 8, 0}}},
+		{"1d8 + 2d6", damageRoll{{1, 8, 0}, {2, 6, 0}}},
+		{"2d6 + 3 + 1d8 fire", damageRoll{{2, 6, 3}, {1, 8, 0}}},
+		{"1d4 + 1 slashing plus 1d6", damageRoll{{1, 4, 1}}},
+	} {
+		got, err := parseDamage(tt.expr)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseDamage(%q) = %+v, %v; want %+v", tt.expr, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"claws", "1d6 + 500d6"} {
+		if _, err := parseDamage(bad); err == nil {
+			t.Errorf("parseDamage(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestDiceRoll(t *testing.T) {
+	fixedRolls(t, 3, 5)
+	if got := (dice{2, 6, 2}).Roll(); got != 10 {
+		t.Errorf("Expected 3+5+2 = 10, got %d", got)
+	}
+	if got := (dice{1, 4, -3}).Roll(); got != 0 {
+		t.Errorf("Expected a roll never to go below zero, got %d", got)
+	}
+	if s := (dice{1, 4, -1}).String(); s != "1d4-1" {
+		t.Errorf("Expected 1d4-1, got %q", s)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// crValues lists the challenge ratings in order, for the edit form.
+var crValues = []string{"0", "1/8", "1/4", "1/2", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10",
+	"11", "12", "13", "14", "15", "16", "17", "18", "19", "20", "21", "22", "23", "24", "25", "26", "27", "28", "29", "30"}
+
+// crXP is the experience a creature of each challenge rating is worth.
+var crXP = map[string]int{
+	"0": 10, "1/8": 25, "1/4": 50, "1/2": 100, "1": 200, "2": 450, "3": 700, "4": 1100, "5": 1800,
+	"6": 2300, "7": 2900, "8": 3900, "9": 5000, "10": 5900, "11": 7200, "12": 8400, "13": 10000,
+	"14": 11500, "15": 13000, "16": 15000, "17": 18000, "18": 20000, "19": 22000, "20": 25000,
+	"21": 33000, "22": 41000, "23": 50000, "24": 62000, "25": 75000, "26": 90000, "27": 105000,
+	"28": 120000, "29": 135000, "30": 155000,
+}
+
+// parseCR reads a challenge rating as stat blocks write it, or as the
+// decimals some data sources use, and returns it as a key of crXP.
+func parseCR(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "0.125", ".125":
+		s = "1/8"
+	case "0.25", ".25":
+		s = "1/4"
+	case "0.5", ".5":
+		s = "1/2"
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && f == float64(int(f)) {
+		s = strconv.Itoa(int(f))
+	}
+	_, ok := crXP[s]
+	return s, ok
+}
+
+// crNumber is a challenge rating as a number, the way Foundry stores it.
+func crNumber(cr string) float64 {
+	if num, den, ok := strings.Cut(cr, "/"); ok {
+		n, _ := strconv.ParseFloat(num, 64)
+		d, _ := strconv.ParseFloat(den, 64)
+		if d != 0 {
+			return n / d
+		}
+	}
+	f, _ := strconv.ParseFloat(cr, 64)
+	return f
+}
+
+// CustomXP is the minion's XP when it is not the standard XP for its CR,
+// so the edit form only carries an override when there is one.
+func (m Minion) CustomXP() int {
+	if m.XP == crXP[m.CR] {
+		return 0
+	}
+	return m.XP
+}
+
+// Difficulties, easiest first. An encounter under the easy threshold is
+// trivial.
+const (
+	difficultyTrivial = "trivial"
+	difficultyEasy    = "easy"
+	difficultyMedium  = "medium"
+	difficultyHard    = "hard"
+	difficultyDeadly  = "deadly"
+)
+
+var difficulties = [4]string{difficultyEasy, difficultyMedium, difficultyHard, difficultyDeadly}
+
+// levelThresholds is each character level's XP threshold for an easy,
+// medium, hard and deadly encounter.
+var levelThresholds = [21][4]int{
+	1: {25, 50, 75, 100}, 2: {50, 100, 150, 200}, 3: {75, 150, 225, 400}, 4: {125, 250, 375, 500},
+	5: {250, 500, 750, 1100}, 6: {300, 600, 900, 1400}, 7: {350, 750, 1100, 1700}, 8: {450, 900, 1400, 2100},
+	9: {550, 1100, 1600, 2400}, 10: {600, 1200, 1900, 2800}, 11: {800, 1600, 2400, 3600},
+	12: {1000, 2000, 3000, 4500}, 13: {1100, 2200, 3400, 5100}, 14: {1250, 2500, 3800, 5700},
+	15: {1400, 2800, 4300, 6400}, 16: {1600, 3200, 4800, 7200}, 17: {2000, 3900, 5900, 8800},
+	18: {2100, 4200, 6300, 9500}, 19: {2400, 4900, 7300, 10900}, 20: {2800, 5700, 8500, 12700},
+}
+
+// multipliers scale an encounter's XP by how many monsters are in it.
+var multipliers = []float64{0.5, 1, 1.5, 2, 2.5, 3, 4, 5}
+
+// encounterMultiplier is the group multiplier for count monsters against
+// a party of partySize: small parties feel crowds more, so the next
+// multiplier up applies below three characters and the next down from
+// six.
+func encounterMultiplier(count, partySize int) float64 {
+	i := 1
+	switch {
+	case count >= 15:
+		i = 6
+	case count >= 11:
+		i = 5
+	case count >= 7:
+		i = 4
+	case count >= 3:
+		i = 3
+	case count == 2:
+		i = 2
+	}
+	switch {
+	case partySize > 0 && partySize < 3:
+		i++
+	case partySize >= 6:
+		i--
+	}
+	return multipliers[i]
+}
+
+// encounter is the difficulty panel: the party's thresholds against the
+// adjusted XP of everyone in play.
+type encounter struct {
+	Party      []int
+	Thresholds [4]int
+	Monsters   int
+	XP         int
+	Multiplier float64
+	Adjusted   int
+	Difficulty string
+}
+
+// Levels lists the party's levels for the party form, e.g. "5, 5, 4, 6".
+func (e *encounter) Levels() string {
+	parts := make([]string, len(e.Party))
+	for i, l := range e.Party {
+		parts[i] = strconv.Itoa(l)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Budget is how much more adjusted XP the fight can take before it
+// becomes deadly; negative once it is.
+func (e *encounter) Budget() int {
+	return e.Thresholds[3] - e.Adjusted
+}
+
+// threshold pairs a difficulty with the party's XP threshold for it.
+type threshold struct {
+	Difficulty string
+	XP         int
+	Reached    bool
+}
+
+// ThresholdList lists the thresholds for the panel, marking those the
+// encounter reaches.
+func (e *encounter) ThresholdList() []threshold {
+	out := make([]threshold, len(difficulties))
+	for i, d := range difficulties {
+		out[i] = threshold{d, e.Thresholds[i], e.Adjusted >= e.Thresholds[i] && e.Adjusted > 0}
+	}
+	return out
+}
+
+// rateEncounter works out the difficulty of minions against a party.
+// Mobs count once per standing member; the dead and the bestiary do not
+// count, nor do PCs, allies or creatures worth no XP.
+func rateEncounter(party []int, minions []Minion) *encounter {
+	e := &encounter{Party: party}
+	for _, level := range party {
+		for i := range e.Thresholds {
+			e.Thresholds[i] += levelThresholds[level][i]
+		}
+	}
+	for _, m := range minions {
+		if m.XP <= 0 || m.Dead || m.Bestiary || !m.Active || !m.IsMinion() {
+			continue
+		}
+		n := 1
+		if m.IsMob() {
+			n = m.Survivors()
+		}
+		e.Monsters += n
+		e.XP += n * m.XP
+	}
+	e.Multiplier = encounterMultiplier(e.Monsters, len(party))
+	e.Adjusted = int(float64(e.XP) * e.Multiplier)
+	e.Difficulty = difficultyTrivial
+	for i, d := range difficulties {
+		if e.Adjusted >= e.Thresholds[i] && e.Adjusted > 0 && len(party) > 0 {
+			e.Difficulty = d
+		}
+	}
+	return e
+}
+
+// maxPartySize bounds the party form; no table is that big.
+const maxPartySize = 20
+
+// parseParty reads a party as a list of levels, "5, 5, 4, 6", where
+// "4x5" is short for four characters of level 5.
+func parseParty(s string) ([]int, error) {
+	var party []int
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		count, level := 1, part
+		if c, l, ok := strings.Cut(strings.ToLower(part), "x"); ok {
+			n, err := strconv.Atoi(c)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("%q is not a count of characters", part)
+			}
+			count, level = n, l
+		}
+		n, err := strconv.Atoi(level)
+		if err != nil || n < 1 || n > 20 {
+			return nil, fmt.Errorf("%q is not a level from 1 to 20", part)
+		}
+		if count > maxPartySize-len(party) {
+			return nil, fmt.Errorf("a party has at most %d characters", maxPartySize)
+		}
+		for range count {
+			party = append(party, n)
+		}
+	}
+	return party, nil
+}
+
+func loadParty(campaignID int64) ([]int, error) {
+	var s string
+	if err := db.QueryRow(`SELECT party FROM campaigns WHERE id = ?`, campaignID).Scan(&s); err != nil {
+		return nil, err
+	}
+	return parseParty(s)
+}
+
+func setParty(campaignID int64, party []int) error {
+	levels := make([]string, len(party))
+	for i, l := range party {
+		levels[i] = strconv.Itoa(l)
+	}
+	_, err := db.Exec(`UPDATE campaigns SET party = ? WHERE id = ?`, strings.Join(levels, ","), campaignID)
+	return err
+}
+
+// loadEncounter rates everyone in play against the campaign's party.
+func loadEncounter(campaignID int64) (*encounter, error) {
+	party, err := loadParty(campaignID)
+	if err != nil {
+		return nil, err
+	}
+	minions, err := listActiveMinions(campaignID)
+	if err != nil {
+		return nil, err
+	}
+	return rateEncounter(party, minions), nil
+}
+
+// rosterChanged wraps handlers that can change who is in the fight, so the
+// encounter panel knows to refresh itself.
+func rosterChanged(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("HX-Trigger", "roster-changed")
+		h(w, r)
+	}
+}
+
+func renderEncounter(w http.ResponseWriter, c *Campaign) {
+	e, err := loadEncounter(c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "encounter", map[string]any{"Campaign": c, "Encounter": e})
+}
+
+func handleEncounter(w http.ResponseWriter, r *http.Request) {
+	renderEncounter(w, campaignFor(r))
+}
+
+var errEmptyParty = errors.New("enter the party's levels, e.g. 5, 5, 4, 6 or 4x5")
+
+func handleSetParty(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	r.ParseForm()
+	party, err := parseParty(r.FormValue("party"))
+	if err == nil && len(party) == 0 {
+		err = errEmptyParty
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := setParty(c.ID, party); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	renderEncounter(w, c)
+}
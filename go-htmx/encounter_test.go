@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseCR(t *testing.T) {
+	for in, want := range map[string]string{"1/4": "1/4", "0.25": "1/4", " 0.5 ": "1/2", "5": "5", "5.0": "5", "0": "0"} {
+		if got, ok := parseCR(in); !ok || got != want {
+			t.Errorf("parseCR(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"", "1/3", "31", "-1", "dragon"} {
+		if _, ok := parseCR(in); ok {
+			t.Errorf("Expected %q to be rejected", in)
+		}
+	}
+	if crNumber("1/8") != 0.125 || crNumber("12") != 12 {
+		t.Errorf("Unexpected CR numbers %v, %v", crNumber("1/8"), crNumber("12"))
+	}
+}
+
+func TestEncounterMultiplier(t *testing.T) {
+	tests := []struct {
+		count, party int
+		want         float64
+	}{
+		{1, 4, 1}, {2, 4, 1.5}, {3, 4, 2}, {6, 4, 2}, {7, 4, 2.5}, {11, 4, 3}, {15, 4, 4},
+		{1, 2, 1.5}, {15, 1, 5}, {1, 6, 0.5}, {4, 7, 1.5}, {0, 4, 1},
+	}
+	for _, tt := range tests {
+		if got := encounterMultiplier(tt.count, tt.party); got != tt.want {
+			t.Errorf("encounterMultiplier(%d, %d) = %v, want %v", tt.count, tt.party, got, tt.want)
+		}
+	}
+}
+
+func TestParseParty(t *testing.T) {
+	party, err := parseParty("4x5, 6 3")
+	if err != nil || len(party) != 6 || party[0] != 5 || party[4] != 6 || party[5] != 3 {
+		t.Errorf("Unexpected party %v, %v", party, err)
+	}
+	if party, err := parseParty("18x1, 2x2"); err != nil || len(party) != maxPartySize {
+		t.Errorf("Expected a full party, got %v, %v", party, err)
+	}
+	// Counts are checked before the party is built, so a huge one costs nothing
+	for _, in := range []string{"0", "21", "fighter", "x5", "30x1", "19x1 2x2", "999999999999x1"} {
+		if _, err := parseParty(in); err == nil {
+			t.Errorf("Expected %q to be rejected", in)
+		}
+	}
+}
+
+func TestRateEncounter(t *testing.T) {
+	party := []int{5, 5, 5, 5}
+	orc := Minion{Name: "Orc", CR: "1/2", XP: 100, Active: true}
+	minions := []Minion{orc, orc, orc, orc}
+
+	e := rateEncounter(party, minions)
+	if e.Thresholds != [4]int{1000, 2000, 3000, 4400} {
+		t.Fatalf("Unexpected thresholds %v", e.Thresholds)
+	}
+	if e.Monsters != 4 || e.XP != 400 || e.Adjusted != 800 || e.Difficulty != difficultyTrivial {
+		t.Errorf("Expected four orcs to be trivial, got %+v", e)
+	}
+
+	// A mob counts its standing members; the dead and benched do not count
+	mob := Minion{Name: "Goblins", CR: "1/4", XP: 50, Active: true, HP: 14, MaxHP: 28, Members: []int{7, 0, 7, 0}}
+	dead := Minion{Name: "Ogre", XP: 450, Active: true, Dead: true}
+	benched := Minion{Name: "Ogre", XP: 450}
+	e = rateEncounter(party, append(minions, mob, dead, benched, Minion{Name: "Ogre", XP: 450, Active: true}))
+	if e.Monsters != 7 || e.XP != 950 || e.Adjusted != 2375 || e.Difficulty != difficultyMedium || e.Budget() != 2025 {
+		t.Errorf("Expected 7 monsters worth 950 XP to be medium, got %+v", e)
+	}
+
+	if e := rateEncounter(nil, minions); e.Difficulty != difficultyTrivial {
+		t.Errorf("Expected no rating without a party, got %+v", e)
+	}
+}
+
+func TestHandleEncounter(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	_, playerToken := createTestUser(t, "pc", rolePlayer)
+
+	if rec := serveAs(t, token, "POST", "/c/default/party", strings.NewReader("party=level+five")); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad party, got %d", rec.Code)
+	}
+	rec := serveAs(t, token, "POST", "/c/default/party", strings.NewReader("party=1x3"))
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), `value="3"`) || !contains(rec.Body.String(), "deadly 400") {
+		t.Errorf("Expected a level 3 party, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Spawning tells the panel to refresh
+	rec = serveAs(t, token, "POST", "/c/default/minions", strings.NewReader("name=Bugbear&hp=27&ac=16&attack=4&damage=2d8%2B2"))
+	if rec.Header().Get("HX-Trigger") != "roster-changed" {
+		t.Errorf("Expected roster-changed, got %q", rec.Header().Get("HX-Trigger"))
+	}
+
+	id := createTestMinion(t, testDB, &Minion{Name: "Ogre", HP: 59, MaxHP: 59})
+	form := url.Values{"name": {"Ogre"}, "hp": {"59"}, "max_hp": {"59"}, "ac": {"11"}, "attack": {"6"}, "cr": {"2"}, "xp": {""}}
+	rec = serveAs(t, token, "PUT", "/c/default/minions/"+itoa64(id), strings.NewReader(form.Encode()))
+	if !contains(rec.Body.String(), "<strong>CR</strong> 2 <small>(450 XP)</small>") {
+		t.Errorf("Expected the row to show the CR, got %s", rec.Body.String())
+	}
+	rec = serveAs(t, token, "GET", "/c/default/encounter", nil)
+	if !contains(rec.Body.String(), "675 adjusted XP") || !contains(rec.Body.String(), `difficulty deadly`) {
+		t.Errorf("Expected one ogre to be deadly for a lone level 3, got %s", rec.Body.String())
+	}
+
+	// An XP override sticks, and an edit without the CR fields keeps both
+	form.Set("xp", "500")
+	serveAs(t, token, "PUT", "/c/default/minions/"+itoa64(id), strings.NewReader(form.Encode()))
+	serveAs(t, token, "PUT", "/c/default/minions/"+itoa64(id), strings.NewReader("name=Ogre&hp=59&max_hp=59&ac=11&attack=6"))
+	if m, _ := getMinion(defaultCampaignID, id); m.CR != "2" || m.XP != 500 || m.CustomXP() != 500 {
+		t.Errorf("Expected CR 2 at 500 XP, got %q %d", m.CR, m.XP)
+	}
+
+	if rec := serveAs(t, playerToken, "GET", "/c/default/encounter", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a player, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,812 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportVersion is bumped whenever the document shape changes. Import
+// upgrades older versions, see upgrade, and rejects newer ones.
+//
+//	1  minions and everything stored on them
+//	2  the campaign's party, encounter, turn limit, ledger and turn times,
+//	   and each minion's history
+//	3  death state: when a minion died and its death saves
+const exportVersion = 3
+
+// maxImportSize bounds uploaded documents.
+const maxImportSize = 10 << 20
+
+// exportDoc is the portable form of a campaign's tracker state. IDs in it
+// are only meaningful within the document; import assigns fresh ones.
+type exportDoc struct {
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Campaign   string         `json:"campaign"`
+	Minions    []exportMinion `json:"minions"`
+
+	Party     []int            `json:"party,omitempty"`
+	Encounter int              `json:"encounter,omitempty"` // the running one
+	TurnLimit int              `json:"turn_limit,omitempty"`
+	Awards    []exportAward    `json:"awards,omitempty"`
+	TurnTimes []exportTurnTime `json:"turn_times,omitempty"`
+
+	// minionsOnly marks documents from before the campaign's own data was
+	// exported, so a replace import leaves that data alone.
+	minionsOnly bool
+}
+
+// exportEvent is a line of a minion's history.
+type exportEvent struct {
+	At     time.Time `json:"at"`
+	Kind   string    `json:"kind"`
+	Amount int       `json:"amount,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// exportAward is a line of the ledger. Minion is the document id of the
+// minion it was credited for, if that minion is in the document.
+type exportAward struct {
+	Encounter int         `json:"encounter"`
+	Minion    int64       `json:"minion,omitempty"`
+	Name      string      `json:"name"`
+	XP        int         `json:"xp"`
+	Loot      []lootEntry `json:"loot,omitempty"`
+	At        time.Time   `json:"at"`
+}
+
+// exportTurnTime is one finished turn; Minion is as for exportAward and
+// empty for the lair's turns.
+type exportTurnTime struct {
+	Encounter int       `json:"encounter"`
+	Minion    int64     `json:"minion,omitempty"`
+	Name      string    `json:"name"`
+	Round     int       `json:"round"`
+	Started   time.Time `json:"started"`
+	Seconds   int       `json:"seconds"`
+}
+
+type exportMinion struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	HP       int    `json:"hp"`
+	MaxHP    int    `json:"max_hp"`
+	AC       int    `json:"ac"`
+	Attack   int    `json:"attack"`
+	Damage   string `json:"damage"`
+	Notes    string `json:"notes"`
+	Active   bool   `json:"active"`
+	Bestiary bool   `json:"bestiary,omitempty"`
+	Owner    string `json:"owner,omitempty"` // username; ids do not survive a move
+
+	Initiative *int     `json:"initiative,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Members    []int    `json:"members,omitempty"` // per-member HP of a mob
+
+	DeathPolicy    string     `json:"death_policy,omitempty"`
+	DiedAt         *time.Time `json:"died_at,omitempty"`
+	DeathSuccesses int        `json:"death_successes,omitempty"`
+	DeathFailures  int        `json:"death_failures,omitempty"`
+
+	// Ability scores are omitted by older documents, which import as 10s.
+	Str       int      `json:"str,omitempty"`
+	Dex       int      `json:"dex,omitempty"`
+	Con       int      `json:"con,omitempty"`
+	Int       int      `json:"int,omitempty"`
+	Wis       int      `json:"wis,omitempty"`
+	Cha       int      `json:"cha,omitempty"`
+	Saves     []string `json:"saves,omitempty"`
+	ProfBonus int      `json:"proficiency_bonus,omitempty"`
+
+	Attacks []attack `json:"attacks,omitempty"`
+
+	Concentration string `json:"concentration,omitempty"`
+
+	Resources []resource `json:"resources,omitempty"`
+
+	CR string `json:"cr,omitempty"`
+	XP int    `json:"xp,omitempty"`
+
+	Loot []lootEntry `json:"loot,omitempty"`
+
+	Kind string `json:"kind,omitempty"` // empty for minions
+
+	Events []exportEvent `json:"events,omitempty"`
+}
+
+func (m exportMinion) scores() abilityScores {
+	return abilityScores{m.Str, m.Dex, m.Con, m.Int, m.Wis, m.Cha}
+}
+
+// Import modes.
+const (
+	importMerge   = "merge"
+	importReplace = "replace"
+)
+
+// validationError collects everything wrong with an import so the user can
+// fix the document in one pass.
+type validationError []string
+
+func (v validationError) Error() string {
+	return "invalid import: " + strings.Join(v, "; ")
+}
+
+// listAllMinions returns every minion in a campaign, dismissed ones
+// included.
+func listAllMinions(campaignID int64) ([]Minion, error) {
+	rows, err := db.Query(minionSelect+` WHERE m.campaign_id = ? ORDER BY m.id`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var minions []Minion
+	for rows.Next() {
+		var m Minion
+		if err := scanMinion(rows, &m); err != nil {
+			return nil, err
+		}
+		minions = append(minions, m)
+	}
+	return minions, rows.Err()
+}
+
+func exportCampaign(c *Campaign) (*exportDoc, error) {
+	minions, err := listAllMinions(c.ID)
+	if err != nil {
+		return nil, err
+	}
+	owners, err := usernamesByID()
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := exportEvents(c.ID)
+	if err != nil {
+		return nil, err
+	}
+	deaths, err := exportDeaths(c.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &exportDoc{
+		Version:    exportVersion,
+		ExportedAt: time.Now().UTC(),
+		Campaign:   c.Name,
+		Minions:    make([]exportMinion, 0, len(minions)),
+	}
+	inDoc := make(map[int64]bool, len(minions))
+	for _, m := range minions {
+		em := toExportMinion(m, owners)
+		em.Events = events[m.ID]
+		if at, ok := deaths[m.ID]; ok {
+			em.DiedAt = &at
+		}
+		doc.Minions = append(doc.Minions, em)
+		inDoc[m.ID] = true
+	}
+	if doc.Party, err = loadParty(c.ID); err != nil {
+		return nil, err
+	}
+	if err := db.QueryRow(`SELECT encounter, turn_limit FROM campaigns WHERE id = ?`, c.ID).
+		Scan(&doc.Encounter, &doc.TurnLimit); err != nil {
+		return nil, err
+	}
+	if doc.Awards, err = exportAwards(c.ID, inDoc); err != nil {
+		return nil, err
+	}
+	if doc.TurnTimes, err = exportTurnTimes(c.ID, inDoc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// exportDeaths returns when each of the campaign's dead died, by minion id.
+func exportDeaths(campaignID int64) (map[int64]time.Time, error) {
+	rows, err := db.Query(`SELECT id, died_at FROM minions WHERE campaign_id = ? AND died_at IS NOT NULL`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deaths := map[int64]time.Time{}
+	for rows.Next() {
+		var id, at int64
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		deaths[id] = time.Unix(at, 0).UTC()
+	}
+	return deaths, rows.Err()
+}
+
+// exportEvents returns the campaign's history by minion id.
+func exportEvents(campaignID int64) (map[int64][]exportEvent, error) {
+	rows, err := db.Query(`SELECT minion_id, at, kind, amount, detail FROM minion_events
+		WHERE campaign_id = ? ORDER BY id`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := map[int64][]exportEvent{}
+	for rows.Next() {
+		var id, at int64
+		var e exportEvent
+		if err := rows.Scan(&id, &at, &e.Kind, &e.Amount, &e.Detail); err != nil {
+			return nil, err
+		}
+		e.At = time.Unix(at, 0).UTC()
+		events[id] = append(events[id], e)
+	}
+	return events, rows.Err()
+}
+
+// exportRef is a minion id as the document refers to it: zero when the
+// minion is gone or was never one.
+func exportRef(id sql.NullInt64, inDoc map[int64]bool) int64 {
+	if !id.Valid || !inDoc[id.Int64] {
+		return 0
+	}
+	return id.Int64
+}
+
+func exportAwards(campaignID int64, inDoc map[int64]bool) ([]exportAward, error) {
+	rows, err := db.Query(`SELECT encounter, minion_id, name, xp, loot, at FROM awards
+		WHERE campaign_id = ? ORDER BY id`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var awards []exportAward
+	for rows.Next() {
+		var a exportAward
+		var minion sql.NullInt64
+		var loot string
+		var at int64
+		if err := rows.Scan(&a.Encounter, &minion, &a.Name, &a.XP, &loot, &at); err != nil {
+			return nil, err
+		}
+		if a.Loot, err = parseLootJSON(loot); err != nil {
+			return nil, err
+		}
+		a.Minion, a.At = exportRef(minion, inDoc), time.Unix(at, 0).UTC()
+		awards = append(awards, a)
+	}
+	return awards, rows.Err()
+}
+
+func exportTurnTimes(campaignID int64, inDoc map[int64]bool) ([]exportTurnTime, error) {
+	rows, err := db.Query(`SELECT encounter, minion_id, name, round, started, seconds FROM turn_times
+		WHERE campaign_id = ? ORDER BY id`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var times []exportTurnTime
+	for rows.Next() {
+		var t exportTurnTime
+		var minion sql.NullInt64
+		var started int64
+		if err := rows.Scan(&t.Encounter, &minion, &t.Name, &t.Round, &started, &t.Seconds); err != nil {
+			return nil, err
+		}
+		t.Minion, t.Started = exportRef(minion, inDoc), time.Unix(started, 0).UTC()
+		times = append(times, t)
+	}
+	return times, rows.Err()
+}
+
+func toExportMinion(m Minion, owners map[int64]string) exportMinion {
+	return exportMinion{
+		ID:       m.ID,
+		Name:     m.Name,
+		HP:       m.HP,
+		MaxHP:    m.MaxHP,
+		AC:       m.AC,
+		Attack:   m.Attack,
+		Damage:   m.Damage,
+		Notes:    m.Notes,
+		Active:   m.Active,
+		Bestiary: m.Bestiary,
+		Owner:    owners[m.OwnerID],
+
+		Initiative: m.Initiative,
+		Tags:       m.Tags,
+		Members:    m.Members,
+
+		DeathPolicy:    m.DeathPolicy,
+		DeathSuccesses: m.DeathSuccesses,
+		DeathFailures:  m.DeathFailures,
+
+		Str:       m.Scores[abilityStr],
+		Dex:       m.Scores[abilityDex],
+		Con:       m.Scores[abilityCon],
+		Int:       m.Scores[abilityInt],
+		Wis:       m.Scores[abilityWis],
+		Cha:       m.Scores[abilityCha],
+		Saves:     m.Saves,
+		ProfBonus: m.ProfBonus,
+
+		Attacks: m.Attacks,
+
+		Concentration: m.Concentration,
+
+		Resources: exportResources(m.Resources),
+
+		CR: m.CR,
+		XP: m.XP,
+
+		Loot: m.Loot,
+
+		Kind: exportKind(m.Kind),
+	}
+}
+
+// exportKind leaves minions' kind out, so exports of minions look as they
+// always have.
+func exportKind(kind string) string {
+	if kind == kindMinion {
+		return ""
+	}
+	return kind
+}
+
+// exportResources drops the row ids, which mean nothing in another database.
+func exportResources(resources []resource) []resource {
+	if resources == nil {
+		return nil
+	}
+	out := make([]resource, len(resources))
+	for i, r := range resources {
+		r.ID = 0
+		out[i] = r
+	}
+	return out
+}
+
+func usernamesByID() (map[int64]string, error) {
+	users, err := listUsers()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(users))
+	for _, u := range users {
+		names[u.ID] = u.Username
+	}
+	return names, nil
+}
+
+// upgrade brings an older document to the current shape, one version at a
+// time, so validation and import only deal with exportVersion. Versions it
+// does not know are left for validate to reject.
+func (doc *exportDoc) upgrade() error {
+	if doc.Version == 1 {
+		// Version 1 had only the minions. Anything else in it was not
+		// written by an export, so is refused rather than guessed at.
+		if len(doc.Party) > 0 || doc.Encounter != 0 || doc.TurnLimit != 0 || len(doc.Awards) > 0 ||
+			len(doc.TurnTimes) > 0 || slices.ContainsFunc(doc.Minions, func(m exportMinion) bool { return len(m.Events) > 0 }) {
+			return validationError{"a version 1 document has only minions; campaign data needs version 2"}
+		}
+		doc.minionsOnly = true
+		doc.Version = 2
+	}
+	if doc.Version == 2 {
+		// Version 2 had no death state, so everyone imports alive with
+		// no death saves, as they always did.
+		for _, m := range doc.Minions {
+			if m.DiedAt != nil || m.DeathSuccesses != 0 || m.DeathFailures != 0 {
+				return validationError{"death state needs version 3"}
+			}
+		}
+		doc.Version = 3
+	}
+	return nil
+}
+
+func (doc *exportDoc) validate() error {
+	var errs validationError
+	if doc.Version != exportVersion {
+		errs = append(errs, fmt.Sprintf("unsupported version %d (this tracker reads 1 to %d)", doc.Version, exportVersion))
+	}
+	seen := make(map[int64]bool, len(doc.Minions))
+	for i, m := range doc.Minions {
+		where := fmt.Sprintf("minions[%d]", i)
+		if m.ID != 0 {
+			if seen[m.ID] {
+				errs = append(errs, fmt.Sprintf("%s: duplicate id %d", where, m.ID))
+			}
+			seen[m.ID] = true
+		}
+		if strings.TrimSpace(m.Name) == "" {
+			errs = append(errs, where+": name is required")
+		}
+		if m.MaxHP < 0 {
+			errs = append(errs, where+": max_hp must not be negative")
+		}
+		if m.HP < 0 || m.HP > m.MaxHP {
+			errs = append(errs, fmt.Sprintf("%s: hp %d is outside 0..%d", where, m.HP, m.MaxHP))
+		}
+		if m.AC < 0 {
+			errs = append(errs, where+": ac must not be negative")
+		}
+		if m.DeathPolicy != "" && !validDeathPolicy(m.DeathPolicy) {
+			errs = append(errs, fmt.Sprintf("%s: unknown death_policy %q", where, m.DeathPolicy))
+		}
+		if m.DiedAt != nil && m.HP != 0 {
+			errs = append(errs, where+": the dead have 0 hp")
+		}
+		if m.DeathSuccesses < 0 || m.DeathSuccesses > 3 || m.DeathFailures < 0 || m.DeathFailures > 3 {
+			errs = append(errs, where+": death saves are from 0 to 3")
+		}
+		for a, score := range m.scores() {
+			if score < 0 || score > 30 {
+				errs = append(errs, fmt.Sprintf("%s: %s %d is outside 1..30", where, abilityCodes[a], score))
+			}
+		}
+		for _, s := range m.Saves {
+			if _, ok := parseAbility(s); !ok {
+				errs = append(errs, fmt.Sprintf("%s: unknown save %q", where, s))
+			}
+		}
+		if m.ProfBonus < 0 {
+			errs = append(errs, where+": proficiency_bonus must not be negative")
+		}
+		if _, err := parseTags(strings.Join(m.Tags, tagSep)); err != nil {
+			errs = append(errs, where+": "+err.Error())
+		}
+		for j, a := range m.Attacks {
+			if strings.TrimSpace(a.Name) == "" {
+				errs = append(errs, fmt.Sprintf("%s: attack %d needs a name", where, j+1))
+			}
+			if a.Uses < 0 {
+				errs = append(errs, fmt.Sprintf("%s: attack %d uses must not be negative", where, j+1))
+			}
+		}
+		for j, r := range m.Resources {
+			if strings.TrimSpace(r.Name) == "" {
+				errs = append(errs, fmt.Sprintf("%s: resource %d needs a name", where, j+1))
+			}
+			if r.Max < 1 || r.Current < 0 || r.Current > r.Max {
+				errs = append(errs, fmt.Sprintf("%s: resource %d needs 0 <= current <= max and max >= 1", where, j+1))
+			}
+			if !validReset(r.Reset) {
+				errs = append(errs, fmt.Sprintf("%s: resource %d has unknown reset %q", where, j+1, r.Reset))
+			}
+			if r.Reset == resetRecharge && (r.Recharge < 2 || r.Recharge > 6) {
+				errs = append(errs, fmt.Sprintf("%s: resource %d recharge %d is outside 2..6", where, j+1, r.Recharge))
+			}
+			if r.Level < 0 || r.Level > maxSlotLevel {
+				errs = append(errs, fmt.Sprintf("%s: resource %d level %d is outside 0..%d", where, j+1, r.Level, maxSlotLevel))
+			}
+			if _, err := parseDice(r.Regain); r.Regain != "" && err != nil {
+				errs = append(errs, fmt.Sprintf("%s: resource %d regain: %v", where, j+1, err))
+			}
+		}
+		if _, ok := parseCR(m.CR); m.CR != "" && !ok {
+			errs = append(errs, fmt.Sprintf("%s: unknown challenge rating %q", where, m.CR))
+		}
+		if m.XP < 0 {
+			errs = append(errs, where+": xp must not be negative")
+		}
+		if m.Kind != "" && !slices.Contains(combatantKinds, m.Kind) && m.Kind != kindMinion {
+			errs = append(errs, fmt.Sprintf("%s: unknown kind %q", where, m.Kind))
+		}
+		if m.Bestiary && m.Kind != "" && m.Kind != kindMinion {
+			errs = append(errs, where+": only minions can be in the bestiary")
+		}
+		for j, l := range m.Loot {
+			if strings.TrimSpace(l.Name) == "" || l.Quantity < 1 {
+				errs = append(errs, fmt.Sprintf("%s: loot %d needs a name and a quantity of at least 1", where, j+1))
+			}
+			if l.Coins && !slices.Contains(coinDenominations, l.Name) {
+				errs = append(errs, fmt.Sprintf("%s: loot %d has unknown coin %q", where, j+1, l.Name))
+			}
+		}
+		for j, e := range m.Events {
+			if strings.TrimSpace(e.Kind) == "" {
+				errs = append(errs, fmt.Sprintf("%s: event %d needs a kind", where, j+1))
+			}
+		}
+		if len(m.Members) > 0 {
+			each := m.MaxHP / len(m.Members)
+			for j, hp := range m.Members {
+				if hp < 0 || hp > each {
+					errs = append(errs, fmt.Sprintf("%s: member %d hp %d is outside 0..%d", where, j+1, hp, each))
+				}
+			}
+			if sumHP(m.Members) != m.HP || each*len(m.Members) != m.MaxHP {
+				errs = append(errs, where+": hp and max_hp must total the members")
+			}
+		}
+	}
+	if len(doc.Party) > maxPartySize {
+		errs = append(errs, fmt.Sprintf("party: at most %d characters", maxPartySize))
+	}
+	for i, level := range doc.Party {
+		if level < 1 || level > 20 {
+			errs = append(errs, fmt.Sprintf("party[%d]: level %d is outside 1..20", i, level))
+		}
+	}
+	if doc.Encounter < 0 {
+		errs = append(errs, "encounter must not be negative")
+	}
+	if doc.TurnLimit < 0 || doc.TurnLimit > maxTurnLimit {
+		errs = append(errs, fmt.Sprintf("turn_limit %d is outside 0..%d", doc.TurnLimit, maxTurnLimit))
+	}
+	ref := func(where string, id int64) {
+		if id != 0 && !seen[id] {
+			errs = append(errs, fmt.Sprintf("%s: minion %d is not in the document", where, id))
+		}
+	}
+	for i, a := range doc.Awards {
+		where := fmt.Sprintf("awards[%d]", i)
+		ref(where, a.Minion)
+		if strings.TrimSpace(a.Name) == "" {
+			errs = append(errs, where+": name is required")
+		}
+		if a.Encounter < 1 || a.XP < 0 {
+			errs = append(errs, where+": needs an encounter of at least 1 and xp that is not negative")
+		}
+		for j, l := range a.Loot {
+			if strings.TrimSpace(l.Name) == "" || l.Quantity < 1 {
+				errs = append(errs, fmt.Sprintf("%s: loot %d needs a name and a quantity of at least 1", where, j+1))
+			}
+		}
+	}
+	for i, t := range doc.TurnTimes {
+		where := fmt.Sprintf("turn_times[%d]", i)
+		ref(where, t.Minion)
+		if strings.TrimSpace(t.Name) == "" {
+			errs = append(errs, where+": name is required")
+		}
+		if t.Encounter < 1 || t.Round < 1 || t.Seconds < 0 {
+			errs = append(errs, where+": needs an encounter and round of at least 1 and seconds that are not negative")
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// importCampaign loads doc into a campaign in one transaction. In replace
+// mode the campaign's existing minions, with their history, are removed
+// first, and its party, encounter, turn limit, ledger and turn times are
+// replaced by the document's. In merge mode the campaign keeps all of
+// that and only gains the document's minions and their history. Either
+// way every imported minion gets a new id, and the returned map translates
+// document ids to database ids.
+func importCampaign(campaignID int64, doc *exportDoc, mode string) (map[int64]int64, error) {
+	if mode != importMerge && mode != importReplace {
+		return nil, validationError{fmt.Sprintf("unknown mode %q", mode)}
+	}
+	if err := doc.upgrade(); err != nil {
+		return nil, err
+	}
+	if err := doc.validate(); err != nil {
+		return nil, err
+	}
+
+	users, err := listUsers()
+	if err != nil {
+		return nil, err
+	}
+	userIDs := make(map[string]int64, len(users))
+	for _, u := range users {
+		userIDs[u.Username] = u.ID
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if mode == importReplace {
+		if _, err := tx.Exec(`DELETE FROM minion_events WHERE campaign_id = ?;
+			DELETE FROM minions WHERE campaign_id = ?`, campaignID, campaignID); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make(map[int64]int64, len(doc.Minions))
+	for _, m := range doc.Minions {
+		tags, _ := parseTags(strings.Join(m.Tags, tagSep)) // checked by validate
+		nm := &Minion{
+			Name:     m.Name,
+			HP:       m.HP,
+			MaxHP:    m.MaxHP,
+			AC:       m.AC,
+			Attack:   m.Attack,
+			Damage:   m.Damage,
+			Notes:    m.Notes,
+			Active:   m.Active && !m.Bestiary,
+			Bestiary: m.Bestiary,
+			OwnerID:  userIDs[m.Owner],
+
+			Initiative: m.Initiative,
+			Tags:       tags,
+			Members:    m.Members,
+
+			DeathPolicy: m.DeathPolicy,
+
+			Scores:    m.scores(),
+			Saves:     m.Saves,
+			ProfBonus: m.ProfBonus,
+
+			Attacks: m.Attacks,
+
+			Concentration: m.Concentration,
+
+			Resources: m.Resources,
+
+			CR: m.CR,
+			XP: m.XP,
+
+			Loot: m.Loot,
+
+			Kind: m.Kind,
+		}
+		if err := insertMinion(tx, campaignID, nm); err != nil {
+			return nil, err
+		}
+		var diedAt *int64
+		if m.DiedAt != nil {
+			at := m.DiedAt.Unix()
+			diedAt = &at
+		}
+		if _, err := tx.Exec(`UPDATE minions SET died_at = ?, death_successes = ?, death_failures = ? WHERE id = ?`,
+			diedAt, m.DeathSuccesses, m.DeathFailures, nm.ID); err != nil {
+			return nil, err
+		}
+		newID := nm.ID
+		if m.ID != 0 {
+			ids[m.ID] = newID
+		}
+		for _, e := range m.Events {
+			if err := logEvent(tx, campaignID, newID, minionEvent{At: e.At, Kind: e.Kind, Amount: e.Amount, Detail: e.Detail}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if mode == importReplace && !doc.minionsOnly {
+		if err := importCampaignData(tx, campaignID, doc, ids); err != nil {
+			return nil, err
+		}
+	}
+	return ids, tx.Commit()
+}
+
+// importCampaignData replaces the campaign's own data with the document's.
+// Minions the ledger credits are marked awarded, so they are not credited
+// twice.
+func importCampaignData(tx *sql.Tx, campaignID int64, doc *exportDoc, ids map[int64]int64) error {
+	ref := func(id int64) sql.NullInt64 {
+		newID, ok := ids[id]
+		return sql.NullInt64{Int64: newID, Valid: ok}
+	}
+	if _, err := tx.Exec(`DELETE FROM awards WHERE campaign_id = ?;
+		DELETE FROM turn_times WHERE campaign_id = ?`, campaignID, campaignID); err != nil {
+		return err
+	}
+	// The running turn belonged to minions that are gone.
+	if _, err := tx.Exec(`UPDATE campaigns SET encounter = ?, turn_limit = ?,
+		round = 0, turn_id = NULL, turn_initiative = NULL, turn_started = NULL WHERE id = ?`,
+		max(doc.Encounter, 1), doc.TurnLimit, campaignID); err != nil {
+		return err
+	}
+	levels := make([]string, len(doc.Party))
+	for i, l := range doc.Party {
+		levels[i] = strconv.Itoa(l)
+	}
+	if _, err := tx.Exec(`UPDATE campaigns SET party = ? WHERE id = ?`, strings.Join(levels, ","), campaignID); err != nil {
+		return err
+	}
+	for _, a := range doc.Awards {
+		loot, err := json.Marshal(a.Loot)
+		if err != nil {
+			return err
+		}
+		if a.Loot == nil {
+			loot = []byte("[]")
+		}
+		minion := ref(a.Minion)
+		if _, err := tx.Exec(`INSERT INTO awards (campaign_id, encounter, minion_id, name, xp, loot, at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, campaignID, a.Encounter, minion, a.Name, a.XP, string(loot), a.At.Unix()); err != nil {
+			return err
+		}
+		if minion.Valid {
+			if _, err := tx.Exec(`UPDATE minions SET awarded = 1 WHERE id = ?`, minion.Int64); err != nil {
+				return err
+			}
+		}
+	}
+	for _, t := range doc.TurnTimes {
+		if _, err := tx.Exec(`INSERT INTO turn_times (campaign_id, encounter, minion_id, name, round, started, seconds)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			campaignID, t.Encounter, ref(t.Minion), t.Name, t.Round, t.Started.Unix(), t.Seconds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	doc, err := exportCampaign(c)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s-%s.json"`, c.Slug, doc.ExportedAt.Format("2006-01-02")))
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(doc)
+}
+
+// readUpload returns the request's document, either posted raw or as the
+// "file" field of a multipart form.
+func readUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	return io.ReadAll(r.Body)
+}
+
+func handleImport(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	data, err := readUpload(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var doc exportDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mode := r.FormValue("mode")
+	if mode == "" {
+		mode = importMerge
+	}
+	ids, err := importCampaign(c.ID, &doc, mode)
+	var verr validationError
+	if errors.As(err, &verr) {
+		http.Error(w, verr.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	if r.Header.Get("HX-Request") != "" {
+		w.Header().Set("HX-Refresh", "true")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"mode": mode, "imported": len(doc.Minions), "ids": ids})
+}
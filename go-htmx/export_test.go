@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// seedExportCampaign fills the default campaign with a mix of minions
+func seedExportCampaign(t *testing.T) *User {
+	t.Helper()
+
+	player, _ := createTestUser(t, "pc", rolePlayer)
+	initiative := 14
+	for _, m := range []*Minion{
+		{Name: "Goblin", HP: 3, MaxHP: 7, AC: 15, Attack: 4, Damage: "1d6+2", Notes: "Nimble Escape", Initiative: &initiative},
+		{Name: "Owlbear", HP: 59, MaxHP: 59, AC: 13, Attack: 7, Damage: "2d8+5"},
+		{Name: "Spirit", HP: 5, MaxHP: 5, AC: 12, Attack: 3, OwnerID: player.ID},
+	} {
+		if err := createMinion(defaultCampaignID, m); err != nil {
+			t.Fatalf("Failed to seed minion: %v", err)
+		}
+	}
+	// A dismissed minion must survive the trip too
+	dead := &Minion{Name: "Dead Kobold", HP: 0, MaxHP: 5, AC: 12, Attack: 4}
+	createMinion(defaultCampaignID, dead)
+	deleteMinion(defaultCampaignID, dead.ID, false)
+	// As must the slain and the dying
+	slain := &Minion{Name: "Slain Orc", HP: 15, MaxHP: 15, AC: 13, Attack: 5}
+	createMinion(defaultCampaignID, slain)
+	adjustHP(defaultCampaignID, slain.ID, -20)
+	dying := &Minion{Name: "Dying Cultist", HP: 9, MaxHP: 9, AC: 12, Attack: 3, DeathPolicy: deathUnconscious}
+	createMinion(defaultCampaignID, dying)
+	adjustHP(defaultCampaignID, dying.ID, -9)
+	adjustHP(defaultCampaignID, dying.ID, -1)
+	return player
+}
+
+// comparableMinion strips the fields that import is expected to change
+func comparableMinion(m *Minion) Minion {
+	c := *m
+	c.ID, c.CampaignID, c.Campaign, c.Version = 0, 0, "", 0
+	c.Resources = exportResources(m.Resources)
+	return c
+}
+
+// comparable strips the fields that import is expected to change
+func comparableMinions(doc *exportDoc) []exportMinion {
+	out := make([]exportMinion, len(doc.Minions))
+	for i, m := range doc.Minions {
+		m.ID = 0
+		out[i] = m
+	}
+	return out
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	useTestDB(t)
+	u, _ := createTestUser(t, "gm", roleGM)
+	seedExportCampaign(t)
+
+	source, _ := getCampaign(defaultCampaignID)
+	before, err := exportCampaign(source)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if len(before.Minions) != 6 {
+		t.Fatalf("Expected 6 minions including the dismissed one, got %d", len(before.Minions))
+	}
+
+	// Serialize through JSON exactly as the download does
+	data, _ := json.Marshal(before)
+	var doc exportDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Failed to decode export: %v", err)
+	}
+
+	target, _ := createCampaign("Elsewhere", u.ID)
+	ids, err := importCampaign(target.ID, &doc, importReplace)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if len(ids) != 6 {
+		t.Errorf("Expected 6 remapped ids, got %d", len(ids))
+	}
+
+	after, _ := exportCampaign(target)
+	if !reflect.DeepEqual(comparableMinions(before), comparableMinions(after)) {
+		t.Errorf("Round trip changed data:\nbefore %+v\nafter  %+v", comparableMinions(before), comparableMinions(after))
+	}
+	// The document can only check what it carries, so compare the
+	// minions themselves too
+	for oldID, newID := range ids {
+		was, _ := getMinion(defaultCampaignID, oldID)
+		m, err := getMinion(target.ID, newID)
+		if err != nil {
+			t.Errorf("Remapped id %d→%d not found in target campaign", oldID, newID)
+			continue
+		}
+		if m.CampaignID != target.ID {
+			t.Errorf("Expected imported minion in target campaign, got %d", m.CampaignID)
+		}
+		if !reflect.DeepEqual(comparableMinion(was), comparableMinion(m)) {
+			t.Errorf("Round trip changed %s:\nbefore %+v\nafter  %+v", was.Name, comparableMinion(was), comparableMinion(m))
+		}
+	}
+	if m, _ := getMinion(target.ID, ids[before.Minions[4].ID]); !m.Dead {
+		t.Errorf("Expected the slain orc still dead, got %+v", m)
+	}
+	if m, _ := getMinion(target.ID, ids[before.Minions[5].ID]); !m.Down() || m.DeathFailures != 1 {
+		t.Errorf("Expected the cultist still dying with a failed save, got %+v", m)
+	}
+}
+
+func TestImportMergeKeepsExisting(t *testing.T) {
+	useTestDB(t)
+	seedExportCampaign(t)
+
+	c, _ := getCampaign(defaultCampaignID)
+	doc, _ := exportCampaign(c)
+
+	ids, err := importCampaign(defaultCampaignID, doc, importMerge)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	all, _ := listAllMinions(defaultCampaignID)
+	if len(all) != 12 {
+		t.Errorf("Expected 12 minions after merge, got %d", len(all))
+	}
+	for oldID, newID := range ids {
+		if oldID == newID {
+			t.Errorf("Expected merge to assign a fresh id for %d", oldID)
+		}
+	}
+}
+
+func TestImportReplaceRemovesExisting(t *testing.T) {
+	useTestDB(t)
+	seedExportCampaign(t)
+
+	doc := &exportDoc{Version: 1, Minions: []exportMinion{{ID: 1, Name: "Lone Wolf", HP: 11, MaxHP: 11, AC: 13, Active: true}}}
+	if _, err := importCampaign(defaultCampaignID, doc, importReplace); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	all, _ := listAllMinions(defaultCampaignID)
+	if len(all) != 1 || all[0].Name != "Lone Wolf" {
+		t.Errorf("Expected only the imported minion, got %+v", all)
+	}
+}
+
+func TestImportValidation(t *testing.T) {
+	useTestDB(t)
+	seedExportCampaign(t)
+
+	doc := &exportDoc{Version: 99, Minions: []exportMinion{
+		{ID: 1, Name: "", HP: 5, MaxHP: 5},
+		{ID: 1, Name: "Too Healthy", HP: 9, MaxHP: 5},
+	}}
+	_, err := importCampaign(defaultCampaignID, doc, importReplace)
+	verr, ok := err.(validationError)
+	if !ok {
+		t.Fatalf("Expected validationError, got %v", err)
+	}
+	if len(verr) != 4 {
+		t.Errorf("Expected 4 problems (version, name, duplicate id, hp), got %v", verr)
+	}
+
+	// Nothing was touched
+	if all, _ := listAllMinions(defaultCampaignID); len(all) != 6 {
+		t.Errorf("Expected failed import to leave 6 minions, got %d", len(all))
+	}
+
+	if _, err := importCampaign(defaultCampaignID, &exportDoc{Version: 1}, "upsert"); err == nil {
+		t.Error("Expected unknown mode to be rejected")
+	}
+}
+
+func TestHandleExportImport(t *testing.T) {
+	useTestDB(t)
+	_, gm := createTestUser(t, "gm", roleGM)
+	_, player := createTestUser(t, "player", rolePlayer)
+	seedExportCampaign(t)
+
+	if rec := serveAs(t, player, "GET", "/c/default/export", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 exporting as player, got %d", rec.Code)
+	}
+
+	rec := serveAs(t, gm, "GET", "/c/default/export", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if !contains(rec.Header().Get("Content-Disposition"), "attachment") {
+		t.Error("Expected export to download as an attachment")
+	}
+	exported := rec.Body.Bytes()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("mode", importReplace)
+	fw, _ := mw.CreateFormFile("file", "export.json")
+	fw.Write(exported)
+	mw.Close()
+
+	_, csrf, _ := lookupSession(gm)
+	req := httptest.NewRequest("POST", "/c/default/import", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set(csrfHeader, csrf)
+	req.Header.Set("HX-Request", "true")
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: gm})
+	rec = httptest.NewRecorder()
+	routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected import to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("HX-Refresh") != "true" {
+		t.Error("Expected htmx import to refresh the page")
+	}
+	if all, _ := listAllMinions(defaultCampaignID); len(all) != 6 {
+		t.Errorf("Expected 6 minions after replace import, got %d", len(all))
+	}
+
+	rec = serveAs(t, gm, "POST", "/c/default/import?mode=merge", bytes.NewReader([]byte(`{"version":1,"minions":[{"name":""}]}`)))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for invalid document, got %d", rec.Code)
+	}
+}
+
+func TestExportCampaignData(t *testing.T) {
+	useTestDB(t)
+	u, _ := createTestUser(t, "gm", roleGM)
+	goblin := insertTestMinion(t, inOrder("Goblin", 15))
+	db.Exec(`UPDATE minions SET xp = 50 WHERE id = ?`, goblin.ID)
+	setParty(defaultCampaignID, []int{5, 5, 4})
+	setTurnLimit(defaultCampaignID, 60)
+	advanceTurn(defaultCampaignID)
+	adjustHP(defaultCampaignID, goblin.ID, -7)
+	endCombat(defaultCampaignID)
+	endEncounter(defaultCampaignID)
+
+	source, _ := getCampaign(defaultCampaignID)
+	doc, err := exportCampaign(source)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if len(doc.Minions[0].Events) == 0 || len(doc.Awards) != 1 || doc.Awards[0].Minion != goblin.ID ||
+		len(doc.TurnTimes) != 1 || doc.Encounter != 2 || doc.TurnLimit != 60 || len(doc.Party) != 3 {
+		t.Fatalf("Expected the campaign's data in the export, got %+v", doc)
+	}
+
+	data, _ := json.Marshal(doc)
+	var decoded exportDoc
+	json.Unmarshal(data, &decoded)
+	target, _ := createCampaign("Elsewhere", u.ID)
+	ids, err := importCampaign(target.ID, &decoded, importReplace)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	events, _ := listEvents(target.ID, ids[goblin.ID])
+	if len(events) != len(doc.Minions[0].Events) || events[0].Kind != doc.Minions[0].Events[0].Kind {
+		t.Errorf("Expected the goblin's history imported, got %+v", events)
+	}
+	if l, _ := loadLedger(target.ID, 1); l.XP != 50 || l.Party != 3 || len(l.Turns) != 1 {
+		t.Errorf("Expected the first encounter's ledger imported, got %+v", l)
+	}
+	if n, _ := currentEncounter(target.ID); n != 2 {
+		t.Errorf("Expected encounter 2 running, got %d", n)
+	}
+	// The credited goblin is not credited again
+	creditDefeat(db, target.ID, ids[goblin.ID])
+	if l, _ := loadLedger(target.ID, 2); len(l.Awards) != 0 {
+		t.Errorf("Expected no second award, got %+v", l.Awards)
+	}
+}
+
+func TestImportVersion1(t *testing.T) {
+	useTestDB(t)
+	setParty(defaultCampaignID, []int{3, 3})
+
+	doc := &exportDoc{Version: 1, Minions: []exportMinion{{ID: 1, Name: "Wolf", HP: 11, MaxHP: 11, Active: true}}}
+	if _, err := importCampaign(defaultCampaignID, doc, importReplace); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if party, _ := loadParty(defaultCampaignID); len(party) != 2 {
+		t.Errorf("Expected a version 1 document to leave the party alone, got %v", party)
+	}
+
+	doc = &exportDoc{Version: 2, Minions: []exportMinion{{ID: 1, Name: "Wolf", MaxHP: 11, DeathFailures: 2}}}
+	if _, err := importCampaign(defaultCampaignID, doc, importReplace); err == nil {
+		t.Error("Expected death saves in a version 2 document to be rejected")
+	}
+	doc = &exportDoc{Version: 1, Party: []int{5}}
+	if _, err := importCampaign(defaultCampaignID, doc, importReplace); err == nil {
+		t.Error("Expected campaign data in a version 1 document to be rejected")
+	}
+	doc = &exportDoc{Version: exportVersion, Awards: []exportAward{{Encounter: 1, Minion: 7, Name: "Ghost", XP: 10}}}
+	if _, err := importCampaign(defaultCampaignID, doc, importReplace); err == nil {
+		t.Error("Expected an award for a minion not in the document to be rejected")
+	}
+}
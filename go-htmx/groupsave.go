@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// groupSave is an area effect: everyone caught in it saves against DC, and
+// takes the damage rolled once for all of them, halved on a success when
+// Half is set and avoided entirely otherwise.
+type groupSave struct {
+	Ability    int
+	DC         int
+	Mode       string
+	Damage     damageRoll
+	DamageType string
+	Half       bool
+}
+
+// groupSaveResult is how one minion fared. Each standing member of a mob
+// saves and takes its damage on its own, with Member its number from 1.
+type groupSaveResult struct {
+	Save   saveResult
+	Member int
+	Damage int
+	Before int // HP before and after the damage, the member's for a mob
+	After  int
+	Dead   bool
+}
+
+// groupSaveReport is the outcome of a whole group save.
+type groupSaveReport struct {
+	Effect  groupSave
+	Rolled  int // the damage rolled for everyone
+	Results []groupSaveResult
+}
+
+var errNoTargets = errors.New("choose minions or a tag to make the save")
+
+// saveDamage is the damage one minion takes from rolled.
+func (g groupSave) saveDamage(rolled int, passed bool) int {
+	switch {
+	case !passed:
+		return rolled
+	case g.Half:
+		return rolled / 2
+	default:
+		return 0
+	}
+}
+
+// resolveGroupSave rolls a save for each living active minion in ids, or
+// tagged tag when ids is empty, and for each standing member of a mob
+// among them, and applies the damage through adjustHPTx in one
+// transaction.
+func resolveGroupSave(campaignID int64, ids []int64, tag string, g groupSave) (*groupSaveReport, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	where, args := `m.campaign_id = ? AND m.active = 1 AND m.kind = ? AND m.died_at IS NULL`, []any{campaignID, kindMinion}
+	switch {
+	case len(ids) > 0:
+		where += ` AND m.id IN (?` + strings.Repeat(`, ?`, len(ids)-1) + `)`
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	case tag != "":
+		where += ` AND m.id IN (SELECT mt.minion_id FROM minion_tags mt JOIN tags t ON t.id = mt.tag_id
+			WHERE t.campaign_id = ? AND t.name = ?)`
+		args = append(args, campaignID, tag)
+	default:
+		return nil, errNoTargets
+	}
+	rows, err := tx.Query(minionSelect+` WHERE `+where+` ORDER BY m.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var targets []*Minion
+	for rows.Next() {
+		m := &Minion{}
+		if err := scanMinion(rows, m); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		targets = append(targets, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, errNoTargets
+	}
+
+	report := &groupSaveReport{Effect: g, Rolled: g.Damage.Roll()}
+	for _, m := range targets {
+		if !m.IsMob() {
+			res, err := g.resolve(tx, campaignID, m, anyMember, m.HP, report.Rolled)
+			if err != nil {
+				return nil, err
+			}
+			report.Results = append(report.Results, res)
+			continue
+		}
+		for i, hp := range m.Members {
+			if hp == 0 {
+				continue
+			}
+			res, err := g.resolve(tx, campaignID, m, i, hp, report.Rolled)
+			if err != nil {
+				return nil, err
+			}
+			report.Results = append(report.Results, res)
+		}
+	}
+	return report, tx.Commit()
+}
+
+// resolve rolls one save for m and applies its share of rolled: to the
+// whole minion when member is anyMember, otherwise to that mob member,
+// who has hp left.
+func (g groupSave) resolve(q querier, campaignID int64, m *Minion, member, hp, rolled int) (groupSaveResult, error) {
+	res := groupSaveResult{Save: rollSave(m, g.Ability, g.DC, g.Mode), Before: hp, After: hp}
+	res.Damage = g.saveDamage(rolled, res.Save.Passed)
+
+	e := saveEvent(res.Save)
+	if member != anyMember {
+		res.Member = member + 1
+		e.Detail = "member " + strconv.Itoa(res.Member) + ": " + e.Detail
+	}
+	if res.Damage > 0 {
+		e.Detail += ", " + strings.TrimSpace(strconv.Itoa(res.Damage)+" "+g.DamageType) + " damage"
+	}
+	if err := logEvent(q, campaignID, m.ID, e); err != nil {
+		return res, err
+	}
+	if res.Damage == 0 {
+		return res, nil
+	}
+	if err := adjustHPTx(q, campaignID, m.ID, member, -res.Damage); err != nil {
+		return res, err
+	}
+	if member != anyMember {
+		res.After = max(0, hp-res.Damage)
+		res.Dead = res.After == 0
+		return res, nil
+	}
+	s, err := loadLifeState(q, campaignID, m.ID)
+	if err != nil {
+		return res, err
+	}
+	res.After, res.Dead = s.HP, s.Dead
+	return res, nil
+}
+
+// parseGroupSave reads the group save form: the save fields shared with
+// single saves plus damage, damage_type and half.
+func parseGroupSave(r *http.Request) (groupSave, error) {
+	ability, dc, mode, err := parseSaveRequest(r)
+	if err != nil {
+		return groupSave{}, err
+	}
+	g := groupSave{Ability: ability, DC: dc, Mode: mode, Half: r.FormValue("half") != ""}
+	if g.Damage, err = parseDamage(r.FormValue("damage")); err != nil {
+		return groupSave{}, errors.New("damage must be dice such as 8d6 or a number")
+	}
+	g.DamageType = strings.TrimSpace(r.FormValue("damage_type"))
+	return g, nil
+}
+
+// handleGroupSave resolves a group save for the minions ticked in the list
+// (id values) or, failing that, everyone tagged save_tag. It answers with
+// the results table above the refreshed list.
+func handleGroupSave(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	r.ParseForm()
+	g, err := parseGroupSave(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var ids []int64
+	for _, v := range r.Form["id"] {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	report, err := resolveGroupSave(c.ID, ids, r.FormValue("save_tag"), g)
+	if errors.Is(err, errNoTargets) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	view, err := minionListView(c, parseMinionQuery(r.Form))
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	view["GroupSave"] = report
+	tmpl.ExecuteTemplate(w, "group-save-results", view)
+}
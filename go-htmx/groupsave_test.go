@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSaveDamage(t *testing.T) {
+	half := groupSave{Half: true}
+	if half.saveDamage(27, false) != 27 || half.saveDamage(27, true) != 13 {
+		t.Errorf("Expected full damage on a failure and half rounded down on a success")
+	}
+	if (groupSave{}).saveDamage(27, true) != 0 {
+		t.Errorf("Expected no damage on a success without half")
+	}
+}
+
+func TestResolveGroupSave(t *testing.T) {
+	useTestDB(t)
+
+	var ids []int64
+	for _, m := range []*Minion{
+		{Name: "Goblin 1", HP: 7, MaxHP: 7, Scores: abilityScores{8, 14, 10, 10, 8, 8}},
+		{Name: "Goblin 2", HP: 7, MaxHP: 7, Scores: abilityScores{8, 14, 10, 10, 8, 8}},
+		{Name: "Ogre", HP: 59, MaxHP: 59, Scores: abilityScores{19, 8, 16, 5, 7, 7}},
+	} {
+		m.Active = true
+		ids = append(ids, insertTestMinion(t, m).ID)
+	}
+
+	// 3+3 fire damage; the goblins roll 15 and 5 (+2), the ogre 12 (-1)
+	fixedRolls(t, 3, 3, 15, 5, 12)
+	g := groupSave{Ability: abilityDex, DC: 13, Damage: damageRoll{{Count: 2, Sides: 6}}, DamageType: "fire", Half: true}
+	report, err := resolveGroupSave(defaultCampaignID, ids, "", g)
+	if err != nil {
+		t.Fatalf("Group save failed: %v", err)
+	}
+	if report.Rolled != 6 || len(report.Results) != 3 {
+		t.Fatalf("Expected 6 damage against three minions, got %+v", report)
+	}
+	for i, want := range []struct {
+		passed        bool
+		damage, after int
+	}{{true, 3, 4}, {false, 6, 1}, {false, 6, 53}} {
+		res := report.Results[i]
+		if res.Save.Passed != want.passed || res.Damage != want.damage || res.After != want.after {
+			t.Errorf("Result %d: expected %+v, got %+v", i, want, res)
+		}
+	}
+
+	events, _ := listEvents(defaultCampaignID, ids[0])
+	if len(events) != 2 || events[0].Detail != "DEX 17 vs DC 13, passed, 3 fire damage" || events[1].Kind != eventDamage {
+		t.Errorf("Expected the save and the damage in the history, got %+v", events)
+	}
+
+	if _, err := resolveGroupSave(defaultCampaignID, nil, "", g); err != errNoTargets {
+		t.Errorf("Expected errNoTargets without ids or tag, got %v", err)
+	}
+}
+
+func TestResolveGroupSaveMob(t *testing.T) {
+	useTestDB(t)
+
+	mob := insertTestMinion(t, &Minion{Name: "Goblins", HP: 17, MaxHP: 28, Active: true, Members: []int{7, 7, 0, 3},
+		Scores: abilityScores{8, 14, 10, 10, 8, 8}})
+
+	// 3+3 fire damage; the three standing members roll 15, 5 and 10 (+2)
+	fixedRolls(t, 3, 3, 15, 5, 10)
+	g := groupSave{Ability: abilityDex, DC: 13, Damage: damageRoll{{Count: 2, Sides: 6}}, DamageType: "fire", Half: true}
+	report, err := resolveGroupSave(defaultCampaignID, []int64{mob.ID}, "", g)
+	if err != nil {
+		t.Fatalf("Group save failed: %v", err)
+	}
+	if len(report.Results) != 3 {
+		t.Fatalf("Expected a save for each standing member, got %+v", report.Results)
+	}
+	for i, want := range []struct {
+		member        int
+		passed        bool
+		damage, after int
+		dead          bool
+	}{{1, true, 3, 4, false}, {2, false, 6, 1, false}, {4, false, 6, 0, true}} {
+		res := report.Results[i]
+		if res.Member != want.member || res.Save.Passed != want.passed || res.Damage != want.damage ||
+			res.After != want.after || res.Dead != want.dead {
+			t.Errorf("Result %d: expected %+v, got %+v", i, want, res)
+		}
+	}
+
+	m, _ := getMinion(defaultCampaignID, mob.ID)
+	if m.HP != 5 || m.Dead || len(m.Members) != 4 || m.Members[0] != 4 || m.Members[1] != 1 || m.Members[3] != 0 {
+		t.Errorf("Expected each member to take its own damage, got %d HP, %v", m.HP, m.Members)
+	}
+	events, _ := listEvents(defaultCampaignID, mob.ID)
+	if len(events) != 6 || events[0].Detail != "member 1: DEX 17 vs DC 13, passed, 3 fire damage" ||
+		events[5].Detail != "1 fell" {
+		t.Errorf("Expected each member's save and damage in the history, got %+v", events)
+	}
+}
+
+func TestResolveGroupSaveByTagSkipsTheDead(t *testing.T) {
+	testDB := useTestDB(t)
+
+	alive := tagMinion(t, &Minion{Name: "Wolf 1", HP: 11, MaxHP: 11}, "pack")
+	dead := tagMinion(t, &Minion{Name: "Wolf 2", HP: 0, MaxHP: 11}, "pack")
+	createTestMinion(t, testDB, &Minion{Name: "Bandit", HP: 11, MaxHP: 11})
+	testDB.Exec(`UPDATE minions SET died_at = 1 WHERE id = ?`, dead)
+
+	fixedRolls(t, 4, 2)
+	report, err := resolveGroupSave(defaultCampaignID, nil, "pack", groupSave{Ability: abilityCon, DC: 10, Damage: damageRoll{{Bonus: 5}}})
+	if err != nil {
+		t.Fatalf("Group save failed: %v", err)
+	}
+	if len(report.Results) != 1 || report.Results[0].Save.Minion.ID != alive || report.Results[0].After != 6 {
+		t.Errorf("Expected only the living wolf to take 5, got %+v", report.Results)
+	}
+}
+
+func TestHandleGroupSave(t *testing.T) {
+	testDB := useTestDB(t)
+	_, gm := createTestUser(t, "gm", roleGM)
+	_, player := createTestUser(t, "pc", rolePlayer)
+	a := createTestMinion(t, testDB, &Minion{Name: "Kobold 1", HP: 5, MaxHP: 5})
+	b := createTestMinion(t, testDB, &Minion{Name: "Kobold 2", HP: 5, MaxHP: 5})
+
+	form := "ability=dex&dc=30&damage=4&damage_type=cold&half=1&id=" + itoa64(a) + "&id=" + itoa64(b)
+	rec := serveAs(t, gm, "POST", "/c/default/saves", strings.NewReader(form))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !contains(body, "group-save-results") || !contains(body, `id="minion-list"`) {
+		t.Fatalf("Expected the results table and the list, got %d: %s", rec.Code, body)
+	}
+	if !contains(body, "4 cold damage rolled") || !contains(body, "5 → 1") {
+		t.Errorf("Expected both kobolds to fail and take 4, got %s", body)
+	}
+
+	// Every term of a multi-part damage roll counts, and a save halves the total
+	troll := createTestMinion(t, testDB, &Minion{Name: "Troll", HP: 40, MaxHP: 40})
+	fixedRolls(t, 3, 2, 5, 10)
+	multi := url.Values{"ability": {"dex"}, "dc": {"1"}, "damage": {"1d4+1 + 2d6"}, "half": {"1"}, "id": {itoa64(troll)}}
+	body = serveAs(t, gm, "POST", "/c/default/saves", strings.NewReader(multi.Encode())).Body.String()
+	if !contains(body, "11 damage rolled (1d4&#43;1 &#43; 2d6)") || !contains(body, "40 → 35") {
+		t.Errorf("Expected 11 rolled and the troll to save for 5, got %s", body)
+	}
+
+	for _, bad := range []string{"ability=dex&dc=10&damage=4", "ability=dex&dc=10&damage=lots&id=" + itoa64(a), "dc=10&damage=4&id=" + itoa64(a)} {
+		if rec := serveAs(t, gm, "POST", "/c/default/saves", strings.NewReader(bad)); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %q, got %d", bad, rec.Code)
+		}
+	}
+	if rec := serveAs(t, player, "POST", "/c/default/saves", strings.NewReader(form)); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected players to be refused, got %d", rec.Code)
+	}
+}
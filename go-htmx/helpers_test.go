@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 
+	"golang.org/x/crypto/bcrypt"
 	_ "modernc.org/sqlite"
 )
 
@@ -19,35 +22,44 @@ func setupTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to open test database: %v", err)
 	}
 
-	// Create schema
-	_, err = testDB.Exec(`
-		CREATE TABLE minions (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			hp INTEGER NOT NULL,
-			max_hp INTEGER NOT NULL,
-			ac INTEGER NOT NULL,
-			attack INTEGER NOT NULL,
-			damage TEXT NOT NULL DEFAULT '',
-			notes TEXT NOT NULL DEFAULT '',
-			active INTEGER NOT NULL DEFAULT 1
-		)
-	`)
-	if err != nil {
+	// A pooled :memory: database is one database per connection, so pin
+	// the pool to a single connection before creating the schema.
+	testDB.SetMaxOpenConns(1)
+	if err := migrate(testDB); err != nil {
 		t.Fatalf("Failed to create schema: %v", err)
 	}
 
 	return testDB
 }
 
+// useTestDB swaps the global db for a fresh in-memory database for the
+// duration of the test and loads the templates.
+func useTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	testDB := setupTestDB(t)
+	originalDB := db
+	db = testDB
+	t.Cleanup(func() {
+		db = originalDB
+		testDB.Close()
+	})
+	initTemplates()
+	return testDB
+}
+
 // createTestMinion inserts a test minion and returns its ID
 func createTestMinion(t *testing.T, testDB *sql.DB, m *Minion) int64 {
 	t.Helper()
 
+	campaign := m.CampaignID
+	if campaign == 0 {
+		campaign = defaultCampaignID
+	}
 	res, err := testDB.Exec(
-		`INSERT INTO minions (name, hp, max_hp, ac, attack, damage, notes, active)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, 1)`,
-		m.Name, m.HP, m.MaxHP, m.AC, m.Attack, m.Damage, m.Notes,
+		`INSERT INTO minions (campaign_id, name, hp, max_hp, ac, attack, damage, notes, active, owner_id, initiative)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?)`,
+		campaign, m.Name, m.HP, m.MaxHP, m.AC, m.Attack, m.Damage, m.Notes, m.OwnerID, m.Initiative,
 	)
 	if err != nil {
 		t.Fatalf("Failed to create test minion: %v", err)
@@ -60,11 +72,49 @@ func createTestMinion(t *testing.T, testDB *sql.DB, m *Minion) int64 {
 	return id
 }
 
-// makeRequest creates an HTTP request and returns the response recorder
+// insertTestMinion stores m, attacks, resources, tags and all, in its own
+// campaign or the default one, and returns it as read back
+func insertTestMinion(t *testing.T, m *Minion) *Minion {
+	t.Helper()
+
+	campaign := m.CampaignID
+	if campaign == 0 {
+		campaign = defaultCampaignID
+	}
+	if err := insertMinion(db, campaign, m); err != nil {
+		t.Fatalf("Failed to insert test minion: %v", err)
+	}
+	stored, err := getMinion(campaign, m.ID)
+	if err != nil {
+		t.Fatalf("Failed to read back test minion: %v", err)
+	}
+	return stored
+}
+
+// initiative points at n, for minion literals that rolled it
+func initiative(n int) *int {
+	return &n
+}
+
+// asGM puts the default campaign into req's context with the GM role, as
+// requireMember would, for tests that call a handler directly
+func asGM(t *testing.T, req *http.Request) *http.Request {
+	t.Helper()
+
+	c, err := getCampaign(defaultCampaignID)
+	if err != nil {
+		t.Fatalf("Failed to load the default campaign: %v", err)
+	}
+	c.Role = roleGM
+	return req.WithContext(context.WithValue(req.Context(), campaignKey, c))
+}
+
+// makeRequest calls handler directly, as a GM of the default campaign, and
+// returns the response recorder
 func makeRequest(t *testing.T, handler http.HandlerFunc, method, path string, body io.Reader) *httptest.ResponseRecorder {
 	t.Helper()
 
-	req := httptest.NewRequest(method, path, body)
+	req := asGM(t, httptest.NewRequest(method, path, body))
 	if body != nil {
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	}
@@ -74,3 +124,57 @@ func makeRequest(t *testing.T, handler http.HandlerFunc, method, path string, bo
 
 	return rec
 }
+
+// createTestUser creates an account with the same role in the default
+// campaign and returns it with a live session token
+func createTestUser(t *testing.T, username, role string) (*User, string) {
+	t.Helper()
+
+	bcryptCost = bcrypt.MinCost
+	u, err := createUser(username, "correct horse battery", role)
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	if err := addMember(defaultCampaignID, u.ID, role); err != nil {
+		t.Fatalf("Failed to add test user to campaign: %v", err)
+	}
+	token, err := createSession(u.ID)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	return u, token
+}
+
+// anonCSRF stands in for the double-submit cookie a browser would hold
+const anonCSRF = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// serveAs sends a request through the full router the way our own pages
+// would, signed in with token when it is non-empty
+func serveAs(t *testing.T, token, method, path string, body io.Reader) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, body)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+		if _, csrf, err := lookupSession(token); err == nil {
+			req.Header.Set(csrfHeader, csrf)
+		}
+	} else {
+		req.AddCookie(&http.Cookie{Name: csrfCookie, Value: anonCSRF})
+		req.Header.Set(csrfHeader, anonCSRF)
+	}
+
+	rec := httptest.NewRecorder()
+	routes().ServeHTTP(rec, req)
+
+	return rec
+}
+
+// itoa64 formats an id for building request paths
+func itoa64(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
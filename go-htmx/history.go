@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Kinds of minion history events.
+const (
+	eventDamage    = "damage"
+	eventHeal      = "heal"
+	eventDown      = "down"
+	eventDied      = "died"
+	eventDeathSave = "death save"
+	eventStable    = "stable"
+	eventRevived   = "revived"
+	eventDismissed = "dismissed"
+	eventSave      = "save"
+
+	eventJoinedMob     = "joined mob"
+	eventConcentration = "concentration"
+	eventRecharge      = "recharge"
+	eventRest          = "rest"
+)
+
+// minionEvent is one entry in a minion's history. Amount is the HP
+// involved, if any; for a death it is the overkill.
+type minionEvent struct {
+	ID       int64
+	MinionID int64
+	At       time.Time
+	Kind     string
+	Amount   int
+	Detail   string
+}
+
+// logEvent appends an event to a minion's history.
+func logEvent(q querier, campaignID, minionID int64, e minionEvent) error {
+	at := e.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+	_, err := q.Exec(`INSERT INTO minion_events (campaign_id, minion_id, at, kind, amount, detail) VALUES (?, ?, ?, ?, ?, ?)`,
+		campaignID, minionID, at.Unix(), e.Kind, e.Amount, e.Detail)
+	return err
+}
+
+// listEvents returns a minion's history, oldest first.
+func listEvents(campaignID, minionID int64) ([]minionEvent, error) {
+	rows, err := db.Query(
+		`SELECT id, minion_id, at, kind, amount, detail FROM minion_events
+		 WHERE campaign_id = ? AND minion_id = ? ORDER BY id`, campaignID, minionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []minionEvent
+	for rows.Next() {
+		var e minionEvent
+		var at int64
+		if err := rows.Scan(&e.ID, &e.MinionID, &at, &e.Kind, &e.Amount, &e.Detail); err != nil {
+			return nil, err
+		}
+		e.At = time.Unix(at, 0)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	m, err := getMinion(campaignID(r), id)
+	if err != nil {
+		http.Error(w, "not found", 404)
+		return
+	}
+	events, err := listEvents(campaignID(r), id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "minion-history", map[string]any{"Minion": m, "Events": events})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMinionHistory(t *testing.T) {
+	useTestDB(t)
+	_, token := createTestUser(t, "pc", rolePlayer)
+	m := &Minion{Name: "Kobold", HP: 5, MaxHP: 5}
+	createMinion(defaultCampaignID, m)
+
+	adjustHP(defaultCampaignID, m.ID, -2)
+	adjustHP(defaultCampaignID, m.ID, 1)
+	adjustHP(defaultCampaignID, m.ID, -9)
+	deleteMinion(defaultCampaignID, m.ID, false)
+
+	events, err := listEvents(defaultCampaignID, m.ID)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	want := []string{eventDamage, eventHeal, eventDamage, eventDied, eventDismissed}
+	if got := eventKinds(events); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if events[3].Amount != 5 {
+		t.Errorf("Expected 5 overkill on the death, got %d", events[3].Amount)
+	}
+
+	rec := serveAs(t, token, "GET", "/c/default/minions/"+itoa64(m.ID)+"/history", nil)
+	if body := rec.Body.String(); !contains(body, "5 overkill") || !contains(body, "dismissed") {
+		t.Errorf("Expected the history fragment, got %s", body)
+	}
+	if events, _ := listEvents(defaultCampaignID+1, m.ID); len(events) != 0 {
+		t.Errorf("Expected no history from another campaign, got %v", events)
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lootEntry is something a minion carries for the party to collect:
+// coins, where Name is the denomination, or an item.
+type lootEntry struct {
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+	Coins    bool   `json:"coins,omitempty"`
+}
+
+// coinDenominations lists the coins, most valuable first.
+var coinDenominations = []string{"pp", "gp", "ep", "sp", "cp"}
+
+func (l lootEntry) String() string {
+	switch {
+	case l.Coins:
+		return strconv.Itoa(l.Quantity) + " " + l.Name
+	case l.Quantity > 1:
+		return l.Name + " ×" + strconv.Itoa(l.Quantity)
+	}
+	return l.Name
+}
+
+var (
+	lootCoins    = regexp.MustCompile(`(?i)^(\d+)\s*(pp|gp|ep|sp|cp)$`)
+	lootQuantity = regexp.MustCompile(`^(\d+)\s*[x×]?\s+(.+)$|^(.+?)\s*[x×]\s*(\d+)$`)
+)
+
+// parseLoot reads the edit form's loot box, one entry per line: "15 gp",
+// "2 Javelins" or "Javelin ×2", or just an item name. It never returns
+// nil, so an empty box clears the loot.
+func parseLoot(s string) []lootEntry {
+	loot := []lootEntry{}
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if sub := lootCoins.FindStringSubmatch(line); sub != nil {
+			n, _ := strconv.Atoi(sub[1])
+			loot = append(loot, lootEntry{Name: strings.ToLower(sub[2]), Quantity: n, Coins: true})
+			continue
+		}
+		e := lootEntry{Name: line, Quantity: 1}
+		if sub := lootQuantity.FindStringSubmatch(line); sub != nil {
+			if sub[1] != "" {
+				e.Quantity, _ = strconv.Atoi(sub[1])
+				e.Name = sub[2]
+			} else {
+				e.Quantity, _ = strconv.Atoi(sub[4])
+				e.Name = sub[3]
+			}
+		}
+		if e.Quantity > 0 {
+			loot = append(loot, e)
+		}
+	}
+	return loot
+}
+
+// addLoot adds more to loot, adding to the quantity of entries loot
+// already has.
+func addLoot(loot, more []lootEntry) []lootEntry {
+	out := slices.Clone(loot)
+	for _, l := range more {
+		i := slices.IndexFunc(out, func(o lootEntry) bool { return o.Coins == l.Coins && strings.EqualFold(o.Name, l.Name) })
+		if i < 0 {
+			out = append(out, l)
+			continue
+		}
+		out[i].Quantity += l.Quantity
+	}
+	return out
+}
+
+// LootText is the minion's loot as the edit form's loot box shows it.
+func (m Minion) LootText() string {
+	lines := make([]string, len(m.Loot))
+	for i, l := range m.Loot {
+		lines[i] = l.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// lootSelect reads a minion's loot as a JSON array, for minionSelect and
+// for copying into the ledger.
+const lootSelect = `(SELECT json_group_array(json_object('name', name, 'quantity', quantity,
+		'coins', json(CASE WHEN coins THEN 'true' ELSE 'false' END)))
+	FROM (SELECT * FROM loot WHERE minion_id = m.id ORDER BY position))`
+
+// parseLootJSON reads the loot arrays lootSelect builds.
+func parseLootJSON(s string) ([]lootEntry, error) {
+	var loot []lootEntry
+	if err := json.Unmarshal([]byte(s), &loot); err != nil {
+		return nil, err
+	}
+	if len(loot) == 0 {
+		return nil, nil
+	}
+	return loot, nil
+}
+
+// setMinionLoot replaces a minion's loot.
+func setMinionLoot(q querier, minionID int64, loot []lootEntry) error {
+	if _, err := q.Exec(`DELETE FROM loot WHERE minion_id = ?`, minionID); err != nil {
+		return err
+	}
+	for i, l := range loot {
+		if _, err := q.Exec(`INSERT INTO loot (minion_id, position, name, quantity, coins) VALUES (?, ?, ?, ?, ?)`,
+			minionID, i, l.Name, l.Quantity, l.Coins); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// award is a line in the ledger: a defeated minion's XP and loot, credited
+// to the encounter that was running.
+type award struct {
+	ID        int64
+	Encounter int
+	Name      string
+	XP        int
+	Loot      []lootEntry
+	At        time.Time
+}
+
+// creditDefeat records a minion's XP and loot in the ledger the first time
+// it dies; see storeLifeState. A mob is worth its XP once per member. Bestiary
+// entries, PCs and allies, and minions worth nothing and carrying nothing
+// are not credited.
+func creditDefeat(q querier, campaignID, id int64) error {
+	var name string
+	var xp int
+	var members sql.NullString
+	var loot string
+	var awarded, bestiary bool
+	var kind string
+	err := q.QueryRow(
+		`SELECT name, xp, members, awarded, bestiary, kind, `+lootSelect+`
+		 FROM minions m WHERE campaign_id = ? AND id = ?`, campaignID, id).
+		Scan(&name, &xp, &members, &awarded, &bestiary, &kind, &loot)
+	if err != nil || awarded || bestiary || kind != kindMinion {
+		return err
+	}
+	entries, err := parseLootJSON(loot)
+	if err != nil {
+		return err
+	}
+	if n := len(parseMembers(members)); n > 0 {
+		xp *= n
+	}
+	if xp == 0 && len(entries) == 0 {
+		return nil
+	}
+	if _, err := q.Exec(
+		`INSERT INTO awards (campaign_id, encounter, minion_id, name, xp, loot, at)
+		 VALUES (?, (SELECT encounter FROM campaigns WHERE id = ?), ?, ?, ?, ?, ?)`,
+		campaignID, campaignID, id, name, xp, loot, time.Now().Unix()); err != nil {
+		return err
+	}
+	_, err = q.Exec(`UPDATE minions SET awarded = 1 WHERE id = ?`, id)
+	return err
+}
+
+// ledger is one encounter's awards added up. XP is split evenly between
+// the party's characters; coins and items are totalled. Turns says how
+// long each combatant's turns took.
+type ledger struct {
+	Encounter int
+	Current   bool
+	Awards    []award
+	XP        int
+	Party     int
+	PerPlayer int
+	Coins     []lootEntry
+	Items     []lootEntry
+	Turns     []turnStat
+}
+
+func currentEncounter(campaignID int64) (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT encounter FROM campaigns WHERE id = ?`, campaignID).Scan(&n)
+	return n, err
+}
+
+// loadLedger adds up an encounter's awards.
+func loadLedger(campaignID int64, encounter int) (*ledger, error) {
+	current, err := currentEncounter(campaignID)
+	if err != nil {
+		return nil, err
+	}
+	party, err := loadParty(campaignID)
+	if err != nil {
+		return nil, err
+	}
+	turns, err := loadTurnStats(campaignID, encounter)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT id, encounter, name, xp, loot, at FROM awards
+		WHERE campaign_id = ? AND encounter = ? ORDER BY at, id`, campaignID, encounter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	l := &ledger{Encounter: encounter, Current: encounter == current, Party: len(party), Turns: turns}
+	coins := map[string]int{}
+	items := map[string]int{}
+	var itemNames []string
+	for rows.Next() {
+		var a award
+		var loot string
+		var at int64
+		if err := rows.Scan(&a.ID, &a.Encounter, &a.Name, &a.XP, &loot, &at); err != nil {
+			return nil, err
+		}
+		if a.Loot, err = parseLootJSON(loot); err != nil {
+			return nil, err
+		}
+		a.At = time.Unix(at, 0)
+		l.Awards = append(l.Awards, a)
+		l.XP += a.XP
+		for _, e := range a.Loot {
+			if e.Coins {
+				coins[e.Name] += e.Quantity
+				continue
+			}
+			key := strings.ToLower(e.Name)
+			if _, ok := items[key]; !ok {
+				itemNames = append(itemNames, e.Name)
+			}
+			items[key] += e.Quantity
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if l.Party > 0 {
+		l.PerPlayer = l.XP / l.Party
+	}
+	for _, d := range coinDenominations {
+		if coins[d] > 0 {
+			l.Coins = append(l.Coins, lootEntry{Name: d, Quantity: coins[d], Coins: true})
+		}
+	}
+	sort.SliceStable(itemNames, func(i, j int) bool { return strings.ToLower(itemNames[i]) < strings.ToLower(itemNames[j]) })
+	for _, name := range itemNames {
+		l.Items = append(l.Items, lootEntry{Name: name, Quantity: items[strings.ToLower(name)]})
+	}
+	return l, nil
+}
+
+// endEncounter closes the running encounter, so later awards go to the
+// next one, and returns the number of the one it closed.
+func endEncounter(campaignID int64) (int, error) {
+	var ended int
+	err := db.QueryRow(`UPDATE campaigns SET encounter = encounter + 1 WHERE id = ? RETURNING encounter - 1`, campaignID).
+		Scan(&ended)
+	return ended, err
+}
+
+// Markdown renders the ledger for pasting into session notes.
+func (l *ledger) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Encounter %d\n\n", l.Encounter)
+	fmt.Fprintf(&b, "**XP:** %d", l.XP)
+	if l.Party > 0 {
+		fmt.Fprintf(&b, " (%d each for %d players)", l.PerPlayer, l.Party)
+	}
+	b.WriteString("\n\n## Defeated\n\n")
+	if len(l.Awards) == 0 {
+		b.WriteString("Nobody.\n")
+	} else {
+		b.WriteString("| Minion | XP | Loot |\n|---|---:|---|\n")
+		for _, a := range l.Awards {
+			fmt.Fprintf(&b, "| %s | %d | %s |\n", markdownCell(a.Name), a.XP, markdownCell(lootList(a.Loot)))
+		}
+	}
+	if len(l.Coins) > 0 || len(l.Items) > 0 {
+		b.WriteString("\n## Loot\n\n")
+		for _, e := range append(l.Coins, l.Items...) {
+			fmt.Fprintf(&b, "- %s\n", e)
+		}
+	}
+	if len(l.Turns) > 0 {
+		b.WriteString("\n## Turns\n\n| Combatant | Turns | Average | Longest |\n|---|---:|---:|---:|\n")
+		for _, s := range l.Turns {
+			fmt.Fprintf(&b, "| %s | %d | %s | %s |\n", markdownCell(s.Name), s.Turns, formatClock(s.Average()), formatClock(s.Longest))
+		}
+	}
+	return b.String()
+}
+
+// lootList joins loot for one line, e.g. "15 gp, Javelin ×2".
+func lootList(loot []lootEntry) string {
+	parts := make([]string, len(loot))
+	for i, e := range loot {
+		parts[i] = e.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// markdownCell keeps a value from breaking out of its table cell.
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// loadCurrentLedger adds up the running encounter.
+func loadCurrentLedger(campaignID int64) (*ledger, error) {
+	n, err := currentEncounter(campaignID)
+	if err != nil {
+		return nil, err
+	}
+	return loadLedger(campaignID, n)
+}
+
+func renderLedger(w http.ResponseWriter, c *Campaign, ended *ledger) {
+	l, err := loadCurrentLedger(c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "ledger", map[string]any{"Campaign": c, "Ledger": l, "Ended": ended})
+}
+
+func handleLedger(w http.ResponseWriter, r *http.Request) {
+	renderLedger(w, campaignFor(r), nil)
+}
+
+func handleEndEncounter(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	n, err := endEncounter(c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	ended, err := loadLedger(c.ID, n)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	renderLedger(w, c, ended)
+}
+
+// handleLedgerMarkdown downloads an encounter's ledger, the running one
+// unless ?encounter= says otherwise.
+func handleLedgerMarkdown(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	n, err := strconv.Atoi(r.URL.Query().Get("encounter"))
+	if err != nil || n < 1 {
+		if n, err = currentEncounter(c.ID); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	l, err := loadLedger(c.ID, n)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-encounter-%d.md"`, c.Slug, n))
+	fmt.Fprint(w, l.Markdown())
+}
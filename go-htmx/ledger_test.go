@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseLoot(t *testing.T) {
+	loot := parseLoot("15 GP\n  2 Javelins \nDagger x3\n\nPotion of Healing\n0 Arrows")
+	want := []lootEntry{
+		{Name: "gp", Quantity: 15, Coins: true},
+		{Name: "Javelins", Quantity: 2},
+		{Name: "Dagger", Quantity: 3},
+		{Name: "Potion of Healing", Quantity: 1},
+	}
+	if len(loot) != len(want) {
+		t.Fatalf("Expected %d entries, got %+v", len(want), loot)
+	}
+	for i := range want {
+		if loot[i] != want[i] {
+			t.Errorf("Entry %d = %+v, want %+v", i, loot[i], want[i])
+		}
+	}
+	if got := lootList(loot); got != "15 gp, Javelins ×2, Dagger ×3, Potion of Healing" {
+		t.Errorf("Unexpected loot list %q", got)
+	}
+	if loot := parseLoot(""); loot == nil || len(loot) != 0 {
+		t.Errorf("Expected an empty box to clear the loot, got %#v", loot)
+	}
+}
+
+func TestCreditDefeat(t *testing.T) {
+	testDB := useTestDB(t)
+
+	ogre := &Minion{Name: "Ogre", HP: 10, MaxHP: 59, Active: true, CR: "2",
+		Loot: []lootEntry{{Name: "gp", Quantity: 30, Coins: true}, {Name: "Greatclub", Quantity: 1}}}
+	if m := insertTestMinion(t, ogre); len(m.Loot) != 2 || m.Loot[0] != ogre.Loot[0] {
+		t.Fatalf("Expected the loot to be stored, got %+v", m.Loot)
+	}
+	if _, err := adjustHP(defaultCampaignID, ogre.ID, -20); err != nil {
+		t.Fatal(err)
+	}
+	// Dying twice or being dismissed afterwards credits nothing more
+	adjustHP(defaultCampaignID, ogre.ID, -5)
+	if err := deleteMinion(defaultCampaignID, ogre.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	mob := &Minion{Name: "Goblins", HP: 21, MaxHP: 21, Active: true, CR: "1/4", Members: []int{7, 7, 7}, Tags: []string{"ambush"}}
+	scout := &Minion{Name: "Scout", HP: 16, MaxHP: 16, Active: true, CR: "1/2", Tags: []string{"ambush"}}
+	commoner := &Minion{Name: "Commoner", HP: 4, MaxHP: 4, Active: true, CR: "0", XP: 10}
+	bandit := &Minion{Name: "Bandit", HP: 11, MaxHP: 11, Active: true, CR: "1/8"}
+	guard := &Minion{Name: "Guard", HP: 11, MaxHP: 11, Active: true, CR: "1/8", Tags: []string{"gate"}}
+	template := &Minion{Name: "Ogre", HP: 59, MaxHP: 59, CR: "2", Bestiary: true}
+	for _, m := range []*Minion{mob, scout, commoner, bandit, guard, template} {
+		insertTestMinion(t, m)
+	}
+	// Only the goblins fell; the scout got away and the commoner was
+	// never fought, so dismissing them credits nothing
+	adjustHP(defaultCampaignID, mob.ID, -21)
+	if n, err := dismissGroup(defaultCampaignID, "ambush", false); err != nil || n != 2 {
+		t.Fatalf("Expected the ambush to be dismissed, got %d, %v", n, err)
+	}
+	if events, _ := listEvents(defaultCampaignID, scout.ID); len(events) != 1 || events[0].Kind != eventDismissed ||
+		events[0].Detail != "group ambush" {
+		t.Errorf("Expected the group dismissal in the scout's history, got %+v", events)
+	}
+	deleteMinion(defaultCampaignID, commoner.ID, false)
+	// The bandit surrendered and the guard was never tracked to 0 HP, but
+	// both were defeated
+	if err := deleteMinion(defaultCampaignID, bandit.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := listEvents(defaultCampaignID, bandit.ID); len(events) != 1 || events[0].Detail != "defeated" {
+		t.Errorf("Expected the defeat in the bandit's history, got %+v", events)
+	}
+	if n, err := dismissGroup(defaultCampaignID, "gate", true); err != nil || n != 1 {
+		t.Fatalf("Expected the gate to be dismissed, got %d, %v", n, err)
+	}
+	if events, _ := listEvents(defaultCampaignID, guard.ID); len(events) != 1 || events[0].Detail != "group gate, defeated" {
+		t.Errorf("Expected the defeat in the guard's history, got %+v", events)
+	}
+	if err := creditDefeat(testDB, defaultCampaignID, template.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	setParty(defaultCampaignID, []int{3, 3, 3, 3})
+	l, err := loadCurrentLedger(defaultCampaignID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Awards) != 4 || l.Awards[0].Name != "Ogre" || l.Awards[1].XP != 150 || l.Awards[2].Name != "Bandit" ||
+		l.Awards[3].Name != "Guard" {
+		t.Fatalf("Expected the ogre, three goblins, the bandit and the guard, got %+v", l.Awards)
+	}
+	if l.XP != 650 || l.PerPlayer != 162 || !l.Current {
+		t.Errorf("Expected 650 XP, 162 each, got %d, %d", l.XP, l.PerPlayer)
+	}
+	if len(l.Coins) != 1 || l.Coins[0].Quantity != 30 || len(l.Items) != 1 || l.Items[0].Name != "Greatclub" {
+		t.Errorf("Unexpected loot %+v %+v", l.Coins, l.Items)
+	}
+}
+
+func TestLedgerMarkdown(t *testing.T) {
+	l := &ledger{
+		Encounter: 3, XP: 900, Party: 4, PerPlayer: 225,
+		Awards: []award{
+			{Name: "Ogre | Chief", XP: 450, Loot: []lootEntry{{Name: "gp", Quantity: 30, Coins: true}}},
+			{Name: "Ogre", XP: 450},
+		},
+		Coins: []lootEntry{{Name: "gp", Quantity: 30, Coins: true}},
+		Items: []lootEntry{{Name: "Javelin", Quantity: 4}},
+	}
+	md := l.Markdown()
+	for _, want := range []string{
+		"# Encounter 3\n",
+		"**XP:** 900 (225 each for 4 players)",
+		`| Ogre \| Chief | 450 | 30 gp |`,
+		"| Ogre | 450 |  |",
+		"## Loot\n\n- 30 gp\n- Javelin ×4\n",
+	} {
+		if !contains(md, want) {
+			t.Errorf("Expected %q in:\n%s", want, md)
+		}
+	}
+}
+
+func TestHandleLedger(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	_, playerToken := createTestUser(t, "pc", rolePlayer)
+
+	id := createTestMinion(t, testDB, &Minion{Name: "Bandit", HP: 11, MaxHP: 11})
+	form := url.Values{"name": {"Bandit"}, "hp": {"11"}, "max_hp": {"11"}, "ac": {"12"}, "attack": {"3"},
+		"cr": {"1/8"}, "xp": {""}, "loot": {"8 sp\nLight crossbow"}}
+	rec := serveAs(t, token, "PUT", "/c/default/minions/"+itoa64(id), strings.NewReader(form.Encode()))
+	if !contains(rec.Body.String(), "<strong>Loot</strong> 8 sp, Light crossbow") {
+		t.Errorf("Expected the loot on the row, got %s", rec.Body.String())
+	}
+	// Edits without the loot box keep the loot
+	serveAs(t, token, "PUT", "/c/default/minions/"+itoa64(id), strings.NewReader("name=Bandit&hp=11&max_hp=11&ac=12&attack=3"))
+	if m, _ := getMinion(defaultCampaignID, id); len(m.Loot) != 2 {
+		t.Errorf("Expected the loot to be kept, got %+v", m.Loot)
+	}
+
+	serveAs(t, token, "POST", "/c/default/minions/"+itoa64(id)+"/hp/dmg", strings.NewReader("amount=20"))
+	rec = serveAs(t, token, "GET", "/c/default/ledger", nil)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !contains(body, "<td>Bandit</td><td>25</td><td>8 sp, Light crossbow</td>") ||
+		!contains(body, "Ledger: encounter 1") {
+		t.Errorf("Expected the bandit in the ledger, got %d: %s", rec.Code, body)
+	}
+
+	rec = serveAs(t, token, "POST", "/c/default/ledger/end", nil)
+	if body := rec.Body.String(); !contains(body, "Encounter 1 is over") || !contains(body, "Ledger: encounter 2") ||
+		!contains(body, "Nobody has been defeated yet.") {
+		t.Errorf("Expected encounter 1's summary and an empty encounter 2, got %s", body)
+	}
+
+	rec = serveAs(t, token, "GET", "/c/default/ledger.md?encounter=1", nil)
+	if rec.Header().Get("Content-Type") != "text/markdown; charset=utf-8" ||
+		!contains(rec.Header().Get("Content-Disposition"), "default-encounter-1.md") ||
+		!contains(rec.Body.String(), "| Bandit | 25 | 8 sp, Light crossbow |") {
+		t.Errorf("Unexpected markdown %v: %s", rec.Header(), rec.Body.String())
+	}
+
+	// Encounter 2: a fleeing scout is dismissed, a surrendering thug is
+	// dismissed as defeated
+	for _, m := range []*Minion{{Name: "Scout", CR: "1/2"}, {Name: "Thug", CR: "1/2"}} {
+		m.HP, m.MaxHP, m.Active = 16, 16, true
+		insertTestMinion(t, m)
+		path := "/c/default/minions/" + itoa64(m.ID)
+		if m.Name == "Thug" {
+			path += "?defeated=1"
+		}
+		if rec := serveAs(t, token, "DELETE", path, nil); rec.Code != http.StatusOK {
+			t.Fatalf("Expected %s dismissed, got %d", m.Name, rec.Code)
+		}
+	}
+	if l, _ := loadCurrentLedger(defaultCampaignID); len(l.Awards) != 1 || l.Awards[0].Name != "Thug" {
+		t.Errorf("Expected only the defeated thug credited, got %+v", l.Awards)
+	}
+
+	if rec := serveAs(t, playerToken, "GET", "/c/default/ledger", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a player, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Page sizes for the minion list.
+const (
+	defaultPerPage = 50
+	maxPerPage     = 200
+)
+
+// HP status filters.
+const (
+	statusFull     = "full"
+	statusBloodied = "bloodied"
+	statusDown     = "down"
+)
+
+// minionStatusSQL holds the WHERE clause for each HP status. Bloodied
+// means at or below half HP but still standing.
+var minionStatusSQL = map[string]string{
+	statusFull:     `m.hp = m.max_hp`,
+	statusBloodied: `m.hp > 0 AND m.hp * 2 <= m.max_hp`,
+	statusDown:     `m.hp = 0`,
+}
+
+// minionSortSQL holds the ORDER BY expression for each sort key, and
+// whether that key sorts descending by default. Initiative runs highest
+// first, with minions that have not rolled last.
+var minionSortSQL = map[string]struct {
+	expr string
+	desc bool
+}{
+	"name":       {`m.name COLLATE NOCASE`, false},
+	"hp":         {`m.hp`, false},
+	"ac":         {`m.ac`, true},
+	"initiative": {`m.initiative`, true},
+}
+
+// minionQuery is the search, filter, sort and page requested for the
+// minion list. The zero value lists every active minion in id order.
+type minionQuery struct {
+	Search  string
+	Status  string
+	Tag     string
+	Group   bool // render in sections by tag
+	Sort    string
+	Dir     string // "asc" or "desc"; empty takes the sort's default
+	Page    int
+	PerPage int
+}
+
+// parseMinionQuery reads a minionQuery from URL parameters, dropping
+// values it does not recognise rather than failing.
+func parseMinionQuery(v url.Values) minionQuery {
+	q := minionQuery{
+		Search: strings.TrimSpace(v.Get("q")),
+		Status: v.Get("status"),
+		Tag:    strings.TrimSpace(v.Get("tag")),
+		Group:  v.Get("group") != "",
+		Sort:   v.Get("sort"),
+		Dir:    v.Get("dir"),
+	}
+	if _, ok := minionStatusSQL[q.Status]; !ok {
+		q.Status = ""
+	}
+	if _, ok := minionSortSQL[q.Sort]; !ok {
+		q.Sort = ""
+	}
+	if q.Dir != "asc" && q.Dir != "desc" {
+		q.Dir = ""
+	}
+	q.Page, _ = strconv.Atoi(v.Get("page"))
+	q.PerPage, _ = strconv.Atoi(v.Get("per_page"))
+	return q.normalize()
+}
+
+func (q minionQuery) normalize() minionQuery {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PerPage < 1 {
+		q.PerPage = defaultPerPage
+	}
+	q.PerPage = min(q.PerPage, maxPerPage)
+	return q
+}
+
+// Values encodes q back into URL parameters, leaving out defaults so links
+// stay short.
+func (q minionQuery) Values() url.Values {
+	v := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	set("q", q.Search)
+	set("status", q.Status)
+	set("tag", q.Tag)
+	if q.Group {
+		v.Set("group", "1")
+	}
+	set("sort", q.Sort)
+	set("dir", q.Dir)
+	if q.Page > 1 {
+		v.Set("page", strconv.Itoa(q.Page))
+	}
+	if q.PerPage != defaultPerPage {
+		v.Set("per_page", strconv.Itoa(q.PerPage))
+	}
+	return v
+}
+
+// WithPage returns the encoded query for another page of the same list.
+func (q minionQuery) WithPage(page int) string {
+	q.Page = page
+	return q.Values().Encode()
+}
+
+// likeEscaper escapes LIKE wildcards so a search matches them literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// clauses builds the WHERE and ORDER BY for q.
+func (q minionQuery) clauses(campaignID int64) (where string, args []any, order string) {
+	conds := []string{`m.campaign_id = ?`, `m.active = 1`, `m.kind = ?`}
+	args = []any{campaignID, kindMinion}
+	if q.Search != "" {
+		conds = append(conds, `m.name LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(q.Search)+"%")
+	}
+	if s, ok := minionStatusSQL[q.Status]; ok {
+		conds = append(conds, s)
+	}
+	if q.Tag != "" {
+		conds = append(conds, `EXISTS (SELECT 1 FROM minion_tags mt JOIN tags t ON t.id = mt.tag_id
+			WHERE mt.minion_id = m.id AND t.name = ?)`)
+		args = append(args, q.Tag)
+	}
+
+	order = `m.id`
+	if s, ok := minionSortSQL[q.Sort]; ok {
+		desc := s.desc
+		if q.Dir != "" {
+			desc = q.Dir == "desc"
+		}
+		dir := " ASC"
+		if desc {
+			dir = " DESC"
+		}
+		order = s.expr + ` IS NULL, ` + s.expr + dir + `, m.id`
+	}
+	return strings.Join(conds, " AND "), args, order
+}
+
+// minionPage is one page of a filtered minion list.
+type minionPage struct {
+	Minions []Minion
+	Total   int
+	Query   minionQuery
+}
+
+// Pages is the number of pages the list spans, at least one.
+func (p *minionPage) Pages() int {
+	return max(1, (p.Total+p.Query.PerPage-1)/p.Query.PerPage)
+}
+
+// PageNumbers lists every page for the pager.
+func (p *minionPage) PageNumbers() []int {
+	pages := make([]int, p.Pages())
+	for i := range pages {
+		pages[i] = i + 1
+	}
+	return pages
+}
+
+// listMinions returns the active minions matching q, filtered, sorted and
+// paged by SQLite.
+func listMinions(campaignID int64, q minionQuery) (*minionPage, error) {
+	q = q.normalize()
+	where, args, order := q.clauses(campaignID)
+
+	page := &minionPage{Query: q}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM minions m WHERE `+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(minionSelect+` WHERE `+where+` ORDER BY `+order+` LIMIT ? OFFSET ?`,
+		append(args, q.PerPage, (q.Page-1)*q.PerPage)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Minion
+		if err := scanMinion(rows, &m); err != nil {
+			return nil, err
+		}
+		page.Minions = append(page.Minions, m)
+	}
+	return page, rows.Err()
+}
+
+// minionListView loads everything the minion-filter and minion-results
+// templates need for q.
+func minionListView(c *Campaign, q minionQuery) (map[string]any, error) {
+	page, err := listMinions(c.ID, q)
+	if err != nil {
+		return nil, err
+	}
+	summaries, err := listTagSummaries(c.ID)
+	if err != nil {
+		return nil, err
+	}
+	view := map[string]any{"Campaign": c, "Page": page, "Tags": summaries}
+	if page.Query.Group {
+		view["Groups"] = groupMinions(page.Minions, summaries)
+	}
+	return view, nil
+}
+
+// handleMinionList renders just the list and pager for htmx, and pushes
+// the matching full-page URL so reloads and shared links keep the filter.
+func handleMinionList(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	view, err := minionListView(c, parseMinionQuery(r.URL.Query()))
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	push := "/c/" + c.Slug + "/"
+	if qs := view["Page"].(*minionPage).Query.Values().Encode(); qs != "" {
+		push += "?" + qs
+	}
+	w.Header().Set("HX-Push-Url", push)
+	tmpl.ExecuteTemplate(w, "minion-results", view)
+}
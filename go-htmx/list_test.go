@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// seedHorde creates a spread of minions for list queries
+func seedHorde(t *testing.T) {
+	t.Helper()
+
+	testDB := db
+	for _, m := range []*Minion{
+		{Name: "goblin archer", HP: 7, MaxHP: 7, AC: 13, Initiative: initiative(12)},
+		{Name: "Goblin Boss", HP: 10, MaxHP: 21, AC: 17, Initiative: initiative(18)},
+		{Name: "Orc", HP: 0, MaxHP: 15, AC: 13},
+		{Name: "Wolf", HP: 3, MaxHP: 11, AC: 13, Initiative: initiative(15)},
+		{Name: "100% Zombie", HP: 22, MaxHP: 22, AC: 8, Initiative: initiative(6)},
+	} {
+		createTestMinion(t, testDB, m)
+	}
+}
+
+func names(minions []Minion) []string {
+	out := make([]string, len(minions))
+	for i, m := range minions {
+		out[i] = m.Name
+	}
+	return out
+}
+
+func TestParseMinionQuery(t *testing.T) {
+	q := parseMinionQuery(url.Values{"q": {"  gob "}, "status": {"dying"}, "sort": {"hp; DROP TABLE"}, "dir": {"up"}, "page": {"-2"}, "per_page": {"5000"}})
+	want := minionQuery{Search: "gob", Page: 1, PerPage: maxPerPage}
+	if q != want {
+		t.Errorf("Expected %+v, got %+v", want, q)
+	}
+	if got := parseMinionQuery(url.Values{"sort": {"ac"}, "page": {"3"}}).Values().Encode(); got != "page=3&sort=ac" {
+		t.Errorf("Expected defaults left out of the encoded query, got %q", got)
+	}
+}
+
+func TestListMinionsFilters(t *testing.T) {
+	useTestDB(t)
+	seedHorde(t)
+
+	for _, tt := range []struct {
+		query minionQuery
+		want  []string
+	}{
+		{minionQuery{}, []string{"goblin archer", "Goblin Boss", "Orc", "Wolf", "100% Zombie"}},
+		{minionQuery{Search: "GOBLIN"}, []string{"goblin archer", "Goblin Boss"}},
+		{minionQuery{Search: "100%"}, []string{"100% Zombie"}},
+		{minionQuery{Search: "%"}, []string{"100% Zombie"}},
+		{minionQuery{Status: statusFull}, []string{"goblin archer", "100% Zombie"}},
+		{minionQuery{Status: statusBloodied}, []string{"Goblin Boss", "Wolf"}},
+		{minionQuery{Status: statusDown}, []string{"Orc"}},
+		{minionQuery{Sort: "name"}, []string{"100% Zombie", "goblin archer", "Goblin Boss", "Orc", "Wolf"}},
+		{minionQuery{Sort: "hp", Dir: "desc"}, []string{"100% Zombie", "Goblin Boss", "goblin archer", "Wolf", "Orc"}},
+		{minionQuery{Sort: "ac"}, []string{"Goblin Boss", "goblin archer", "Orc", "Wolf", "100% Zombie"}},
+		{minionQuery{Sort: "initiative"}, []string{"Goblin Boss", "Wolf", "goblin archer", "100% Zombie", "Orc"}},
+		{minionQuery{Sort: "initiative", Dir: "asc"}, []string{"100% Zombie", "goblin archer", "Wolf", "Goblin Boss", "Orc"}},
+		{minionQuery{Search: "goblin", Status: statusBloodied}, []string{"Goblin Boss"}},
+	} {
+		page, err := listMinions(defaultCampaignID, tt.query)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.query, err)
+		}
+		if got := names(page.Minions); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: expected %v, got %v", tt.query, tt.want, got)
+		}
+		if page.Total != len(tt.want) {
+			t.Errorf("%+v: expected total %d, got %d", tt.query, len(tt.want), page.Total)
+		}
+	}
+}
+
+func TestListMinionsPagination(t *testing.T) {
+	testDB := useTestDB(t)
+	for i := 0; i < 7; i++ {
+		createTestMinion(t, testDB, &Minion{Name: "Skeleton " + string(rune('A'+i)), HP: 13, MaxHP: 13})
+	}
+	dismissed := createTestMinion(t, testDB, &Minion{Name: "Skeleton Z", HP: 13, MaxHP: 13})
+	deleteMinion(defaultCampaignID, dismissed, false)
+
+	page, err := listMinions(defaultCampaignID, minionQuery{Sort: "name", Page: 3, PerPage: 3})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if page.Total != 7 || page.Pages() != 3 {
+		t.Errorf("Expected 7 minions over 3 pages, got %d over %d", page.Total, page.Pages())
+	}
+	if got := names(page.Minions); !reflect.DeepEqual(got, []string{"Skeleton G"}) {
+		t.Errorf("Expected the last page to hold Skeleton G, got %v", got)
+	}
+
+	page, _ = listMinions(defaultCampaignID, minionQuery{Page: 9, PerPage: 3})
+	if len(page.Minions) != 0 || page.Total != 7 {
+		t.Errorf("Expected an empty page past the end, got %v", names(page.Minions))
+	}
+}
+
+func TestHandleMinionList(t *testing.T) {
+	useTestDB(t)
+	_, token := createTestUser(t, "pc", rolePlayer)
+	seedHorde(t)
+
+	rec := serveAs(t, token, "GET", "/c/default/minions?q=goblin&sort=name&bogus=1", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !contains(body, "Goblin Boss") || contains(body, "Wolf") || contains(body, "<html") {
+		t.Errorf("Expected just the filtered list fragment, got %s", body)
+	}
+	if push := rec.Header().Get("HX-Push-Url"); push != "/c/default/?q=goblin&sort=name" {
+		t.Errorf("Unexpected HX-Push-Url %q", push)
+	}
+
+	rec = serveAs(t, token, "GET", "/c/default/?status=down&per_page=1", nil)
+	body = rec.Body.String()
+	if !contains(body, "Orc") || contains(body, "Wolf") || !contains(body, `value="down" selected`) {
+		t.Errorf("Expected the full page filtered to the downed orc, got %s", body)
+	}
+
+	rec = serveAs(t, token, "GET", "/c/default/?per_page=2", nil)
+	if body := rec.Body.String(); !contains(body, "page 1 of 3") || !contains(body, "page=2&amp;per_page=2") {
+		t.Errorf("Expected a pager, got %s", body)
+	}
+}
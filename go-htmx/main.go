@@ -1,11 +1,15 @@
 package main
 
 import (
+	"database/sql"
 	"embed"
+	"errors"
 	"html/template"
-	"log"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
+	"strings"
 )
 
 //go:embed templates/*
@@ -15,8 +19,16 @@ var tmpl *template.Template
 
 func initTemplates() {
 	funcMap := template.FuncMap{
-		"div": func(a, b int) int { return a / b },
-		"le":  func(a, b int) bool { return a <= b },
+		"div":    func(a, b int) int { return a / b },
+		"le":     func(a, b int) bool { return a <= b },
+		"add":    func(a, b int) int { return a + b },
+		"join":   func(tags []string) string { return strings.Join(tags, tagSep+" ") },
+		"signed": signed,
+		"crs":    func() []string { return crValues },
+		"clock":  formatClock,
+		// path escapes a value for a URL built in an attribute html/template
+		// does not know to be one, such as hx-post
+		"path": url.PathEscape,
 	}
 	tmpl = template.Must(
 		template.New("").Funcs(funcMap).ParseFS(templateFS, "templates/*.html"),
@@ -24,32 +36,127 @@ func initTemplates() {
 }
 
 func main() {
-	initDB("minions.db")
-	initTemplates()
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
 
+// routes registers every handler behind the role it needs. Everything
+// about minions lives under /c/{campaign}/ and is only reachable by that
+// campaign's members: reading takes any member, summoning is open to
+// players, and changing an existing minion takes one of the campaign's GMs
+// or the player who summoned it.
+func routes() http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("GET /", handleIndex)
-	mux.HandleFunc("POST /minions", handleCreate)
-	mux.HandleFunc("GET /minions/{id}/edit", handleEditForm)
-	mux.HandleFunc("PUT /minions/{id}", handleUpdate)
-	mux.HandleFunc("DELETE /minions/{id}", handleDelete)
-	mux.HandleFunc("GET /minions/{id}/view", handleView)
-	mux.HandleFunc("GET /minions/{id}/hp/adjust", handleHPAdjustForm)
-	mux.HandleFunc("GET /minions/{id}/hp/cancel", handleHPCancel)
-	mux.HandleFunc("POST /minions/{id}/hp/heal", handleHeal)
-	mux.HandleFunc("POST /minions/{id}/hp/dmg", handleDmg)
-
-	log.Println("Listening on :8080")
-	log.Fatal(http.ListenAndServe(":8080", mux))
+	mux.HandleFunc("GET /login", handleLoginForm)
+	mux.HandleFunc("POST /login", handleLogin)
+	mux.HandleFunc("POST /logout", handleLogout)
+	mux.HandleFunc("GET /users", requireGM(handleUsers))
+	mux.HandleFunc("POST /users", requireGM(handleCreateUser))
+	mux.HandleFunc("GET /admin/snapshots", requireAdmin(handleSnapshots))
+	mux.HandleFunc("POST /admin/snapshot", requireAdmin(handleCreateSnapshot))
+	mux.HandleFunc("POST /admin/snapshots/{name}/restore", requireAdmin(handleRestoreSnapshot))
+
+	mux.HandleFunc("GET /{$}", requireUser(handleCampaigns))
+	mux.HandleFunc("POST /campaigns", requireGM(handleCreateCampaign))
+	mux.HandleFunc("GET /invite/{token}", requireUser(handleInviteForm))
+	mux.HandleFunc("POST /invite/{token}", requireUser(handleAcceptInvite))
+	mux.HandleFunc("POST /c/{campaign}/invites", requireCampaignGM(handleCreateInvite))
+	mux.HandleFunc("GET /c/{campaign}/export", requireCampaignGM(handleExport))
+	mux.HandleFunc("POST /c/{campaign}/import", requireCampaignGM(rosterChanged(handleImport)))
+	mux.HandleFunc("GET /c/{campaign}/minions.csv", requireMember(handleCSVExport))
+	mux.HandleFunc("POST /c/{campaign}/minions.csv", requireCampaignGM(rosterChanged(handleCSVImport)))
+
+	mux.HandleFunc("GET /c/{campaign}/bestiary", requireMember(handleBestiary))
+	mux.HandleFunc("POST /c/{campaign}/bestiary/import", requireCampaignGM(handleSRDImport))
+	mux.HandleFunc("POST /c/{campaign}/bestiary/spawn", requireMember(rosterChanged(handleSpawnFromBestiary)))
+	mux.HandleFunc("DELETE /c/{campaign}/bestiary/{id}", requireCampaignGM(handleDeleteBestiaryEntry))
+
+	mux.HandleFunc("GET /c/{campaign}/{$}", requireMember(handleIndex))
+	mux.HandleFunc("GET /c/{campaign}/minions", requireMember(handleMinionList))
+	mux.HandleFunc("POST /c/{campaign}/minions", requireMember(rosterChanged(handleCreate)))
+	mux.HandleFunc("GET /c/{campaign}/minions/export", requireMember(handleVTTExportAll))
+	mux.HandleFunc("GET /c/{campaign}/minions/{id}/export", requireMember(handleVTTExport))
+	mux.HandleFunc("GET /c/{campaign}/minions/{id}/edit", requireOwner(handleEditForm))
+	mux.HandleFunc("PUT /c/{campaign}/minions/{id}", requireOwner(rosterChanged(handleUpdate)))
+	mux.HandleFunc("DELETE /c/{campaign}/minions/{id}", requireOwner(rosterChanged(handleDelete)))
+	mux.HandleFunc("POST /c/{campaign}/tags/{tag}/{action}", requireCampaignGM(rosterChanged(handleGroupAction)))
+	mux.HandleFunc("POST /c/{campaign}/saves", requireCampaignGM(rosterChanged(handleGroupSave)))
+	mux.HandleFunc("GET /c/{campaign}/turns", requireMember(handleTurnOrder))
+	mux.HandleFunc("GET /c/{campaign}/encounter", requireCampaignGM(handleEncounter))
+	mux.HandleFunc("POST /c/{campaign}/party", requireCampaignGM(handleSetParty))
+	mux.HandleFunc("GET /c/{campaign}/ledger", requireCampaignGM(handleLedger))
+	mux.HandleFunc("GET /c/{campaign}/ledger.md", requireCampaignGM(handleLedgerMarkdown))
+	mux.HandleFunc("POST /c/{campaign}/ledger/end", requireCampaignGM(handleEndEncounter))
+	mux.HandleFunc("POST /c/{campaign}/turns/next", requireCampaignGM(handleNextTurn))
+	mux.HandleFunc("POST /c/{campaign}/turns/end", requireCampaignGM(handleEndCombat))
+	mux.HandleFunc("POST /c/{campaign}/turns/limit", requireCampaignGM(handleTurnLimit))
+	mux.HandleFunc("GET /c/{campaign}/combatants", requireCampaignGM(handleCombatants))
+	mux.HandleFunc("POST /c/{campaign}/combatants", requireCampaignGM(handleAddCombatant))
+	mux.HandleFunc("PUT /c/{campaign}/combatants/{id}", requireCampaignGM(handleUpdateCombatant))
+	mux.HandleFunc("DELETE /c/{campaign}/combatants/{id}", requireCampaignGM(handleRemoveCombatant))
+	mux.HandleFunc("POST /c/{campaign}/combatants/{id}/{action}", requireCampaignGM(handleCombatantHP))
+	mux.HandleFunc("GET /c/{campaign}/turns/clock", requireMember(handleTurnClock))
+	mux.HandleFunc("POST /c/{campaign}/rest/{kind}", requireCampaignGM(handleCampaignRest))
+	mux.HandleFunc("POST /c/{campaign}/minions/{id}/mob", requireCampaignGM(handleCollapseMob))
+	mux.HandleFunc("POST /c/{campaign}/minions/{id}/mob/attack", requireMember(handleMobAttack))
+	mux.HandleFunc("POST /c/{campaign}/minions/{id}/deathsave", requireOwner(rosterChanged(handleDeathSave)))
+	mux.HandleFunc("POST /c/{campaign}/minions/{id}/save", requireOwner(handleSave))
+	mux.HandleFunc("POST /c/{campaign}/minions/{id}/concentration", requireOwner(handleConcentration))
+	mux.HandleFunc("POST /c/{campaign}/minions/{id}/attacks/roll", requireMember(handleRollAttacks))
+	mux.HandleFunc("POST /c/{campaign}/minions/{id}/resources/{rid}/{action}", requireOwner(handleResource))
+	mux.HandleFunc("POST /c/{campaign}/minions/{id}/rest/{kind}", requireOwner(handleRest))
+	mux.HandleFunc("GET /c/{campaign}/minions/{id}/history", requireMember(handleHistory))
+	mux.HandleFunc("GET /c/{campaign}/minions/{id}/view", requireMember(handleView))
+	mux.HandleFunc("GET /c/{campaign}/minions/{id}/hp/adjust", requireOwner(handleHPAdjustForm))
+	mux.HandleFunc("GET /c/{campaign}/minions/{id}/hp/cancel", requireMember(handleHPCancel))
+	mux.HandleFunc("POST /c/{campaign}/minions/{id}/hp/heal", requireOwner(rosterChanged(handleHeal)))
+	mux.HandleFunc("POST /c/{campaign}/minions/{id}/hp/dmg", requireOwner(rosterChanged(handleDmg)))
+
+	return loadSession(csrfProtect(mux))
 }
 
 func handleIndex(w http.ResponseWriter, r *http.Request) {
-	minions, err := listActiveMinions()
+	c := campaignFor(r)
+	if c == nil {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := minionListView(c, parseMinionQuery(r.URL.Query()))
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	bestiary, err := listBestiary(c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	turns, err := loadTurnOrder(db, c.ID)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
-	data := map[string]any{"Minions": minions}
+	data["Bestiary"] = bestiary
+	encounter, err := loadEncounter(c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	ledger, err := loadCurrentLedger(c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	combatants, err := listCombatants(c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	data["Turns"] = turns
+	data["Encounter"] = encounter
+	data["Ledger"] = ledger
+	data["Combatants"] = combatants
+	data["User"] = currentUser(r)
+	data["CSRFToken"] = csrfToken(r)
 	tmpl.ExecuteTemplate(w, "layout.html", data)
 }
 
@@ -58,6 +165,11 @@ func handleCreate(w http.ResponseWriter, r *http.Request) {
 	hp, _ := strconv.Atoi(r.FormValue("hp"))
 	ac, _ := strconv.Atoi(r.FormValue("ac"))
 	atk, _ := strconv.Atoi(r.FormValue("attack"))
+	tags, err := parseTags(r.FormValue("tags"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	m := &Minion{
 		Name:   r.FormValue("name"),
@@ -67,8 +179,17 @@ func handleCreate(w http.ResponseWriter, r *http.Request) {
 		Attack: atk,
 		Damage: r.FormValue("damage"),
 		Notes:  r.FormValue("notes"),
+		Tags:   tags,
 	}
-	if err := createMinion(m); err != nil {
+	if u := currentUser(r); u != nil {
+		m.OwnerID = u.ID
+	}
+	c := campaignFor(r)
+	if c == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := createMinion(c.ID, m); err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
@@ -77,7 +198,7 @@ func handleCreate(w http.ResponseWriter, r *http.Request) {
 
 func handleEditForm(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
-	m, err := getMinion(id)
+	m, err := getMinion(campaignID(r), id)
 	if err != nil {
 		http.Error(w, "not found", 404)
 		return
@@ -89,7 +210,7 @@ func handleUpdate(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
 
 	// Check if minion exists
-	_, err := getMinion(id)
+	existing, err := getMinion(campaignID(r), id)
 	if err != nil {
 		http.Error(w, "not found", 404)
 		return
@@ -100,6 +221,60 @@ func handleUpdate(w http.ResponseWriter, r *http.Request) {
 	maxHP, _ := strconv.Atoi(r.FormValue("max_hp"))
 	ac, _ := strconv.Atoi(r.FormValue("ac"))
 	atk, _ := strconv.Atoi(r.FormValue("attack"))
+	version, _ := strconv.ParseInt(r.FormValue("version"), 10, 64)
+	var initiative *int
+	if n, err := strconv.Atoi(r.FormValue("initiative")); err == nil {
+		initiative = &n
+	}
+	// Forms that leave the tags field out keep the minion's tags.
+	tags := existing.Tags
+	if _, ok := r.Form["tags"]; ok {
+		if tags, err = parseTags(r.FormValue("tags")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !validDeathPolicy(r.FormValue("death_policy")) {
+		r.Form.Del("death_policy")
+	}
+	// Likewise for scores and saves. Unticked save boxes send nothing, so
+	// the proficiency bonus field says whether the saves were on the form.
+	scores, saves, profBonus := existing.Scores, existing.Saves, existing.ProfBonus
+	for i, code := range abilityCodes {
+		if n, err := strconv.Atoi(r.FormValue(code)); err == nil && n > 0 {
+			scores[i] = n
+		}
+	}
+	if n, err := strconv.Atoi(r.FormValue("prof_bonus")); err == nil && n > 0 {
+		profBonus = n
+		saves = append([]string{}, normalizeSaves(r.Form["saves"])...)
+	}
+	// The first named attack is the one the row and the mob rules use.
+	attacks := existing.Attacks
+	if parsed := parseAttackForm(r); parsed != nil {
+		attacks = parsed
+	}
+	if len(attacks) > 0 {
+		atk, r.Form["damage"] = attacks[0].ToHit, []string{attacks[0].Damage}
+	}
+	resources := existing.Resources
+	if parsed := parseResourceForm(r); parsed != nil {
+		resources = parsed
+	}
+	// Forms that leave the loot box out keep the minion's loot.
+	loot := existing.Loot
+	if _, ok := r.Form["loot"]; ok {
+		loot = parseLoot(r.FormValue("loot"))
+	}
+	// A blank XP field means the CR's standard XP.
+	cr, xp := existing.CR, existing.XP
+	if v, ok := parseCR(r.FormValue("cr")); ok {
+		cr, xp = v, crXP[v]
+		if n, err := strconv.Atoi(r.FormValue("xp")); err == nil && n > 0 {
+			xp = n
+		}
+	}
 
 	m := &Minion{
 		ID:     id,
@@ -111,8 +286,37 @@ func handleUpdate(w http.ResponseWriter, r *http.Request) {
 		Damage: r.FormValue("damage"),
 		Notes:  r.FormValue("notes"),
 		Active: true,
+
+		Initiative: initiative,
+		Tags:       tags,
+		Version:    version,
+
+		Scores:    scores,
+		Saves:     saves,
+		ProfBonus: profBonus,
+		Attacks:   attacks,
+		Resources: resources,
+		CR:        cr,
+		XP:        xp,
+		Loot:      loot,
+
+		DeathPolicy: r.FormValue("death_policy"),
+		OwnerID:     existing.OwnerID,
+		CampaignID:  existing.CampaignID,
+		Campaign:    existing.Campaign,
+	}
+	err = updateMinion(campaignID(r), m)
+	if errors.Is(err, errConflict) {
+		current, err := getMinion(campaignID(r), id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.WriteHeader(http.StatusConflict)
+		tmpl.ExecuteTemplate(w, "minion-conflict", map[string]any{"Mine": m, "Current": current})
+		return
 	}
-	if err := updateMinion(m); err != nil {
+	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
@@ -121,7 +325,15 @@ func handleUpdate(w http.ResponseWriter, r *http.Request) {
 
 func handleDelete(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
-	if err := deleteMinion(id); err != nil {
+	if err := deleteMinion(campaignID(r), id, r.FormValue("defeated") != ""); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "not found", 404)
+			return
+		}
+		if errors.Is(err, errNotMinion) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), 500)
 		return
 	}
@@ -130,7 +342,7 @@ func handleDelete(w http.ResponseWriter, r *http.Request) {
 
 func handleView(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
-	m, err := getMinion(id)
+	m, err := getMinion(campaignID(r), id)
 	if err != nil {
 		http.Error(w, "not found", 404)
 		return
@@ -140,7 +352,7 @@ func handleView(w http.ResponseWriter, r *http.Request) {
 
 func handleHPAdjustForm(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
-	m, err := getMinion(id)
+	m, err := getMinion(campaignID(r), id)
 	if err != nil {
 		http.Error(w, "not found", 404)
 		return
@@ -150,7 +362,7 @@ func handleHPAdjustForm(w http.ResponseWriter, r *http.Request) {
 
 func handleHPCancel(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
-	m, err := getMinion(id)
+	m, err := getMinion(campaignID(r), id)
 	if err != nil {
 		http.Error(w, "not found", 404)
 		return
@@ -163,7 +375,15 @@ func handleHeal(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	amount, _ := strconv.Atoi(r.FormValue("amount"))
 
-	m, err := adjustHP(id, amount)
+	m, err := adjustMemberHP(campaignID(r), id, memberParam(r), amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if errors.Is(err, errNoMember) || errors.Is(err, errNotMob) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
@@ -176,7 +396,15 @@ func handleDmg(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	amount, _ := strconv.Atoi(r.FormValue("amount"))
 
-	m, err := adjustHP(id, -amount)
+	m, err := adjustMemberHP(campaignID(r), id, memberParam(r), -amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if errors.Is(err, errNoMember) || errors.Is(err, errNotMob) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
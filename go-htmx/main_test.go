@@ -27,7 +27,7 @@ func TestHandleIndex(t *testing.T) {
 	req := httptest.NewRequest("GET", "/", nil)
 	rec := httptest.NewRecorder()
 
-	handleIndex(rec, req)
+	handleIndex(rec, asGM(t, req))
 
 	// Verify response
 	if rec.Code != http.StatusOK {
@@ -76,7 +76,7 @@ func TestHandleCreate(t *testing.T) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rec := httptest.NewRecorder()
 
-	handleCreate(rec, req)
+	handleCreate(rec, asGM(t, req))
 
 	if rec.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", rec.Code)
@@ -91,7 +91,7 @@ func TestHandleCreate(t *testing.T) {
 	}
 
 	// Verify minion was created in database
-	minions, _ := listActiveMinions()
+	minions, _ := listActiveMinions(defaultCampaignID)
 	if len(minions) != 1 {
 		t.Errorf("Expected 1 minion in database, got %d", len(minions))
 	}
@@ -114,7 +114,7 @@ func TestHandleEditForm(t *testing.T) {
 	req.SetPathValue("id", "1")
 	rec := httptest.NewRecorder()
 
-	handleEditForm(rec, req)
+	handleEditForm(rec, asGM(t, req))
 
 	if rec.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", rec.Code)
@@ -159,7 +159,7 @@ func TestHandleUpdate(t *testing.T) {
 	req.SetPathValue("id", "1")
 	rec := httptest.NewRecorder()
 
-	handleUpdate(rec, req)
+	handleUpdate(rec, asGM(t, req))
 
 	if rec.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", rec.Code)
@@ -171,7 +171,7 @@ func TestHandleUpdate(t *testing.T) {
 	}
 
 	// Verify update in database
-	minion, _ := getMinion(id)
+	minion, _ := getMinion(defaultCampaignID, id)
 	if minion.Name != "Updated" {
 		t.Errorf("Expected name 'Updated', got %q", minion.Name)
 	}
@@ -197,14 +197,14 @@ func TestHandleDelete(t *testing.T) {
 	req.SetPathValue("id", "1")
 	rec := httptest.NewRecorder()
 
-	handleDelete(rec, req)
+	handleDelete(rec, asGM(t, req))
 
 	if rec.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", rec.Code)
 	}
 
 	// Verify minion is soft-deleted
-	minions, _ := listActiveMinions()
+	minions, _ := listActiveMinions(defaultCampaignID)
 	for _, m := range minions {
 		if m.ID == id {
 			t.Error("Expected minion to be excluded from active list")
@@ -229,7 +229,7 @@ func TestHandleView(t *testing.T) {
 	req.SetPathValue("id", "1")
 	rec := httptest.NewRecorder()
 
-	handleView(rec, req)
+	handleView(rec, asGM(t, req))
 
 	if rec.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", rec.Code)
@@ -268,7 +268,7 @@ func TestHandle404s(t *testing.T) {
 			req.SetPathValue("id", "999")
 			rec := httptest.NewRecorder()
 
-			tt.handler(rec, req)
+			tt.handler(rec, asGM(t, req))
 
 			if rec.Code != http.StatusNotFound {
 				t.Errorf("Expected status 404, got %d", rec.Code)
@@ -319,14 +319,14 @@ func TestFullCRUDWorkflow(t *testing.T) {
 	req := httptest.NewRequest("POST", "/minions", strings.NewReader(form.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rec := httptest.NewRecorder()
-	handleCreate(rec, req)
+	handleCreate(rec, asGM(t, req))
 
 	if rec.Code != 200 {
 		t.Fatalf("Create failed with status %d", rec.Code)
 	}
 
 	// Read
-	minions, _ := listActiveMinions()
+	minions, _ := listActiveMinions(defaultCampaignID)
 	if len(minions) != 1 {
 		t.Fatalf("Expected 1 minion, got %d", len(minions))
 	}
@@ -344,7 +344,7 @@ func TestFullCRUDWorkflow(t *testing.T) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.SetPathValue("id", "1")
 	rec = httptest.NewRecorder()
-	handleUpdate(rec, req)
+	handleUpdate(rec, asGM(t, req))
 
 	if rec.Code != 200 {
 		t.Fatalf("Update failed with status %d", rec.Code)
@@ -354,14 +354,14 @@ func TestFullCRUDWorkflow(t *testing.T) {
 	req = httptest.NewRequest("DELETE", "/minions/1", nil)
 	req.SetPathValue("id", "1")
 	rec = httptest.NewRecorder()
-	handleDelete(rec, req)
+	handleDelete(rec, asGM(t, req))
 
 	if rec.Code != 200 {
 		t.Fatalf("Delete failed with status %d", rec.Code)
 	}
 
 	// Verify deleted
-	minions, _ = listActiveMinions()
+	minions, _ = listActiveMinions(defaultCampaignID)
 	if len(minions) != 0 {
 		t.Errorf("Expected 0 active minions after delete, got %d", len(minions))
 	}
@@ -391,14 +391,14 @@ func TestHandleHeal(t *testing.T) {
 	req.SetPathValue("id", "1")
 	rec := httptest.NewRecorder()
 
-	handleHeal(rec, req)
+	handleHeal(rec, asGM(t, req))
 
 	if rec.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", rec.Code)
 	}
 
 	// Verify HP increased to 13
-	minion, _ := getMinion(id)
+	minion, _ := getMinion(defaultCampaignID, id)
 	if minion.HP != 13 {
 		t.Errorf("Expected HP 13, got %d", minion.HP)
 	}
@@ -432,14 +432,14 @@ func TestHandleDmg(t *testing.T) {
 	req.SetPathValue("id", "1")
 	rec := httptest.NewRecorder()
 
-	handleDmg(rec, req)
+	handleDmg(rec, asGM(t, req))
 
 	if rec.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", rec.Code)
 	}
 
 	// Verify HP decreased to 6
-	minion, _ := getMinion(id)
+	minion, _ := getMinion(defaultCampaignID, id)
 	if minion.HP != 6 {
 		t.Errorf("Expected HP 6, got %d", minion.HP)
 	}
@@ -469,7 +469,7 @@ func TestHPAdjustTemplateStructure(t *testing.T) {
 	req.SetPathValue("id", "1")
 	rec := httptest.NewRecorder()
 
-	handleHPAdjustForm(rec, req)
+	handleHPAdjustForm(rec, asGM(t, req))
 
 	body := rec.Body.String()
 
@@ -513,7 +513,7 @@ func TestHPAdjustmentWorkflow(t *testing.T) {
 	req := httptest.NewRequest("GET", "/minions/1/hp/adjust", nil)
 	req.SetPathValue("id", "1")
 	rec := httptest.NewRecorder()
-	handleHPAdjustForm(rec, req)
+	handleHPAdjustForm(rec, asGM(t, req))
 
 	if rec.Code != 200 {
 		t.Fatalf("Failed to get adjust form: status %d", rec.Code)
@@ -526,9 +526,9 @@ func TestHPAdjustmentWorkflow(t *testing.T) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.SetPathValue("id", "1")
 	rec = httptest.NewRecorder()
-	handleHeal(rec, req)
+	handleHeal(rec, asGM(t, req))
 
-	minion, _ := getMinion(id)
+	minion, _ := getMinion(defaultCampaignID, id)
 	if minion.HP != 13 {
 		t.Errorf("After heal: expected HP 13, got %d", minion.HP)
 	}
@@ -540,9 +540,9 @@ func TestHPAdjustmentWorkflow(t *testing.T) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.SetPathValue("id", "1")
 	rec = httptest.NewRecorder()
-	handleDmg(rec, req)
+	handleDmg(rec, asGM(t, req))
 
-	minion, _ = getMinion(id)
+	minion, _ = getMinion(defaultCampaignID, id)
 	if minion.HP != 8 {
 		t.Errorf("After damage: expected HP 8, got %d", minion.HP)
 	}
@@ -554,9 +554,9 @@ func TestHPAdjustmentWorkflow(t *testing.T) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.SetPathValue("id", "1")
 	rec = httptest.NewRecorder()
-	handleHeal(rec, req)
+	handleHeal(rec, asGM(t, req))
 
-	minion, _ = getMinion(id)
+	minion, _ = getMinion(defaultCampaignID, id)
 	if minion.HP != 15 {
 		t.Errorf("After heal beyond max: expected HP 15 (capped), got %d", minion.HP)
 	}
@@ -568,9 +568,9 @@ func TestHPAdjustmentWorkflow(t *testing.T) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.SetPathValue("id", "1")
 	rec = httptest.NewRecorder()
-	handleDmg(rec, req)
+	handleDmg(rec, asGM(t, req))
 
-	minion, _ = getMinion(id)
+	minion, _ = getMinion(defaultCampaignID, id)
 	if minion.HP != 0 {
 		t.Errorf("After damage below zero: expected HP 0 (floored), got %d", minion.HP)
 	}
@@ -579,7 +579,7 @@ func TestHPAdjustmentWorkflow(t *testing.T) {
 	req = httptest.NewRequest("GET", "/minions/1/hp/cancel", nil)
 	req.SetPathValue("id", "1")
 	rec = httptest.NewRecorder()
-	handleHPCancel(rec, req)
+	handleHPCancel(rec, asGM(t, req))
 
 	if rec.Code != 200 {
 		t.Errorf("Cancel failed: status %d", rec.Code)
@@ -590,3 +590,46 @@ func TestHPAdjustmentWorkflow(t *testing.T) {
 		t.Error("Expected cancel to return hp-stat element")
 	}
 }
+
+func TestHandleUpdateConflict(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	id := createTestMinion(t, testDB, &Minion{Name: "Orc", HP: 15, MaxHP: 15, AC: 13, Attack: 5})
+	path := "/c/default/minions/" + itoa64(id)
+
+	rec := serveAs(t, token, "GET", path+"/edit", nil)
+	if !contains(rec.Body.String(), `name="version" value="1"`) {
+		t.Fatalf("Expected the edit form to carry the version, got %s", rec.Body.String())
+	}
+
+	form := url.Values{"name": {"Orc Chief"}, "hp": {"15"}, "max_hp": {"15"}, "ac": {"13"}, "attack": {"5"}, "version": {"1"}}
+	if rec := serveAs(t, token, "PUT", path, strings.NewReader(form.Encode())); rec.Code != http.StatusOK {
+		t.Fatalf("Expected first save to succeed, got %d", rec.Code)
+	}
+
+	// A second GM saves from the same stale form
+	form.Set("name", "Orc Warlord")
+	form.Set("ac", "18")
+	rec = serveAs(t, token, "PUT", path, strings.NewReader(form.Encode()))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 for stale save, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"Orc Warlord", "Orc Chief", `name="version" value="2"`, "Overwrite with mine"} {
+		if !contains(body, want) {
+			t.Errorf("Expected conflict fragment to contain %q", want)
+		}
+	}
+	if m, _ := getMinion(defaultCampaignID, id); m.Name != "Orc Chief" {
+		t.Errorf("Expected the stale save to be rejected, got %q", m.Name)
+	}
+
+	// Overwriting from the conflict fragment uses the current version
+	form.Set("version", "2")
+	if rec := serveAs(t, token, "PUT", path, strings.NewReader(form.Encode())); rec.Code != http.StatusOK {
+		t.Errorf("Expected overwrite to succeed, got %d", rec.Code)
+	}
+	if m, _ := getMinion(defaultCampaignID, id); m.Name != "Orc Warlord" || m.AC != 18 {
+		t.Errorf("Expected overwrite to land, got %+v", m)
+	}
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// anyMember lets damage overflow from one mob member to the next instead
+// of landing on a chosen one.
+const anyMember = -1
+
+var (
+	errNotMob      = errors.New("minion is not a mob")
+	errNoMember    = errors.New("mob has no such member")
+	errNoIdentical = errors.New("no identical minions to collapse into a mob")
+	errMobBase     = errors.New("only a living minion can gather a mob")
+)
+
+// IsMob reports whether m tracks several identical creatures as one row.
+func (m Minion) IsMob() bool {
+	return len(m.Members) > 0
+}
+
+// MemberMaxHP is the maximum HP of one member of a mob.
+func (m Minion) MemberMaxHP() int {
+	if !m.IsMob() {
+		return m.MaxHP
+	}
+	return m.MaxHP / len(m.Members)
+}
+
+// Survivors counts the mob members still standing.
+func (m Minion) Survivors() int {
+	n := 0
+	for _, hp := range m.Members {
+		if hp > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// parseMembers reads the members column, a comma-separated list of HP.
+func parseMembers(s sql.NullString) []int {
+	if !s.Valid || s.String == "" {
+		return nil
+	}
+	parts := strings.Split(s.String, ",")
+	members := make([]int, len(parts))
+	for i, p := range parts {
+		members[i], _ = strconv.Atoi(p)
+	}
+	return members
+}
+
+func encodeMembers(members []int) any {
+	if len(members) == 0 {
+		return nil
+	}
+	parts := make([]string, len(members))
+	for i, hp := range members {
+		parts[i] = strconv.Itoa(hp)
+	}
+	return strings.Join(parts, ",")
+}
+
+func sumHP(members []int) int {
+	total := 0
+	for _, hp := range members {
+		total += hp
+	}
+	return total
+}
+
+// applyMobHP changes members in place. Damage to anyMember fills the
+// first standing member and overflows into the next; healing tops up
+// standing members in order. A chosen member takes the whole change, which
+// is also the only way to bring a fallen member back.
+func applyMobHP(members []int, memberMax, member, delta int) error {
+	if member != anyMember {
+		if member < 0 || member >= len(members) {
+			return errNoMember
+		}
+		members[member] = max(0, min(members[member]+delta, memberMax))
+		return nil
+	}
+	for i := range members {
+		if delta == 0 {
+			break
+		}
+		if members[i] == 0 {
+			continue
+		}
+		if delta < 0 {
+			take := min(-delta, members[i])
+			members[i] -= take
+			delta += take
+		} else {
+			give := min(delta, memberMax-members[i])
+			members[i] += give
+			delta -= give
+		}
+	}
+	return nil
+}
+
+// adjustMemberHP applies a relative HP change to a minion, or to one
+// member of a mob.
+func adjustMemberHP(campaignID, id int64, member, delta int) (*Minion, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := adjustHPTx(tx, campaignID, id, member, delta); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return getMinion(campaignID, id)
+}
+
+// adjustHPTx applies an HP change within a transaction, following the
+// minion's death policy and recording what happened in its history.
+func adjustHPTx(q querier, campaignID, id int64, member, delta int) error {
+	var raw sql.NullString
+	if err := q.QueryRow(`SELECT members FROM minions WHERE campaign_id = ? AND id = ?`, campaignID, id).
+		Scan(&raw); err != nil {
+		return err
+	}
+	members := parseMembers(raw)
+	if members == nil {
+		if member != anyMember {
+			return errNotMob
+		}
+		s, err := loadLifeState(q, campaignID, id)
+		if err != nil {
+			return err
+		}
+		next, events := applyHPChange(s, delta)
+		if err := storeLifeState(q, campaignID, id, next, events); err != nil {
+			return err
+		}
+		if delta < 0 && !s.Dead {
+			return checkConcentration(q, campaignID, id, -delta, next)
+		}
+		return nil
+	}
+	return adjustMobTx(q, campaignID, id, members, member, delta)
+}
+
+// adjustMobTx applies an HP change to a mob. Members simply die at 0
+// whatever the policy, and the mob is dead once none are left standing.
+func adjustMobTx(q querier, campaignID, id int64, members []int, member, delta int) error {
+	s, err := loadLifeState(q, campaignID, id)
+	if err != nil {
+		return err
+	}
+	before, standing := s.HP, Minion{Members: members}.Survivors()
+	if err := applyMobHP(members, s.MaxHP/len(members), member, delta); err != nil {
+		return err
+	}
+	s.HP = sumHP(members)
+
+	var events []minionEvent
+	fell := standing - Minion{Members: members}.Survivors()
+	switch {
+	case s.HP < before:
+		e := minionEvent{Kind: eventDamage, Amount: -delta}
+		if fell > 0 {
+			e.Detail = strconv.Itoa(fell) + " fell"
+		}
+		events = append(events, e)
+	case s.HP > before:
+		events = append(events, minionEvent{Kind: eventHeal, Amount: s.HP - before})
+	}
+	switch {
+	case s.HP == 0 && !s.Dead && before > 0:
+		s.Dead = true
+		events = append(events, minionEvent{Kind: eventDied, Amount: -delta - before})
+	case s.HP > 0 && s.Dead:
+		s.Dead = false
+		events = append(events, minionEvent{Kind: eventRevived})
+	}
+	if err := storeLifeState(q, campaignID, id, s, events); err != nil {
+		return err
+	}
+	_, err = q.Exec(`UPDATE minions SET members = ? WHERE id = ?`, encodeMembers(members), id)
+	return err
+}
+
+// spawnMob puts count members of a bestiary entry into play as one mob.
+func spawnMob(campaignID, id int64, count int, ownerID int64) (*Minion, error) {
+	entry, err := getMinion(campaignID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.Bestiary {
+		return nil, sql.ErrNoRows
+	}
+	m := *entry
+	m.Members = make([]int, count)
+	for i := range m.Members {
+		m.Members[i] = entry.MaxHP
+	}
+	m.HP, m.MaxHP = entry.MaxHP*count, entry.MaxHP*count
+	m.Active, m.Bestiary, m.OwnerID = true, false, ownerID
+	return &m, insertMinion(db, campaignID, &m)
+}
+
+// spawnNumber is the " 3" spawnFromBestiary appends to numbered copies.
+var spawnNumber = regexp.MustCompile(` \d+$`)
+
+// mobName is the name of a minion with any spawn number removed.
+func mobName(name string) string {
+	return spawnNumber.ReplaceAllString(name, "")
+}
+
+// errMobStatBlocks refuses a collapse where a minion of the same name and
+// stats has a stat block of its own, which the mob would lose.
+type errMobStatBlocks struct{ Name string }
+
+func (e errMobStatBlocks) Error() string {
+	return fmt.Sprintf("%s's attacks, resources, scores or XP differ; edit them to match before collapsing", e.Name)
+}
+
+// sameStatBlock reports whether a and b would play the same as members of
+// one mob: the same attacks, the same resources apart from uses left, and
+// the same scores and worth.
+func sameStatBlock(a, b *Minion) bool {
+	defs := func(m *Minion) []resource {
+		out := make([]resource, len(m.Resources))
+		for i, r := range m.Resources {
+			r.ID, r.Current = 0, 0
+			out[i] = r
+		}
+		return out
+	}
+	return slices.Equal(a.Attacks, b.Attacks) && slices.Equal(defs(a), defs(b)) &&
+		a.Scores == b.Scores && slices.Equal(a.Saves, b.Saves) && a.ProfBonus == b.ProfBonus &&
+		a.CR == b.CR && a.XP == b.XP
+}
+
+// collapseMob folds every living active minion identical to id - same name
+// apart from its spawn number, same stats and same max HP per member - into
+// id as members of one mob, dismissing the others. id may already be a mob
+// but must be a living minion. The mob takes on the absorbed minions' tags
+// and loot; if any of them has a stat block of its own the collapse is
+// refused rather than lose it.
+func collapseMob(campaignID, id int64) (*Minion, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	base := &Minion{}
+	if err := scanMinion(tx.QueryRow(minionSelect+` WHERE m.campaign_id = ? AND m.id = ? AND m.active = 1`,
+		campaignID, id), base); err != nil {
+		return nil, err
+	}
+	if !base.IsMinion() || base.Bestiary || base.Dead {
+		return nil, errMobBase
+	}
+	members := base.Members
+	if members == nil {
+		members = []int{base.HP}
+	}
+	memberMax := base.MemberMaxHP()
+	name := mobName(base.Name)
+
+	rows, err := tx.Query(minionSelect+` WHERE m.campaign_id = ? AND m.active = 1 AND m.bestiary = 0
+		AND m.members IS NULL AND m.kind = ? AND m.died_at IS NULL AND m.id != ?
+		AND m.max_hp = ? AND m.ac = ? AND m.attack = ? AND m.damage = ? ORDER BY m.id`,
+		campaignID, kindMinion, id, memberMax, base.AC, base.Attack, base.Damage)
+	if err != nil {
+		return nil, err
+	}
+	var absorbed []*Minion
+	for rows.Next() {
+		other := &Minion{}
+		if err := scanMinion(rows, other); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if strings.EqualFold(mobName(other.Name), name) {
+			absorbed = append(absorbed, other)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(absorbed) == 0 {
+		return nil, errNoIdentical
+	}
+
+	tags, loot := base.Tags, base.Loot
+	for _, other := range absorbed {
+		if !sameStatBlock(base, other) {
+			return nil, errMobStatBlocks{other.Name}
+		}
+		members = append(members, other.HP)
+		tags = append(tags, other.Tags...)
+		loot = addLoot(loot, other.Loot)
+		if _, err := tx.Exec(`UPDATE minions SET active = 0, version = version + 1 WHERE id = ?`, other.ID); err != nil {
+			return nil, err
+		}
+		if err := logEvent(tx, campaignID, other.ID, minionEvent{Kind: eventJoinedMob,
+			Detail: fmt.Sprintf("joined %s as member %d", name, len(members))}); err != nil {
+			return nil, err
+		}
+	}
+	_, err = tx.Exec(`UPDATE minions SET name = ?, hp = ?, max_hp = ?, members = ?, version = version + 1 WHERE id = ?`,
+		name, sumHP(members), memberMax*len(members), encodeMembers(members), id)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := parseTags(strings.Join(tags, tagSep))
+	if err != nil {
+		return nil, err
+	}
+	if err := setMinionTags(tx, campaignID, id, merged); err != nil {
+		return nil, err
+	}
+	if err := setMinionLoot(tx, id, loot); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return getMinion(campaignID, id)
+}
+
+// mobAttackersPerHit is the DMG's mob attack table: how many attackers it
+// takes to land one hit, by the d20 roll each of them would need.
+func mobAttackersPerHit(needed int) int {
+	switch {
+	case needed <= 5:
+		return 1
+	case needed <= 12:
+		return 2
+	case needed <= 14:
+		return 3
+	case needed <= 16:
+		return 4
+	case needed <= 18:
+		return 5
+	case needed == 19:
+		return 10
+	default:
+		return 20
+	}
+}
+
+// mobAttackResult is a resolved mob attack. Damage is rolled once per hit
+// when the mob's damage parses as dice.
+type mobAttackResult struct {
+	Mob       *Minion
+	Target    *Minion // the PC or ally attacked, if one was picked
+	TargetAC  int
+	Needed    int // d20 roll each attacker would need
+	PerHit    int // attackers per hit
+	Hits      int
+	HitDamage []int
+	Damage    int
+	IsGM      bool // whether the roller may apply the damage to Target
+}
+
+// resolveMobAttack attacks a target with every surviving member of m using
+// the mob rules instead of rolling each attack.
+func resolveMobAttack(m *Minion, targetAC int) mobAttackResult {
+	res := mobAttackResult{Mob: m, TargetAC: targetAC, Needed: targetAC - m.Attack}
+	res.PerHit = mobAttackersPerHit(res.Needed)
+	res.Hits = m.Survivors() / res.PerHit
+	if d, err := parseDamage(m.Damage); err == nil {
+		for range res.Hits {
+			hit := d.Roll()
+			res.HitDamage = append(res.HitDamage, hit)
+			res.Damage += hit
+		}
+	}
+	return res
+}
+
+// memberParam reads the optional member form value, 1-based as shown in
+// the member strip.
+func memberParam(r *http.Request) int {
+	if n, err := strconv.Atoi(r.FormValue("member")); err == nil && n > 0 {
+		return n - 1
+	}
+	return anyMember
+}
+
+func handleCollapseMob(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	_, err := collapseMob(campaignID(r), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	var differ errMobStatBlocks
+	if errors.Is(err, errNoIdentical) || errors.Is(err, errMobBase) || errors.Is(err, errTooManyTags) ||
+		errors.As(err, &differ) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	// The absorbed minions have rows of their own, so redraw the list.
+	r.ParseForm()
+	r.URL.RawQuery = r.Form.Encode()
+	handleMinionList(w, r)
+}
+
+func handleMobAttack(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	m, err := getMinion(campaignID(r), id)
+	if err != nil || !m.IsMob() {
+		http.Error(w, "not found", 404)
+		return
+	}
+	r.ParseForm()
+	target, err := attackTarget(r)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "target not found", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	ac := 0
+	if target != nil && target.AC > 0 {
+		ac = target.AC
+	} else if ac, err = strconv.Atoi(r.FormValue("target_ac")); err != nil || ac < 1 {
+		http.Error(w, "target AC must be a positive number", http.StatusBadRequest)
+		return
+	}
+	res := resolveMobAttack(m, ac)
+	res.Target, res.IsGM = target, campaignFor(r).IsGM()
+	tmpl.ExecuteTemplate(w, "mob-attack", res)
+}
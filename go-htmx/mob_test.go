@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyMobHP(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		members []int
+		member  int
+		delta   int
+		want    []int
+	}{
+		{"damage overflows", []int{7, 7, 7}, anyMember, -10, []int{0, 4, 7}},
+		{"damage skips the fallen", []int{0, 2, 7}, anyMember, -5, []int{0, 0, 4}},
+		{"excess damage is lost", []int{3, 3}, anyMember, -20, []int{0, 0}},
+		{"chosen member takes it all", []int{7, 7, 7}, 2, -10, []int{7, 7, 0}},
+		{"healing tops up the standing", []int{0, 2, 5}, anyMember, 6, []int{0, 7, 6}},
+		{"a chosen heal revives", []int{0, 7}, 0, 3, []int{3, 7}},
+	} {
+		members := append([]int(nil), tt.members...)
+		if err := applyMobHP(members, 7, tt.member, tt.delta); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(members, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, members)
+		}
+	}
+	if err := applyMobHP([]int{7}, 7, 3, -1); !errors.Is(err, errNoMember) {
+		t.Errorf("Expected errNoMember, got %v", err)
+	}
+}
+
+func TestMobAttackersPerHit(t *testing.T) {
+	for needed, want := range map[int]int{-2: 1, 5: 1, 6: 2, 12: 2, 13: 3, 15: 4, 18: 5, 19: 10, 20: 20, 25: 20} {
+		if got := mobAttackersPerHit(needed); got != want {
+			t.Errorf("needed %d: expected %d attackers per hit, got %d", needed, want, got)
+		}
+	}
+}
+
+func TestResolveMobAttack(t *testing.T) {
+	fixedRolls(t, 6, 4, 2)
+	m := &Minion{Attack: 4, Damage: "1d6+2", Members: []int{13, 0, 13, 13, 13, 13, 13}}
+
+	// Six survivors needing 16-4 = 12 hit twice over, so three hits
+	res := resolveMobAttack(m, 16)
+	if res.Needed != 12 || res.PerHit != 2 || res.Hits != 3 {
+		t.Errorf("Expected 3 hits at 2 per hit, got %+v", res)
+	}
+	if res.Damage != 18 || !reflect.DeepEqual(res.HitDamage, []int{8, 6, 4}) {
+		t.Errorf("Expected 8+6+4 damage, got %v = %d", res.HitDamage, res.Damage)
+	}
+}
+
+func TestSpawnAndDamageMob(t *testing.T) {
+	useTestDB(t)
+	entry := &Minion{Name: "Skeleton", HP: 13, MaxHP: 13, AC: 13, Attack: 4, Damage: "1d6+2", Bestiary: true}
+	createMinion(defaultCampaignID, entry)
+
+	mob, err := spawnMob(defaultCampaignID, entry.ID, 4, 0)
+	if err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	if mob.HP != 52 || mob.MaxHP != 52 || mob.MemberMaxHP() != 13 || len(mob.Members) != 4 {
+		t.Errorf("Expected four 13 HP skeletons totalling 52, got %+v", mob)
+	}
+
+	got, err := adjustHP(defaultCampaignID, mob.ID, -20)
+	if err != nil {
+		t.Fatalf("Damage failed: %v", err)
+	}
+	if !reflect.DeepEqual(got.Members, []int{0, 6, 13, 13}) || got.HP != 32 || got.Survivors() != 3 {
+		t.Errorf("Expected the damage to overflow into the second skeleton, got %v (%d HP)", got.Members, got.HP)
+	}
+
+	got, _ = adjustMemberHP(defaultCampaignID, mob.ID, 3, -13)
+	if got.Survivors() != 2 || got.Version != 3 {
+		t.Errorf("Expected the last skeleton down and version 3, got %v v%d", got.Members, got.Version)
+	}
+
+	single := createTestMinion(t, db, &Minion{Name: "Orc", HP: 15, MaxHP: 15})
+	if _, err := adjustMemberHP(defaultCampaignID, single, 0, -5); !errors.Is(err, errNotMob) {
+		t.Errorf("Expected errNotMob for a single minion, got %v", err)
+	}
+
+	// Editing a mob never touches its HP
+	got.Name, got.HP, got.MaxHP = "Skeleton horde", 1, 1
+	if err := updateMinion(defaultCampaignID, got); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if got, _ := getMinion(defaultCampaignID, mob.ID); got.Name != "Skeleton horde" || got.HP != 19 || got.MaxHP != 52 {
+		t.Errorf("Expected the rename to keep the mob's HP, got %+v", got)
+	}
+}
+
+func TestCollapseMob(t *testing.T) {
+	testDB := useTestDB(t)
+	first := createTestMinion(t, testDB, &Minion{Name: "Skeleton 1", HP: 13, MaxHP: 13, AC: 13, Attack: 4, Damage: "1d6+2"})
+	createTestMinion(t, testDB, &Minion{Name: "Skeleton 2", HP: 5, MaxHP: 13, AC: 13, Attack: 4, Damage: "1d6+2"})
+	createTestMinion(t, testDB, &Minion{Name: "skeleton", HP: 0, MaxHP: 13, AC: 13, Attack: 4, Damage: "1d6+2"})
+	createTestMinion(t, testDB, &Minion{Name: "Skeleton 4", HP: 13, MaxHP: 13, AC: 15, Attack: 4, Damage: "1d6+2"})
+	createTestMinion(t, testDB, &Minion{Name: "Zombie", HP: 13, MaxHP: 13, AC: 13, Attack: 4, Damage: "1d6+2"})
+
+	mob, err := collapseMob(defaultCampaignID, first)
+	if err != nil {
+		t.Fatalf("Collapse failed: %v", err)
+	}
+	if mob.Name != "Skeleton" || !reflect.DeepEqual(mob.Members, []int{13, 5, 0}) || mob.HP != 18 || mob.MaxHP != 39 {
+		t.Errorf("Expected the three identical skeletons folded together, got %+v", mob)
+	}
+	active, _ := listActiveMinions(defaultCampaignID)
+	if got := names(active); !reflect.DeepEqual(got, []string{"Skeleton", "Skeleton 4", "Zombie"}) {
+		t.Errorf("Expected the absorbed skeletons dismissed, got %v", got)
+	}
+
+	// A later straggler joins the existing mob
+	createTestMinion(t, testDB, &Minion{Name: "Skeleton 9", HP: 9, MaxHP: 13, AC: 13, Attack: 4, Damage: "1d6+2"})
+	if mob, err = collapseMob(defaultCampaignID, first); err != nil || !reflect.DeepEqual(mob.Members, []int{13, 5, 0, 9}) {
+		t.Errorf("Expected the straggler added, got %v (%v)", mob.Members, err)
+	}
+	if _, err := collapseMob(defaultCampaignID, first); !errors.Is(err, errNoIdentical) {
+		t.Errorf("Expected errNoIdentical with nothing left to fold, got %v", err)
+	}
+}
+
+func TestCollapseMobMergesAndRefuses(t *testing.T) {
+	useTestDB(t)
+	spawn := func(name string, m Minion) *Minion {
+		m.Name, m.HP, m.MaxHP, m.AC, m.Attack, m.Damage, m.Active = name, 7, 7, 15, 4, "1d6+2", true
+		return insertTestMinion(t, &m)
+	}
+	first := spawn("Goblin 1", Minion{Tags: []string{"ambush"}, Loot: []lootEntry{{Name: "gp", Quantity: 3, Coins: true}}})
+	second := spawn("Goblin 2", Minion{Tags: []string{"archers"}, Loot: []lootEntry{{Name: "gp", Quantity: 2, Coins: true}, {Name: "Dagger", Quantity: 1}}})
+
+	mob, err := collapseMob(defaultCampaignID, first.ID)
+	if err != nil {
+		t.Fatalf("Collapse failed: %v", err)
+	}
+	if !reflect.DeepEqual(mob.Tags, []string{"ambush", "archers"}) ||
+		!reflect.DeepEqual(mob.Loot, []lootEntry{{Name: "gp", Quantity: 5, Coins: true}, {Name: "Dagger", Quantity: 1}}) {
+		t.Errorf("Expected the tags and loot merged, got %v %v", mob.Tags, mob.Loot)
+	}
+	if events, _ := listEvents(defaultCampaignID, second.ID); len(events) != 1 || events[0].Kind != eventJoinedMob ||
+		events[0].Detail != "joined Goblin as member 2" {
+		t.Errorf("Expected the absorbed goblin's history to say where it went, got %+v", events)
+	}
+
+	// A goblin with attacks of its own would lose them, so nothing folds
+	spawn("Goblin 3", Minion{Attacks: []attack{{Name: "Scimitar", ToHit: 4, Damage: "1d6+2"}}})
+	var differ errMobStatBlocks
+	if _, err := collapseMob(defaultCampaignID, first.ID); !errors.As(err, &differ) || differ.Name != "Goblin 3" {
+		t.Errorf("Expected the collapse refused for Goblin 3, got %v", err)
+	}
+	if m, _ := getMinion(defaultCampaignID, first.ID); len(m.Members) != 2 {
+		t.Errorf("Expected the mob untouched, got %v", m.Members)
+	}
+
+	// Neither a PC nor the dead gather a mob
+	pc := insertTestMinion(t, partyMember("Goblin", 10, 15, 7))
+	dead := spawn("Wolf 1", Minion{})
+	spawn("Wolf 2", Minion{})
+	adjustHP(defaultCampaignID, dead.ID, -7)
+	for _, id := range []int64{pc.ID, dead.ID} {
+		if _, err := collapseMob(defaultCampaignID, id); !errors.Is(err, errMobBase) {
+			t.Errorf("Expected errMobBase for %d, got %v", id, err)
+		}
+	}
+}
+
+func TestHandleMob(t *testing.T) {
+	useTestDB(t)
+	_, gm := createTestUser(t, "gm", roleGM)
+	_, pc := createTestUser(t, "pc", rolePlayer)
+	entry := &Minion{Name: "Skeleton", HP: 13, MaxHP: 13, AC: 13, Attack: 4, Damage: "1d6+2", Bestiary: true}
+	createMinion(defaultCampaignID, entry)
+
+	form := url.Values{"id": {itoa64(entry.ID)}, "count": {"5"}, "mob": {"1"}}
+	rec := serveAs(t, gm, "POST", "/c/default/bestiary/spawn", strings.NewReader(form.Encode()))
+	if rec.Code != http.StatusOK || strings.Count(rec.Body.String(), `class="minion-row"`) != 1 {
+		t.Fatalf("Expected a single mob row, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if body := rec.Body.String(); !contains(body, "Skeleton ×5") || !contains(body, "5 of 5 standing") {
+		t.Errorf("Expected the mob summary, got %s", body)
+	}
+	active, _ := listActiveMinions(defaultCampaignID)
+	path := active[0].Path()
+
+	rec = serveAs(t, gm, "POST", path+"/hp/dmg", strings.NewReader("amount=7&member=2"))
+	if !contains(rec.Body.String(), `title="Member 2: 6/13"`) {
+		t.Errorf("Expected member 2 hurt in the strip, got %s", rec.Body.String())
+	}
+	if rec := serveAs(t, gm, "POST", path+"/hp/dmg", strings.NewReader("amount=7&member=9")); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a missing member, got %d", rec.Code)
+	}
+
+	fixedRolls(t)
+	rec = serveAs(t, pc, "POST", path+"/mob/attack", strings.NewReader("target_ac=9"))
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), "5 hits") || !contains(rec.Body.String(), "15 damage") {
+		t.Errorf("Expected five automatic hits for 15 damage, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := serveAs(t, pc, "POST", path+"/mob", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a player collapsing, got %d", rec.Code)
+	}
+}
@@ -1,14 +1,117 @@
 package main
 
+import "strconv"
+
 // Minion represents a spawned minion's stat block.
 type Minion struct {
+	ID      int64
+	Name    string
+	HP      int
+	MaxHP   int
+	AC      int
+	Attack  int
+	Damage  string
+	Notes   string
+	Active  bool
+	OwnerID int64
+
+	// Bestiary entries are inactive templates that get copied into play.
+	Bestiary bool
+
+	// Version counts writes, for detecting conflicting edits.
+	Version int64
+
+	// Initiative is nil until rolled.
+	Initiative *int
+
+	// Tags group minions, e.g. "wolf pack"; sorted by name.
+	Tags []string
+
+	// Members holds each member's HP when the minion is a mob of identical
+	// creatures. HP and MaxHP are then the mob's totals.
+	Members []int
+
+	// DeathPolicy says what happens at 0 HP; see deathPolicies. A downed
+	// minion under the unconscious policy counts its death saves.
+	DeathPolicy    string
+	DeathSuccesses int
+	DeathFailures  int
+	Dead           bool
+
+	// Scores are STR to CHA; Saves lists the abilities, by code, whose
+	// saving throws add ProfBonus.
+	Scores    abilityScores
+	Saves     []string
+	ProfBonus int
+
+	// Attacks are the minion's named attacks, in stat-block order; see
+	// attackSequence for how multiattack uses them. Attack and Damage hold
+	// the main one, which edits take from the first attack, and are all a
+	// minion without named attacks has.
+	Attacks []attack
+
+	// Resources are limited uses such as legendary actions, recharging
+	// abilities and per-day spells.
+	Resources []resource
+
+	// CR is the challenge rating as written in stat blocks ("1/4", "5"),
+	// empty when unknown. XP is what the minion is worth; it defaults to
+	// the CR's value but homebrew may override it.
+	CR string
+	XP int
+
+	// Loot is what the party collects when the minion is defeated; see
+	// creditDefeat.
+	Loot []lootEntry
+
+	// Kind says whether this is a minion or one of the party's side, a PC
+	// or an ally, who only shares the turn order; see combatantKinds.
+	Kind string
+
+	// Concentration names the spell the minion is concentrating on, if
+	// any. Edits leave it alone; see setConcentration.
+	Concentration string
+
+	CampaignID int64
+	Campaign   string // slug, for building URLs
+}
+
+// Path is the URL of the minion within its campaign.
+func (m Minion) Path() string {
+	return "/c/" + m.Campaign + "/minions/" + strconv.FormatInt(m.ID, 10)
+}
+
+// Roles a user account can hold.
+const (
+	roleGM     = "gm"
+	rolePlayer = "player"
+)
+
+// User is a local account that can sign in to the tracker.
+type User struct {
 	ID       int64
-	Name     string
-	HP       int
-	MaxHP    int
-	AC       int
-	Attack   int
-	Damage   string
-	Notes    string
-	Active   bool
+	Username string
+	Role     string
+}
+
+// IsGM reports whether u has full access to every minion.
+func (u *User) IsGM() bool {
+	return u != nil && u.Role == roleGM
+}
+
+// defaultCampaignID is the campaign created by the migration that
+// introduced campaigns; everything that existed before belongs to it.
+const defaultCampaignID = 1
+
+// Campaign is one table's game. Role is the viewing user's role in it.
+type Campaign struct {
+	ID   int64
+	Slug string
+	Name string
+	Role string
+}
+
+// IsGM reports whether the viewer runs this campaign.
+func (c *Campaign) IsGM() bool {
+	return c != nil && c.Role == roleGM
 }
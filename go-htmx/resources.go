@@ -0,0 +1,417 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// When a resource comes back. Turn, round and lair resets happen as the
+// turn order moves on; a recharge resource rolls a d6 at the start of its
+// minion's turn instead. Short and long rest resources only come back
+// when the party rests.
+const (
+	resetTurn     = "turn"     // start of the minion's turn, e.g. legendary actions
+	resetRound    = "round"    // start of each round, e.g. reactions
+	resetLair     = "lair"     // the lair's turn on initiative 20
+	resetRecharge = "recharge" // d6 roll, e.g. "Recharge 5–6"
+	resetShort    = "short"    // short or long rest
+	resetLong     = "long"     // long rest, i.e. per day
+)
+
+// resetKinds lists the resets in the order the edit form offers them.
+var resetKinds = []string{resetTurn, resetRound, resetLair, resetRecharge, resetShort, resetLong}
+
+func validReset(kind string) bool {
+	for _, k := range resetKinds {
+		if kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+// resource is a limited use a minion tracks: legendary actions, a lair
+// action, a recharging breath weapon, a spell usable three times a day, a
+// wand's charges or a level of spell slots. Recharge is the lowest d6 roll
+// that recharges it. Level marks spell slots of that level. Regain is the
+// dice a long rest gives back, for charges that only partly return; empty
+// means all of them.
+type resource struct {
+	ID       int64  `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Max      int    `json:"max"`
+	Current  int    `json:"current"`
+	Reset    string `json:"reset"`
+	Recharge int    `json:"recharge,omitempty"`
+	Level    int    `json:"level,omitempty"`
+	Regain   string `json:"regain,omitempty"`
+}
+
+// maxSlotLevel is the highest spell slot level.
+const maxSlotLevel = 9
+
+// LevelLabel names a spell slot level: "1st", "2nd", ... "9th".
+func (r resource) LevelLabel() string {
+	suffix := "th"
+	switch r.Level {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(r.Level) + suffix
+}
+
+// SpellSlots lists the minion's spell slot resources.
+func (m Minion) SpellSlots() []resource {
+	var slots []resource
+	for _, r := range m.Resources {
+		if r.Level > 0 {
+			slots = append(slots, r)
+		}
+	}
+	return slots
+}
+
+// Uses lists the minion's resources other than spell slots.
+func (m Minion) Uses() []resource {
+	var uses []resource
+	for _, r := range m.Resources {
+		if r.Level == 0 {
+			uses = append(uses, r)
+		}
+	}
+	return uses
+}
+
+// Spent reports whether any of r has been used.
+func (r resource) Spent() bool {
+	return r.Current < r.Max
+}
+
+// ResetLabel describes when r comes back, for the row.
+func (r resource) ResetLabel() string {
+	switch r.Reset {
+	case resetTurn:
+		return "per turn"
+	case resetRound:
+		return "per round"
+	case resetLair:
+		return "lair"
+	case resetRecharge:
+		if r.Recharge >= 6 {
+			return "recharge 6"
+		}
+		return "recharge " + strconv.Itoa(r.Recharge) + "–6"
+	case resetShort:
+		return "per short rest"
+	}
+	if r.Regain != "" {
+		return "regains " + r.Regain + " a day"
+	}
+	return "per day"
+}
+
+// parseResources reads the resources column minionSelect builds.
+func parseResources(s string) ([]resource, error) {
+	var resources []resource
+	if err := json.Unmarshal([]byte(s), &resources); err != nil {
+		return nil, err
+	}
+	if len(resources) == 0 {
+		return nil, nil
+	}
+	return resources, nil
+}
+
+// setMinionResources replaces a minion's resources, keeping how much of
+// each is left when one of the same name was there before.
+func setMinionResources(q querier, minionID int64, resources []resource) error {
+	left := map[string]int{}
+	rows, err := q.Query(`SELECT name, current FROM resources WHERE minion_id = ?`, minionID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var name string
+		var current int
+		if err := rows.Scan(&name, &current); err != nil {
+			rows.Close()
+			return err
+		}
+		left[strings.ToLower(name)] = current
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := q.Exec(`DELETE FROM resources WHERE minion_id = ?`, minionID); err != nil {
+		return err
+	}
+	for i, r := range resources {
+		if current, ok := left[strings.ToLower(r.Name)]; ok {
+			r.Current = current
+		}
+		r.Current = max(0, min(r.Current, r.Max))
+		if _, err := q.Exec(
+			`INSERT INTO resources (minion_id, position, name, max, current, reset, recharge, level, regain)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			minionID, i, r.Name, r.Max, r.Current, r.Reset, r.Recharge, r.Level, r.Regain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetResources refills every resource of the given reset kind, for one
+// minion or, when minionID is zero, every minion in the campaign.
+func resetResources(q querier, campaignID, minionID int64, kinds ...string) error {
+	for _, kind := range kinds {
+		query := `UPDATE resources SET current = max WHERE reset = ? AND minion_id IN (SELECT id FROM minions WHERE campaign_id = ?`
+		args := []any{kind, campaignID}
+		if minionID != 0 {
+			query += ` AND id = ?`
+			args = append(args, minionID)
+		}
+		if _, err := q.Exec(query+`)`, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	errNoResource  = errors.New("minion has no such resource")
+	errNoneLeft    = errors.New("nothing left to spend")
+	errNotRecharge = errors.New("resource does not recharge on a roll")
+)
+
+// changeResource spends (negative delta) or restores uses of a resource,
+// within 0 and its maximum.
+func changeResource(campaignID, minionID, resourceID int64, delta int) (*Minion, error) {
+	res, err := db.Exec(
+		`UPDATE resources SET current = max(0, min(max, current + ?))
+		 WHERE id = ? AND minion_id = (SELECT id FROM minions WHERE campaign_id = ? AND id = ?) AND (? > 0 OR current > 0)`,
+		delta, resourceID, campaignID, minionID, delta)
+	if err := expectRow(res, err); errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		db.QueryRow(`SELECT 1 FROM resources r JOIN minions m ON m.id = r.minion_id
+			WHERE r.id = ? AND m.id = ? AND m.campaign_id = ?`, resourceID, minionID, campaignID).Scan(&exists)
+		if exists {
+			return nil, errNoneLeft
+		}
+		return nil, errNoResource
+	} else if err != nil {
+		return nil, err
+	}
+	return getMinion(campaignID, minionID)
+}
+
+// rollRecharge rolls a d6 for a spent recharge resource and refills it on
+// its recharge number or higher, logging the roll. Resources that are not
+// spent are left alone and nothing is logged.
+func rollRecharge(q querier, campaignID, minionID int64, r resource) error {
+	if r.Reset != resetRecharge || !r.Spent() {
+		return nil
+	}
+	roll := rollDie(6)
+	detail := r.Name + " " + strconv.Itoa(roll)
+	if roll >= r.Recharge {
+		if _, err := q.Exec(`UPDATE resources SET current = max WHERE id = ?`, r.ID); err != nil {
+			return err
+		}
+		detail += ", recharged"
+	} else {
+		detail += ", not yet"
+	}
+	return logEvent(q, campaignID, minionID, minionEvent{Kind: eventRecharge, Detail: detail})
+}
+
+// rechargeAll rolls for every spent recharge resource of a minion.
+func rechargeAll(q querier, campaignID, minionID int64) error {
+	rows, err := q.Query(`SELECT id, name, max, current, reset, recharge FROM resources
+		WHERE minion_id = ? AND reset = ? AND current < max ORDER BY position`, minionID, resetRecharge)
+	if err != nil {
+		return err
+	}
+	var spent []resource
+	for rows.Next() {
+		var r resource
+		if err := rows.Scan(&r.ID, &r.Name, &r.Max, &r.Current, &r.Reset, &r.Recharge); err != nil {
+			rows.Close()
+			return err
+		}
+		spent = append(spent, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, r := range spent {
+		if err := rollRecharge(q, campaignID, minionID, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseResourceForm reads the resource rows of the edit form, parallel
+// res_* lists like the attack rows, followed by the spell slots: slot_1 to
+// slot_9 hold how many of each level, and slot_reset when they come back.
+// It returns nil when the form had no resource rows at all.
+func parseResourceForm(r *http.Request) []resource {
+	if _, ok := r.Form["res_name"]; !ok {
+		return nil
+	}
+	field := func(key string, i int) string {
+		if v := r.Form[key]; i < len(v) {
+			return strings.TrimSpace(v[i])
+		}
+		return ""
+	}
+	resources := []resource{}
+	for i, name := range r.Form["res_name"] {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		res := resource{Name: name, Max: 1, Reset: field("res_reset", i)}
+		if n, err := strconv.Atoi(field("res_max", i)); err == nil && n > 0 {
+			res.Max = n
+		}
+		if !validReset(res.Reset) {
+			res.Reset = resetRound
+		}
+		if res.Reset == resetRecharge {
+			res.Recharge = 6
+			if n, err := strconv.Atoi(field("res_recharge", i)); err == nil && n >= 2 && n <= 6 {
+				res.Recharge = n
+			}
+		}
+		if d, err := parseDice(field("res_regain", i)); err == nil && res.Reset == resetLong {
+			res.Regain = d.String()
+		}
+		res.Current = res.Max
+		resources = append(resources, res)
+	}
+
+	slotReset := resetLong
+	if r.FormValue("slot_reset") == resetShort {
+		slotReset = resetShort
+	}
+	for level := 1; level <= maxSlotLevel; level++ {
+		n, err := strconv.Atoi(r.FormValue("slot_" + strconv.Itoa(level)))
+		if err != nil || n < 1 {
+			continue
+		}
+		resources = append(resources, spellSlots(level, n, slotReset))
+	}
+	return resources
+}
+
+// spellSlots is the resource for n spell slots of a level.
+func spellSlots(level, n int, reset string) resource {
+	r := resource{Max: n, Current: n, Reset: reset, Level: level}
+	r.Name = r.LevelLabel() + "-level slots"
+	return r
+}
+
+// SlotLevels has one entry per spell level for the edit form, with a
+// zero Max for levels the minion has no slots of.
+func (m Minion) SlotLevels() []resource {
+	levels := make([]resource, maxSlotLevel)
+	for i := range levels {
+		levels[i].Level = i + 1
+	}
+	for _, r := range m.SpellSlots() {
+		if r.Level <= maxSlotLevel {
+			levels[r.Level-1] = r
+		}
+	}
+	return levels
+}
+
+// SlotReset is when the minion's spell slots come back: on a long rest,
+// or a short one for pact magic.
+func (m Minion) SlotReset() string {
+	for _, r := range m.Resources {
+		if r.Level > 0 {
+			return r.Reset
+		}
+	}
+	return resetLong
+}
+
+// resourceParams reads the {id} and {rid} path values.
+func resourceParams(r *http.Request) (int64, int64) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	rid, _ := strconv.ParseInt(r.PathValue("rid"), 10, 64)
+	return id, rid
+}
+
+func handleResource(w http.ResponseWriter, r *http.Request) {
+	id, rid := resourceParams(r)
+	var m *Minion
+	var err error
+	switch r.PathValue("action") {
+	case "spend":
+		m, err = changeResource(campaignID(r), id, rid, -1)
+	case "restore":
+		m, err = changeResource(campaignID(r), id, rid, 1)
+	case "recharge":
+		m, err = rechargeResource(campaignID(r), id, rid)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if errors.Is(err, errNoResource) || errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if errors.Is(err, errNoneLeft) || errors.Is(err, errNotRecharge) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "minion-row", m)
+}
+
+// rechargeResource is the row's "roll recharge" button.
+func rechargeResource(campaignID, minionID, resourceID int64) (*Minion, error) {
+	m, err := getMinion(campaignID, minionID)
+	if err != nil {
+		return nil, err
+	}
+	for _, res := range m.Resources {
+		if res.ID != resourceID {
+			continue
+		}
+		if res.Reset != resetRecharge {
+			return nil, errNotRecharge
+		}
+		if err := rollRecharge(db, campaignID, minionID, res); err != nil {
+			return nil, err
+		}
+		return getMinion(campaignID, minionID)
+	}
+	return nil, errNoResource
+}
+
+// ResourceList sums up a minion's resources for the conflict view, e.g.
+// "Legendary Actions 3 per turn; Fire Breath 1 recharge 5–6".
+func (m *Minion) ResourceList() string {
+	parts := make([]string, len(m.Resources))
+	for i, r := range m.Resources {
+		parts[i] = r.Name + " " + strconv.Itoa(r.Max) + " " + r.ResetLabel()
+	}
+	return strings.Join(parts, "; ")
+}
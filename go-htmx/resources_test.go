@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// dragon is a young dragon with legendary actions, a lair action and a
+// breath weapon that recharges on 5–6, on initiative n.
+func dragon(n int) *Minion {
+	return &Minion{Name: "Young Red Dragon", HP: 178, MaxHP: 178, Active: true, Initiative: initiative(n),
+		Resources: []resource{
+			{Name: "Legendary Actions", Max: 3, Current: 3, Reset: resetTurn},
+			{Name: "Lair Action", Max: 1, Current: 1, Reset: resetLair},
+			{Name: "Fire Breath", Max: 1, Current: 1, Reset: resetRecharge, Recharge: 5},
+		}}
+}
+
+func TestResourceResetLabel(t *testing.T) {
+	for r, want := range map[resource]string{
+		{Reset: resetTurn}:                  "per turn",
+		{Reset: resetRecharge, Recharge: 5}: "recharge 5–6",
+		{Reset: resetRecharge, Recharge: 6}: "recharge 6",
+		{Reset: resetLong}:                  "per day",
+	} {
+		if got := r.ResetLabel(); got != want {
+			t.Errorf("%+v: got %q, want %q", r, got, want)
+		}
+	}
+}
+
+func TestResourcesStored(t *testing.T) {
+	useTestDB(t)
+	m := insertTestMinion(t, dragon(15))
+
+	if len(m.Resources) != 3 || m.Resources[2].Recharge != 5 || m.Resources[0].ID == 0 {
+		t.Fatalf("Expected the resources to round-trip with ids, got %+v", m.Resources)
+	}
+	legendary := m.Resources[0].ID
+	changeResource(defaultCampaignID, m.ID, legendary, -1)
+	changeResource(defaultCampaignID, m.ID, legendary, -1)
+
+	// An edit keeps what is left of a resource it keeps, within the new max
+	m.Resources = []resource{{Name: "legendary actions", Max: 3, Current: 3, Reset: resetTurn}, m.Resources[2]}
+	updateMinion(defaultCampaignID, m)
+	got, _ := getMinion(defaultCampaignID, m.ID)
+	if len(got.Resources) != 2 || got.Resources[0].Current != 1 {
+		t.Errorf("Expected 1 legendary action left after the edit, got %+v", got.Resources)
+	}
+
+	if _, err := changeResource(defaultCampaignID, m.ID, got.Resources[0].ID, -1); err != nil {
+		t.Fatalf("Spend failed: %v", err)
+	}
+	if _, err := changeResource(defaultCampaignID, m.ID, got.Resources[0].ID, -1); err != errNoneLeft {
+		t.Errorf("Expected errNoneLeft, got %v", err)
+	}
+	if _, err := changeResource(defaultCampaignID, m.ID, 999, -1); err != errNoResource {
+		t.Errorf("Expected errNoResource, got %v", err)
+	}
+}
+
+func TestRecharge(t *testing.T) {
+	useTestDB(t)
+	m := insertTestMinion(t, dragon(15))
+	breath := m.Resources[2].ID
+
+	// Nothing to roll for while the breath is ready
+	if err := rechargeAll(db, defaultCampaignID, m.ID); err != nil {
+		t.Fatalf("Recharge failed: %v", err)
+	}
+	if events, _ := listEvents(defaultCampaignID, m.ID); len(events) != 0 {
+		t.Errorf("Expected no roll for an unspent breath, got %+v", events)
+	}
+
+	changeResource(defaultCampaignID, m.ID, breath, -1)
+	fixedRolls(t, 4, 5)
+	rechargeAll(db, defaultCampaignID, m.ID)
+	if m, _ := getMinion(defaultCampaignID, m.ID); m.Resources[2].Current != 0 || lastEvent(t, m.ID).Detail != "Fire Breath 4, not yet" {
+		t.Errorf("Expected a 4 to miss the recharge, got %+v", m.Resources[2])
+	}
+	rechargeAll(db, defaultCampaignID, m.ID)
+	if m, _ := getMinion(defaultCampaignID, m.ID); m.Resources[2].Current != 1 || lastEvent(t, m.ID).Detail != "Fire Breath 5, recharged" {
+		t.Errorf("Expected a 5 to recharge the breath, got %+v", m.Resources[2])
+	}
+}
+
+func TestHandleResource(t *testing.T) {
+	useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	m := insertTestMinion(t, dragon(15))
+	path := "/c/default/minions/" + itoa64(m.ID) + "/resources/"
+	legendary, lair, breath := itoa64(m.Resources[0].ID), itoa64(m.Resources[1].ID), itoa64(m.Resources[2].ID)
+
+	rec := serveAs(t, token, "POST", path+legendary+"/spend", nil)
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), "<strong>Legendary Actions</strong> 2/3") {
+		t.Errorf("Expected 2 legendary actions left, got %d: %s", rec.Code, rec.Body.String())
+	}
+	serveAs(t, token, "POST", path+lair+"/spend", nil)
+	if rec := serveAs(t, token, "POST", path+lair+"/spend", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 with nothing left, got %d", rec.Code)
+	}
+	if rec := serveAs(t, token, "POST", path+lair+"/restore", nil); !contains(rec.Body.String(), "<strong>Lair Action</strong> 1/1") {
+		t.Errorf("Expected the lair action restored, got %s", rec.Body.String())
+	}
+
+	rec = serveAs(t, token, "POST", path+breath+"/spend", nil)
+	if !contains(rec.Body.String(), "Roll recharge") {
+		t.Errorf("Expected a recharge button once the breath is spent, got %s", rec.Body.String())
+	}
+	fixedRolls(t, 6)
+	if rec := serveAs(t, token, "POST", path+breath+"/recharge", nil); !contains(rec.Body.String(), "<strong>Fire Breath</strong> 1/1") {
+		t.Errorf("Expected the breath recharged, got %s", rec.Body.String())
+	}
+	if rec := serveAs(t, token, "POST", path+legendary+"/recharge", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 rolling recharge for legendary actions, got %d", rec.Code)
+	}
+	if rec := serveAs(t, token, "POST", path+"999/spend", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing resource, got %d", rec.Code)
+	}
+	if rec := serveAs(t, token, "POST", path+legendary+"/hoard", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown action, got %d", rec.Code)
+	}
+}
+
+func TestHandleUpdateResources(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	id := createTestMinion(t, testDB, &Minion{Name: "Lich", HP: 135, MaxHP: 135})
+	path := "/c/default/minions/" + itoa64(id)
+
+	form := url.Values{
+		"name": {"Lich"}, "hp": {"135"}, "max_hp": {"135"}, "ac": {"17"}, "attack": {"12"},
+		"res_name": {"Legendary Actions", "Paralyzing Touch", ""}, "res_max": {"3", "", ""},
+		"res_reset": {"turn", "recharge", "round"}, "res_recharge": {"", "9", ""},
+	}
+	rec := serveAs(t, token, "PUT", path, strings.NewReader(form.Encode()))
+	if !contains(rec.Body.String(), "<strong>Legendary Actions</strong> 3/3") {
+		t.Errorf("Expected the row to show legendary actions, got %s", rec.Body.String())
+	}
+	m, _ := getMinion(defaultCampaignID, id)
+	if len(m.Resources) != 2 || m.Resources[1].Max != 1 || m.Resources[1].Recharge != 6 {
+		t.Errorf("Expected an out of range recharge to default to 6, got %+v", m.Resources)
+	}
+
+	// A form without resource rows leaves them alone
+	serveAs(t, token, "PUT", path, strings.NewReader("name=Lich&hp=135&max_hp=135&ac=17&attack=12"))
+	if m, _ := getMinion(defaultCampaignID, id); len(m.Resources) != 2 {
+		t.Errorf("Expected resources kept, got %+v", m.Resources)
+	}
+}
+
+func TestSRDResources(t *testing.T) {
+	monsters, err := parseSRDMonsters([]byte(`[
+		{"name":"Adult Red Dragon","hit_points":256,
+		 "legendary_actions":[{"name":"Detect"},{"name":"Tail Attack"}],
+		 "actions":[{"name":"Fire Breath","usage":{"type":"recharge on roll","dice":"1d6","min_value":5}}],
+		 "special_abilities":[{"name":"Legendary Resistance","usage":{"type":"per day","times":3}}]},
+		{"name":"Kraken","hit_points":472,"legendary_desc":"The kraken can take 4 legendary actions.",
+		 "legendary_actions":[{"name":"Tentacle Attack"}],
+		 "actions":[{"name":"Ink Cloud (Recharge 6)"},{"name":"Lightning Storm (1/Day)"}]}]`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	var got [][]resource
+	for _, s := range monsters {
+		m, err := s.toMinion()
+		if err != nil {
+			t.Fatalf("Mapping failed: %v", err)
+		}
+		got = append(got, m.Resources)
+	}
+	want := [][]resource{
+		{
+			{Name: "Legendary Actions", Max: 3, Current: 3, Reset: resetTurn},
+			{Name: "Fire Breath", Max: 1, Current: 1, Reset: resetRecharge, Recharge: 5},
+			{Name: "Legendary Resistance", Max: 3, Current: 3, Reset: resetLong},
+		},
+		{
+			{Name: "Legendary Actions", Max: 4, Current: 4, Reset: resetTurn},
+			{Name: "Ink Cloud", Max: 1, Current: 1, Reset: resetRecharge, Recharge: 6},
+			{Name: "Lightning Storm", Max: 1, Current: 1, Reset: resetLong},
+		},
+	}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("Unexpected resources:\ngot  %s\nwant %s", gotJSON, wantJSON)
+	}
+}
+
+func TestImportResourceValidation(t *testing.T) {
+	useTestDB(t)
+
+	doc := &exportDoc{Version: 1, Minions: []exportMinion{{ID: 1, Name: "Dragon", HP: 5, MaxHP: 5, Resources: []resource{
+		{Name: "Breath", Max: 1, Current: 1, Reset: resetRecharge, Recharge: 7},
+		{Name: "Wings", Max: 2, Current: 3, Reset: "hourly"},
+	}}}}
+	_, err := importCampaign(defaultCampaignID, doc, importReplace)
+	if verr, ok := err.(validationError); !ok || len(verr) != 3 {
+		t.Errorf("Expected 3 problems (recharge, current, reset), got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Rests. Either one brings back combat uses and short rest resources; only
+// a long rest brings back per-day uses, spell slots and charges.
+const (
+	restShort = "short"
+	restLong  = "long"
+)
+
+func validRest(kind string) bool {
+	return kind == restShort || kind == restLong
+}
+
+// restores reports whether a rest of the given kind brings r back.
+func restores(kind string, r resource) bool {
+	return kind == restLong || r.Reset != resetLong
+}
+
+var errUnknownRest = errors.New(`rest must be "short" or "long"`)
+
+// takeRest restores resources after a rest, for one minion or, when
+// minionID is zero, everyone in play. Charges with Regain dice get that
+// many back on a long rest rather than all of them. Each minion that got
+// something back has it logged, e.g. "long rest: 1st-level slots 4/4,
+// Wand of Webs 5/7".
+func takeRest(q querier, campaignID, minionID int64, kind string) error {
+	if !validRest(kind) {
+		return errUnknownRest
+	}
+	query := `SELECT r.id, r.minion_id, r.name, r.max, r.current, r.reset, r.regain FROM resources r
+		JOIN minions m ON m.id = r.minion_id
+		WHERE m.campaign_id = ? AND r.current < r.max`
+	args := []any{campaignID}
+	if minionID != 0 {
+		query += ` AND m.id = ?`
+		args = append(args, minionID)
+	} else {
+		query += ` AND m.active = 1 AND m.died_at IS NULL`
+	}
+	rows, err := q.Query(query+` ORDER BY r.minion_id, r.position`, args...)
+	if err != nil {
+		return err
+	}
+	type spent struct {
+		resource
+		minionID int64
+	}
+	var all []spent
+	for rows.Next() {
+		var s spent
+		if err := rows.Scan(&s.ID, &s.minionID, &s.Name, &s.Max, &s.Current, &s.Reset, &s.Regain); err != nil {
+			rows.Close()
+			return err
+		}
+		all = append(all, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	restored := map[int64][]string{}
+	var order []int64
+	for _, s := range all {
+		if !restores(kind, s.resource) {
+			continue
+		}
+		current := s.Max
+		if d, err := parseDice(s.Regain); err == nil && s.Reset == resetLong {
+			current = min(s.Max, s.Current+d.Roll())
+		}
+		if _, err := q.Exec(`UPDATE resources SET current = ? WHERE id = ?`, current, s.ID); err != nil {
+			return err
+		}
+		if _, ok := restored[s.minionID]; !ok {
+			order = append(order, s.minionID)
+		}
+		restored[s.minionID] = append(restored[s.minionID],
+			s.Name+" "+strconv.Itoa(current)+"/"+strconv.Itoa(s.Max))
+	}
+	for _, id := range order {
+		e := minionEvent{Kind: eventRest, Detail: kind + " rest: " + strings.Join(restored[id], ", ")}
+		if err := logEvent(q, campaignID, id, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rest runs takeRest in a transaction.
+func rest(campaignID, minionID int64, kind string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := takeRest(tx, campaignID, minionID, kind); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func handleRest(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if !validRest(r.PathValue("kind")) {
+		http.NotFound(w, r)
+		return
+	}
+	if _, err := getMinion(campaignID(r), id); errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err := rest(campaignID(r), id, r.PathValue("kind")); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	m, err := getMinion(campaignID(r), id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "minion-row", m)
+}
+
+// handleCampaignRest rests everyone in play and refreshes the list the way
+// the group actions do.
+func handleCampaignRest(w http.ResponseWriter, r *http.Request) {
+	if !validRest(r.PathValue("kind")) {
+		http.NotFound(w, r)
+		return
+	}
+	r.ParseForm()
+	if err := rest(campaignFor(r).ID, 0, r.PathValue("kind")); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	r.URL.RawQuery = r.Form.Encode()
+	handleMinionList(w, r)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// spentMage is a mage with every resource used up.
+func spentMage(name string) *Minion {
+	m := &Minion{Name: name, HP: 40, MaxHP: 40, Active: true, Resources: []resource{
+		spellSlots(1, 4, resetLong),
+		spellSlots(2, 3, resetLong),
+		{Name: "Misty Step", Max: 1, Reset: resetLong},
+		{Name: "Wand of Webs", Max: 7, Reset: resetLong, Regain: "1d6+1"},
+		{Name: "Arcane Ward", Max: 1, Reset: resetShort},
+		{Name: "Shield", Max: 1, Reset: resetRound},
+	}}
+	for i := range m.Resources {
+		m.Resources[i].Current = 0
+	}
+	return m
+}
+
+func currents(m *Minion) []int {
+	var out []int
+	for _, r := range m.Resources {
+		out = append(out, r.Current)
+	}
+	return out
+}
+
+func TestTakeRest(t *testing.T) {
+	useTestDB(t)
+	m := insertTestMinion(t, spentMage("Mage"))
+
+	if err := rest(defaultCampaignID, m.ID, restShort); err != nil {
+		t.Fatalf("Short rest failed: %v", err)
+	}
+	got, _ := getMinion(defaultCampaignID, m.ID)
+	if c := currents(got); c[0] != 0 || c[2] != 0 || c[3] != 0 || c[4] != 1 || c[5] != 1 {
+		t.Errorf("Expected a short rest to bring back only short and combat uses, got %v", c)
+	}
+	if e := lastEvent(t, m.ID); e.Kind != eventRest || e.Detail != "short rest: Arcane Ward 1/1, Shield 1/1" {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	// The wand regains 3+1 of its 7 charges
+	fixedRolls(t, 3)
+	rest(defaultCampaignID, m.ID, restLong)
+	got, _ = getMinion(defaultCampaignID, m.ID)
+	if c := currents(got); c[0] != 4 || c[1] != 3 || c[2] != 1 || c[3] != 4 {
+		t.Errorf("Expected slots and per-day uses back and 4 charges, got %v", c)
+	}
+	if e := lastEvent(t, m.ID); e.Detail != "long rest: 1st-level slots 4/4, 2nd-level slots 3/3, Misty Step 1/1, Wand of Webs 4/7" {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	if err := rest(defaultCampaignID, m.ID, "nap"); err != errUnknownRest {
+		t.Errorf("Expected errUnknownRest, got %v", err)
+	}
+}
+
+func TestHandleRest(t *testing.T) {
+	useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	_, playerToken := createTestUser(t, "pc", rolePlayer)
+	m := insertTestMinion(t, spentMage("Mage"))
+	benched := insertTestMinion(t, spentMage("Apprentice"))
+	deleteMinion(defaultCampaignID, benched.ID, false)
+	path := "/c/default/minions/" + itoa64(m.ID)
+
+	rec := serveAs(t, token, "POST", path+"/rest/long", nil)
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), "1st 4/4") || !contains(rec.Body.String(), "<strong>Slots</strong>") {
+		t.Errorf("Expected the row to show the slots back, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveAs(t, token, "POST", path+"/rest/nap", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown rest, got %d", rec.Code)
+	}
+	if rec := serveAs(t, token, "POST", "/c/default/minions/999/rest/long", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing minion, got %d", rec.Code)
+	}
+
+	// The party rest leaves dismissed minions alone
+	second := insertTestMinion(t, spentMage("Cult Fanatic"))
+	rec = serveAs(t, token, "POST", "/c/default/rest/short", nil)
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), "Cult Fanatic") {
+		t.Errorf("Expected the list back, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got, _ := getMinion(defaultCampaignID, second.ID); currents(got)[4] != 1 {
+		t.Errorf("Expected the fanatic rested, got %v", currents(got))
+	}
+	if got, _ := getMinion(defaultCampaignID, benched.ID); currents(got)[4] != 0 {
+		t.Errorf("Expected the dismissed apprentice left alone, got %v", currents(got))
+	}
+	if rec := serveAs(t, playerToken, "POST", "/c/default/rest/long", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a player, got %d", rec.Code)
+	}
+}
+
+func TestHandleUpdateSpellSlots(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	id := createTestMinion(t, testDB, &Minion{Name: "Warlock", HP: 30, MaxHP: 30})
+
+	form := url.Values{
+		"name": {"Warlock"}, "hp": {"30"}, "max_hp": {"30"}, "ac": {"12"}, "attack": {"5"},
+		"res_name": {"Wand", ""}, "res_max": {"7", ""}, "res_reset": {"long", "round"},
+		"res_recharge": {"", ""}, "res_regain": {"1d6 + 1", ""},
+		"slot_3": {"2"}, "slot_5": {"0"}, "slot_reset": {"short"},
+	}
+	rec := serveAs(t, token, "PUT", "/c/default/minions/"+itoa64(id), strings.NewReader(form.Encode()))
+	if !contains(rec.Body.String(), "3rd 2/2") || !contains(rec.Body.String(), "regains 1d6&#43;1 a day") {
+		t.Errorf("Expected pact slots and the wand on the row, got %s", rec.Body.String())
+	}
+	m, _ := getMinion(defaultCampaignID, id)
+	if slots := m.SpellSlots(); len(slots) != 1 || slots[0].Level != 3 || slots[0].Reset != resetShort || m.SlotReset() != resetShort {
+		t.Errorf("Expected two 3rd-level pact slots, got %+v", m.Resources)
+	}
+	if levels := m.SlotLevels(); len(levels) != maxSlotLevel || levels[2].Max != 2 || levels[0].Max != 0 {
+		t.Errorf("Unexpected slot levels %+v", levels)
+	}
+}
+
+func TestSRDSpellSlots(t *testing.T) {
+	monsters, err := parseSRDMonsters([]byte(`[
+		{"name":"Mage","hit_points":40,"special_abilities":[{"name":"Spellcasting",
+		 "spellcasting":{"slots":{"1":4,"2":3,"3":3}}}]},
+		{"name":"Priest","hit_points":27,"special_abilities":[{"name":"Spellcasting",
+		 "desc":"The priest is a 5th-level spellcaster.\n\n* 1st level (4 slots): cure wounds\n* 2nd level (3 slots): lesser restoration\n* 3rd level (2 slots): dispel magic"}]}]`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	for i, want := range [][]int{{4, 3, 3}, {4, 3, 2}} {
+		m, err := monsters[i].toMinion()
+		if err != nil {
+			t.Fatalf("Mapping failed: %v", err)
+		}
+		slots := m.SpellSlots()
+		if len(slots) != len(want) {
+			t.Fatalf("%s: expected %d slot levels, got %+v", m.Name, len(want), slots)
+		}
+		for j, n := range want {
+			if slots[j].Level != j+1 || slots[j].Max != n || slots[j].Reset != resetLong {
+				t.Errorf("%s: unexpected slots %+v", m.Name, slots[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// srdMonster is the union of the two JSON shapes 5e monster data usually
+// comes in: the 5e SRD API (dnd5eapi.co, 5e-database) and Open5e. Fields
+// that differ between them are decoded loosely and reconciled in toMinion.
+type srdMonster struct {
+	Name             string                `json:"name"`
+	ArmorClass       json.RawMessage       `json:"armor_class"`
+	HitPoints        int                   `json:"hit_points"`
+	SpecialAbilities looseList[srdAbility] `json:"special_abilities"`
+	Actions          looseList[srdAction]  `json:"actions"`
+	LegendaryActions looseList[srdAbility] `json:"legendary_actions"`
+	LegendaryDesc    string                `json:"legendary_desc"` // Open5e
+
+	// A number in the SRD API, a string like "1/4" in Open5e.
+	ChallengeRating json.RawMessage `json:"challenge_rating"`
+	XP              int             `json:"xp"`
+
+	Strength     int `json:"strength"`
+	Dexterity    int `json:"dexterity"`
+	Constitution int `json:"constitution"`
+	Intelligence int `json:"intelligence"`
+	Wisdom       int `json:"wisdom"`
+	Charisma     int `json:"charisma"`
+
+	// 5e SRD API: saving throw proficiencies are listed among the rest,
+	// with indexes like "saving-throw-dex".
+	ProficiencyBonus int `json:"proficiency_bonus"`
+	Proficiencies    []struct {
+		Value       int `json:"value"`
+		Proficiency struct {
+			Index string `json:"index"`
+		} `json:"proficiency"`
+	} `json:"proficiencies"`
+
+	// Open5e: the total save bonus, null unless proficient.
+	StrengthSave     *int `json:"strength_save"`
+	DexteritySave    *int `json:"dexterity_save"`
+	ConstitutionSave *int `json:"constitution_save"`
+	IntelligenceSave *int `json:"intelligence_save"`
+	WisdomSave       *int `json:"wisdom_save"`
+	CharismaSave     *int `json:"charisma_save"`
+}
+
+// looseList decodes a JSON array, treating the empty string Open5e uses
+// for "none" the same as an empty list.
+type looseList[T any] []T
+
+func (l *looseList[T]) UnmarshalJSON(data []byte) error {
+	if data[0] == '"' {
+		*l = nil
+		return nil
+	}
+	return json.Unmarshal(data, (*[]T)(l))
+}
+
+type srdAbility struct {
+	Name  string    `json:"name"`
+	Desc  string    `json:"desc"`
+	Usage *srdUsage `json:"usage"`
+
+	// 5e SRD API: a Spellcasting trait's slots by level, keyed "1".."9".
+	Spellcasting *struct {
+		Slots map[string]int `json:"slots"`
+	} `json:"spellcasting"`
+}
+
+// srdUsage is how the 5e SRD API marks limited actions and traits. Open5e
+// only has it in the name, as in "Fire Breath (Recharge 5-6)".
+type srdUsage struct {
+	Type     string `json:"type"` // "recharge on roll", "per day", ...
+	Times    int    `json:"times"`
+	MinValue int    `json:"min_value"`
+}
+
+type srdAction struct {
+	Name        string    `json:"name"`
+	Desc        string    `json:"desc"`
+	AttackBonus *int      `json:"attack_bonus"`
+	Usage       *srdUsage `json:"usage"`
+
+	// Open5e
+	DamageDice  string `json:"damage_dice"`
+	DamageBonus int    `json:"damage_bonus"`
+
+	// 5e SRD API
+	Damage []struct {
+		DamageDice string `json:"damage_dice"`
+		DamageType struct {
+			Index string `json:"index"`
+		} `json:"damage_type"`
+	} `json:"damage"`
+
+	// 5e SRD API: what a Multiattack action is made of. Counts are
+	// sometimes strings.
+	Actions []struct {
+		ActionName string          `json:"action_name"`
+		Count      json.RawMessage `json:"count"`
+	} `json:"actions"`
+}
+
+// armorClass reads either a bare number (Open5e, older SRD dumps) or the
+// SRD API's list of {type, value} entries, taking the first.
+func (s *srdMonster) armorClass() (int, error) {
+	raw := bytes.TrimSpace(s.ArmorClass)
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+	var n int
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n, nil
+	}
+	var list []struct {
+		Value int `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return 0, fmt.Errorf("armor_class: %w", err)
+	}
+	if len(list) == 0 {
+		return 0, nil
+	}
+	return list[0].Value, nil
+}
+
+// damage renders an action's damage as a dice expression such as "2d8+4".
+// Extra damage of another type is joined on, "1d10+4 + 2d6", which
+// parseDamage rolls as a sum.
+func (a *srdAction) damage() string {
+	if a.DamageDice != "" {
+		switch {
+		case a.DamageBonus > 0:
+			return a.DamageDice + "+" + strconv.Itoa(a.DamageBonus)
+		case a.DamageBonus < 0:
+			return a.DamageDice + strconv.Itoa(a.DamageBonus)
+		}
+		return a.DamageDice
+	}
+	var parts []string
+	for _, d := range a.Damage {
+		if d.DamageDice != "" {
+			parts = append(parts, d.DamageDice)
+		}
+	}
+	return strings.Join(parts, " + ")
+}
+
+var (
+	srdReach      = regexp.MustCompile(`(?i)(reach \d+ ft\.(?: or range [\d/]+ ft\.)?|range [\d/]+ ft\.)`)
+	srdDamageType = regexp.MustCompile(`\)\s+(\w+) damage`)
+	srdMultiCount = regexp.MustCompile(`(?i)\b(one|two|three|four|five) (?:attacks? )?with its (\w+)`)
+	srdNumbers    = map[string]int{"one": 1, "two": 2, "three": 3, "four": 4, "five": 5}
+	srdLimit      = regexp.MustCompile(`(?i)\s*\((?:recharge (\d)(?:\s*[-–]\s*6)?|(\d+)/day)\)`)
+	srdLegendary  = regexp.MustCompile(`(?i)take (\d+) legendary actions`)
+	srdSlots      = regexp.MustCompile(`(?i)(\d)(?:st|nd|rd|th) level \((\d+) slots?\)`)
+)
+
+// attack maps an action onto a named attack, taking the reach and damage
+// type from the SRD API fields or, for Open5e, the description.
+func (a *srdAction) attack() attack {
+	at := attack{Name: strings.TrimSpace(a.Name), ToHit: *a.AttackBonus, Damage: a.damage()}
+	at.Reach = srdReach.FindString(a.Desc)
+	if len(a.Damage) > 0 && a.Damage[0].DamageType.Index != "" {
+		at.DamageType = a.Damage[0].DamageType.Index
+	} else if sub := srdDamageType.FindStringSubmatch(a.Desc); sub != nil {
+		at.DamageType = strings.ToLower(sub[1])
+	}
+	return at
+}
+
+// attacks lists every action with an attack bonus, with the uses the
+// Multiattack action gives them: structured in the SRD API, read from
+// phrases like "two with its claws" in Open5e descriptions.
+func (s *srdMonster) attacks() []attack {
+	var attacks []attack
+	var multi *srdAction
+	for i := range s.Actions {
+		a := &s.Actions[i]
+		if strings.EqualFold(strings.TrimSpace(a.Name), "multiattack") {
+			multi = a
+		}
+		if a.AttackBonus != nil {
+			attacks = append(attacks, a.attack())
+		}
+	}
+	if multi == nil {
+		return attacks
+	}
+	uses := func(name string, n int) {
+		for i := range attacks {
+			if strings.HasPrefix(strings.ToLower(attacks[i].Name), strings.ToLower(name)) ||
+				strings.HasPrefix(strings.ToLower(name), strings.ToLower(attacks[i].Name)) {
+				attacks[i].Uses += n
+				return
+			}
+		}
+	}
+	for _, part := range multi.Actions {
+		n, err := strconv.Atoi(strings.Trim(string(part.Count), `"`))
+		if err == nil && n > 0 {
+			uses(part.ActionName, n)
+		}
+	}
+	if len(multi.Actions) == 0 {
+		for _, sub := range srdMultiCount.FindAllStringSubmatch(multi.Desc, -1) {
+			uses(sub[2], srdNumbers[strings.ToLower(sub[1])])
+		}
+	}
+	return attacks
+}
+
+// limitedUse turns a recharge or per-day action or trait into a
+// resource, or returns false for one that can be used at will.
+func limitedUse(name string, usage *srdUsage) (resource, bool) {
+	r := resource{Name: strings.TrimSpace(srdLimit.ReplaceAllString(name, "")), Max: 1}
+	switch sub := srdLimit.FindStringSubmatch(name); {
+	case usage != nil && usage.Type == "recharge on roll" && usage.MinValue > 0:
+		r.Reset, r.Recharge = resetRecharge, min(usage.MinValue, 6)
+	case usage != nil && usage.Type == "per day" && usage.Times > 0:
+		r.Reset, r.Max = resetLong, usage.Times
+	case sub != nil && sub[1] != "":
+		r.Reset = resetRecharge
+		r.Recharge, _ = strconv.Atoi(sub[1])
+	case sub != nil:
+		r.Reset = resetLong
+		r.Max, _ = strconv.Atoi(sub[2])
+	default:
+		return r, false
+	}
+	r.Current = r.Max
+	return r, true
+}
+
+// slots reads a Spellcasting trait's spell slots: structured in the SRD
+// API, from lines like "1st level (4 slots): ..." in Open5e.
+func (t *srdAbility) slots() []resource {
+	counts := make([]int, maxSlotLevel+1)
+	if t.Spellcasting != nil {
+		for level, n := range t.Spellcasting.Slots {
+			if l, err := strconv.Atoi(level); err == nil && l >= 1 && l <= maxSlotLevel {
+				counts[l] = n
+			}
+		}
+	} else {
+		for _, sub := range srdSlots.FindAllStringSubmatch(t.Desc, -1) {
+			l, _ := strconv.Atoi(sub[1])
+			counts[l], _ = strconv.Atoi(sub[2])
+		}
+	}
+	var slots []resource
+	for level := 1; level <= maxSlotLevel; level++ {
+		if counts[level] > 0 {
+			slots = append(slots, spellSlots(level, counts[level], resetLong))
+		}
+	}
+	return slots
+}
+
+// resources collects what the stat block limits: legendary actions,
+// three a round unless the description says otherwise, every recharge or
+// per-day action and trait, and spell slots.
+func (s *srdMonster) resources() []resource {
+	var resources []resource
+	if len(s.LegendaryActions) > 0 {
+		n := 3
+		if sub := srdLegendary.FindStringSubmatch(s.LegendaryDesc); sub != nil {
+			n, _ = strconv.Atoi(sub[1])
+		}
+		resources = append(resources, resource{Name: "Legendary Actions", Max: n, Current: n, Reset: resetTurn})
+	}
+	for _, a := range s.Actions {
+		if r, ok := limitedUse(a.Name, a.Usage); ok {
+			resources = append(resources, r)
+		}
+	}
+	for _, t := range s.SpecialAbilities {
+		if r, ok := limitedUse(t.Name, t.Usage); ok {
+			resources = append(resources, r)
+		}
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(t.Name)), "spellcasting") {
+			resources = append(resources, t.slots()...)
+		}
+	}
+	return resources
+}
+
+// bestAttack picks the action with the highest attack bonus; the first
+// one wins a tie, which in stat blocks is usually the signature attack.
+func (s *srdMonster) bestAttack() *srdAction {
+	var best *srdAction
+	for i := range s.Actions {
+		a := &s.Actions[i]
+		if a.AttackBonus == nil {
+			continue
+		}
+		if best == nil || *a.AttackBonus > *best.AttackBonus {
+			best = a
+		}
+	}
+	return best
+}
+
+// abilities reads the ability scores, proficient saves and proficiency
+// bonus from either shape. Open5e gives no proficiency bonus, so it is
+// worked out from a proficient save when there is one.
+func (s *srdMonster) abilities() (abilityScores, []string, int) {
+	scores := abilityScores{s.Strength, s.Dexterity, s.Constitution, s.Intelligence, s.Wisdom, s.Charisma}
+	prof := s.ProficiencyBonus
+	saves := []string{}
+	for _, p := range s.Proficiencies {
+		if code, ok := strings.CutPrefix(p.Proficiency.Index, "saving-throw-"); ok {
+			saves = append(saves, code)
+		}
+	}
+	open5e := [6]*int{s.StrengthSave, s.DexteritySave, s.ConstitutionSave, s.IntelligenceSave, s.WisdomSave, s.CharismaSave}
+	for i, bonus := range open5e {
+		if bonus == nil {
+			continue
+		}
+		saves = append(saves, abilityCodes[i])
+		if prof == 0 && scores[i] > 0 {
+			prof = *bonus - abilityModifier(scores[i])
+		}
+	}
+	for i := range scores {
+		if scores[i] <= 0 {
+			scores[i] = defaultScore
+		}
+	}
+	if prof <= 0 {
+		prof = defaultProfBonus
+	}
+	return scores, normalizeSaves(saves), prof
+}
+
+// challengeRating reads the CR from either shape, empty when missing or
+// not one the XP table knows.
+func (s *srdMonster) challengeRating() string {
+	raw := strings.Trim(string(bytes.TrimSpace(s.ChallengeRating)), `"`)
+	if cr, ok := parseCR(raw); ok {
+		return cr
+	}
+	return ""
+}
+
+// toMinion maps the stat block onto a Minion at full health. Traits go
+// into Notes, one per line.
+func (s *srdMonster) toMinion() (*Minion, error) {
+	name := strings.TrimSpace(s.Name)
+	if name == "" {
+		return nil, errors.New("monster has no name")
+	}
+	ac, err := s.armorClass()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if s.HitPoints <= 0 {
+		return nil, fmt.Errorf("%s: hit_points must be positive", name)
+	}
+
+	m := &Minion{Name: name, HP: s.HitPoints, MaxHP: s.HitPoints, AC: ac}
+	m.Scores, m.Saves, m.ProfBonus = s.abilities()
+	if a := s.bestAttack(); a != nil {
+		m.Attack = *a.AttackBonus
+		m.Damage = a.damage()
+	}
+	m.Attacks = s.attacks()
+	m.Resources = s.resources()
+	m.CR = s.challengeRating()
+	m.XP = s.XP
+	if m.XP == 0 {
+		m.XP = crXP[m.CR]
+	}
+
+	var notes []string
+	for _, t := range s.SpecialAbilities {
+		notes = append(notes, strings.TrimSpace(t.Name)+". "+strings.TrimSpace(t.Desc))
+	}
+	m.Notes = strings.Join(notes, "\n")
+	return m, nil
+}
+
+// parseSRDMonsters accepts a single monster object, an array of them, or
+// an Open5e list page ({"results": [...]}).
+func parseSRDMonsters(data []byte) ([]srdMonster, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("empty document")
+	}
+
+	if data[0] == '[' {
+		var list []srdMonster
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+
+	var page struct {
+		Results []srdMonster `json:"results"`
+	}
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, err
+	}
+	if page.Results != nil {
+		return page.Results, nil
+	}
+
+	var one srdMonster
+	if err := json.Unmarshal(data, &one); err != nil {
+		return nil, err
+	}
+	return []srdMonster{one}, nil
+}
+
+// importSRD converts every monster in data, failing as a whole if any of
+// them cannot be mapped so a bad file never half-imports.
+func importSRD(campaignID int64, data []byte, bestiary bool, ownerID int64) ([]*Minion, error) {
+	monsters, err := parseSRDMonsters(data)
+	if err != nil {
+		return nil, err
+	}
+	var errs validationError
+	minions := make([]*Minion, 0, len(monsters))
+	for _, s := range monsters {
+		m, err := s.toMinion()
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		m.Bestiary = bestiary
+		m.OwnerID = ownerID
+		minions = append(minions, m)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	for _, m := range minions {
+		m.Active = !m.Bestiary
+		if err := insertMinion(tx, campaignID, m); err != nil {
+			return nil, err
+		}
+	}
+	return minions, tx.Commit()
+}
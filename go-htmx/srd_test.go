@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readFixture(t *testing.T, parts ...string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(append([]string{"testdata"}, parts...)...))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	return data
+}
+
+func TestSRDMonsterMapping(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    []Minion
+	}{
+		{"goblin.json", []Minion{
+			{Name: "Goblin", HP: 7, MaxHP: 7, AC: 15, Attack: 4, Damage: "1d6+2",
+				Notes:  "Nimble Escape. The goblin can take the Disengage or Hide action as a bonus action on each of its turns.",
+				Scores: abilityScores{8, 14, 10, 10, 8, 8}, ProfBonus: 2, CR: "1/4", XP: 50,
+				Attacks: []attack{
+					{Name: "Scimitar", ToHit: 4, Damage: "1d6+2", Reach: "reach 5 ft.", DamageType: "slashing"},
+					{Name: "Shortbow", ToHit: 4, Damage: "1d6+2", Reach: "range 80/320 ft.", DamageType: "piercing"},
+				}},
+		}},
+		{"open5e-owlbear.json", []Minion{
+			{Name: "Owlbear", HP: 59, MaxHP: 59, AC: 13, Attack: 7, Damage: "1d10+5",
+				Notes:  "Keen Sight and Smell. The owlbear has advantage on Wisdom (Perception) checks that rely on sight or smell.",
+				Scores: abilityScores{20, 12, 17, 3, 12, 7}, ProfBonus: 2, CR: "3", XP: 700,
+				Attacks: []attack{
+					{Name: "Beak", ToHit: 7, Damage: "1d10+5", Reach: "reach 5 ft.", DamageType: "piercing", Uses: 1},
+					{Name: "Claws", ToHit: 7, Damage: "2d8+5", Reach: "reach 5 ft.", DamageType: "slashing", Uses: 1},
+				}},
+		}},
+		{"open5e-page.json", []Minion{
+			{Name: "Ogre", HP: 59, MaxHP: 59, AC: 11, Attack: 6, Damage: "2d8+4", Scores: defaultScores(), ProfBonus: 2,
+				CR: "2", XP: 450,
+				Attacks: []attack{
+					{Name: "Greatclub", ToHit: 6, Damage: "2d8+4", Reach: "reach 5 ft.", DamageType: "bludgeoning"},
+					{Name: "Javelin", ToHit: 6, Damage: "2d6+4", Reach: "reach 5 ft. or range 30/120 ft.", DamageType: "piercing"},
+				}},
+			{Name: "Skeleton", HP: 13, MaxHP: 13, AC: 13, Attack: 4, Damage: "1d6+2", Scores: defaultScores(), ProfBonus: 2,
+				CR: "1/4", XP: 50,
+				Attacks: []attack{
+					{Name: "Shortsword", ToHit: 4, Damage: "1d6+2", Reach: "reach 5 ft.", DamageType: "piercing"},
+					{Name: "Shortbow", ToHit: 4, Damage: "1d6+2", Reach: "range 80/320 ft.", DamageType: "piercing"},
+				}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			monsters, err := parseSRDMonsters(readFixture(t, "srd", tt.fixture))
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if len(monsters) != len(tt.want) {
+				t.Fatalf("Expected %d monsters, got %d", len(tt.want), len(monsters))
+			}
+			for i, s := range monsters {
+				m, err := s.toMinion()
+				if err != nil {
+					t.Fatalf("Mapping failed: %v", err)
+				}
+				if !reflect.DeepEqual(*m, tt.want[i]) {
+					t.Errorf("Mapped\n%+v\nwant\n%+v", *m, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSRDBonusDamage(t *testing.T) {
+	monsters, err := parseSRDMonsters(readFixture(t, "srd", "giant-spider.json"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	m, err := monsters[0].toMinion()
+	if err != nil {
+		t.Fatalf("Mapping failed: %v", err)
+	}
+	if m.Damage != "1d8+3 + 2d8" || m.Attacks[0].DamageType != "piercing" {
+		t.Fatalf("Expected the bite's poison dice kept, got %q %+v", m.Damage, m.Attacks)
+	}
+
+	// The poison dice are rolled too, and doubled on a crit
+	fixedRolls(t, 12, 4, 5, 6)
+	if res := rollAttacks(m, 10); res.Damage != 4+3+5+6 {
+		t.Errorf("Expected 18 damage from both terms, got %+v", res)
+	}
+	fixedRolls(t, 20, 1, 2, 3, 4, 5, 6)
+	if res := rollAttacks(m, 10); res.Damage != 1+2+3+4+5+6+3 {
+		t.Errorf("Expected 24 damage from a crit, got %+v", res)
+	}
+}
+
+func TestSRDArrayAndErrors(t *testing.T) {
+	monsters, err := parseSRDMonsters([]byte(`[{"name":"Rat","armor_class":10,"hit_points":1,"actions":[{"name":"Bite","attack_bonus":0,"damage_dice":"1","damage_bonus":0}]}]`))
+	if err != nil || len(monsters) != 1 {
+		t.Fatalf("Expected one monster from array, got %d, %v", len(monsters), err)
+	}
+	if m, _ := monsters[0].toMinion(); m.Attack != 0 || m.Damage != "1" {
+		t.Errorf("Expected +0 attack for 1 damage, got %+v", m)
+	}
+
+	bad := []string{``, `{"name":`, `{"name":"","hit_points":5}`, `{"name":"Ghost","hit_points":0}`, `{"name":"X","hit_points":1,"armor_class":"high"}`}
+	for _, doc := range bad {
+		monsters, err := parseSRDMonsters([]byte(doc))
+		if err != nil {
+			continue
+		}
+		if _, err := monsters[0].toMinion(); err == nil {
+			t.Errorf("Expected %q to be rejected", doc)
+		}
+	}
+}
+
+func TestImportSRDIsAllOrNothing(t *testing.T) {
+	useTestDB(t)
+
+	_, err := importSRD(defaultCampaignID, []byte(`[{"name":"Wolf","armor_class":13,"hit_points":11},{"name":"Nothing"}]`), true, 0)
+	if err == nil {
+		t.Fatal("Expected error for monster without hit points")
+	}
+	if all, _ := listAllMinions(defaultCampaignID); len(all) != 0 {
+		t.Errorf("Expected nothing imported, got %d", len(all))
+	}
+}
+
+func TestImportSRDTargets(t *testing.T) {
+	useTestDB(t)
+
+	if _, err := importSRD(defaultCampaignID, readFixture(t, "srd", "open5e-page.json"), true, 0); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if _, err := importSRD(defaultCampaignID, readFixture(t, "srd", "goblin.json"), false, 0); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	bestiary, _ := listBestiary(defaultCampaignID)
+	if len(bestiary) != 2 || bestiary[0].Name != "Ogre" || bestiary[1].Name != "Skeleton" {
+		t.Errorf("Expected Ogre and Skeleton in bestiary, got %+v", bestiary)
+	}
+	active, _ := listActiveMinions(defaultCampaignID)
+	if len(active) != 1 || active[0].Name != "Goblin" {
+		t.Errorf("Expected only Goblin in play, got %+v", active)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tagSep separates tags in the edit form and in minionSelect's
+// group_concat, so it can never appear inside a tag.
+const tagSep = ","
+
+// Limits on tags per minion and tag length.
+const (
+	maxTags      = 10
+	maxTagLength = 40
+)
+
+var errTooManyTags = errors.New("a minion has at most " + strconv.Itoa(maxTags) + " tags")
+
+// parseTags splits comma-separated input into clean tags: trimmed, inner
+// whitespace collapsed, duplicates dropped case-insensitively and sorted.
+// More than maxTags is refused rather than cut short.
+func parseTags(input string) ([]string, error) {
+	seen := map[string]bool{}
+	var tags []string
+	for _, t := range strings.Split(input, tagSep) {
+		t = strings.Join(strings.Fields(t), " ")
+		if r := []rune(t); len(r) > maxTagLength {
+			t = strings.TrimSpace(string(r[:maxTagLength]))
+		}
+		key := strings.ToLower(t)
+		if t == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, t)
+	}
+	if len(tags) > maxTags {
+		return nil, errTooManyTags
+	}
+	sortTags(tags)
+	return tags, nil
+}
+
+func sortTags(tags []string) {
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i]) < strings.ToLower(tags[j]) })
+}
+
+// setMinionTags replaces a minion's tags, creating campaign tags as needed
+// and removing ones no minion uses any more.
+func setMinionTags(q querier, campaignID, minionID int64, tags []string) error {
+	if _, err := q.Exec(`DELETE FROM minion_tags WHERE minion_id = ?`, minionID); err != nil {
+		return err
+	}
+	for _, t := range tags {
+		if _, err := q.Exec(`INSERT INTO tags (campaign_id, name) VALUES (?, ?) ON CONFLICT DO NOTHING`, campaignID, t); err != nil {
+			return err
+		}
+		if _, err := q.Exec(
+			`INSERT OR IGNORE INTO minion_tags (minion_id, tag_id)
+			 SELECT ?, id FROM tags WHERE campaign_id = ? AND name = ?`, minionID, campaignID, t); err != nil {
+			return err
+		}
+	}
+	_, err := q.Exec(`DELETE FROM tags WHERE campaign_id = ? AND id NOT IN (SELECT tag_id FROM minion_tags)`, campaignID)
+	return err
+}
+
+// tagSummary totals the active minions carrying a tag.
+type tagSummary struct {
+	Name  string
+	Count int
+	HP    int
+	MaxHP int
+}
+
+// listTagSummaries returns every tag in use by an active minion. PCs and
+// allies are not minions and do not count.
+func listTagSummaries(campaignID int64) ([]tagSummary, error) {
+	rows, err := db.Query(
+		`SELECT t.name, COUNT(*), SUM(m.hp), SUM(m.max_hp) FROM tags t
+		 JOIN minion_tags mt ON mt.tag_id = t.id
+		 JOIN minions m ON m.id = mt.minion_id AND m.active = 1 AND m.kind = 'minion'
+		 WHERE t.campaign_id = ? GROUP BY t.id ORDER BY t.name`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []tagSummary
+	for rows.Next() {
+		var t tagSummary
+		if err := rows.Scan(&t.Name, &t.Count, &t.HP, &t.MaxHP); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// taggedActive selects the active minions in a campaign carrying a tag.
+const taggedActive = `campaign_id = ? AND active = 1 AND kind = 'minion' AND id IN (
+	SELECT mt.minion_id FROM minion_tags mt JOIN tags t ON t.id = mt.tag_id WHERE t.campaign_id = ? AND t.name = ?)`
+
+// taggedIDs lists the active minions in a campaign carrying a tag.
+func taggedIDs(q querier, campaignID int64, tag string) ([]int64, error) {
+	rows, err := q.Query(`SELECT id FROM minions WHERE `+taggedActive+` ORDER BY id`, campaignID, campaignID, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// adjustGroupHP applies delta to every active minion tagged tag in one
+// transaction and reports how many it touched. Mobs in the group spread it
+// across their members as usual.
+func adjustGroupHP(campaignID int64, tag string, delta int) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	ids, err := taggedIDs(tx, campaignID, tag)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := adjustHPTx(tx, campaignID, id, anyMember, delta); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(ids)), tx.Commit()
+}
+
+// dismissGroup dismisses every active minion tagged tag as deleteMinion
+// would each of them.
+func dismissGroup(campaignID int64, tag string, defeated bool) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	ids, err := taggedIDs(tx, campaignID, tag)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := dismissMinion(tx, campaignID, id, "group "+tag, defeated); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(ids)), tx.Commit()
+}
+
+// minionGroup is one section of the grouped list. A minion with several
+// tags is shown once, under the first; Summary still totals everyone
+// carrying the tag.
+type minionGroup struct {
+	Tag     string
+	Summary tagSummary
+	Minions []Minion
+}
+
+// groupMinions sorts a page of minions into tag sections, untagged last.
+func groupMinions(minions []Minion, summaries []tagSummary) []minionGroup {
+	byTag := map[string]tagSummary{}
+	for _, s := range summaries {
+		byTag[strings.ToLower(s.Name)] = s
+	}
+
+	var groups []minionGroup
+	index := map[string]int{}
+	for _, m := range minions {
+		tag := ""
+		if len(m.Tags) > 0 {
+			tag = m.Tags[0]
+		}
+		key := strings.ToLower(tag)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, minionGroup{Tag: tag, Summary: byTag[key]})
+		}
+		groups[i].Minions = append(groups[i].Minions, m)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i].Tag, groups[j].Tag
+		if (a == "") != (b == "") {
+			return b == ""
+		}
+		return strings.ToLower(a) < strings.ToLower(b)
+	})
+	return groups
+}
+
+// handleGroupAction runs a group-level action on every minion tagged
+// {tag} and re-renders the list with the filter the request carries.
+func handleGroupAction(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	tag := r.PathValue("tag")
+	r.ParseForm()
+
+	var err error
+	switch r.PathValue("action") {
+	case "damage", "heal":
+		amount, convErr := strconv.Atoi(r.FormValue("amount"))
+		if convErr != nil || amount <= 0 {
+			http.Error(w, "amount must be a positive number", http.StatusBadRequest)
+			return
+		}
+		if r.PathValue("action") == "damage" {
+			amount = -amount
+		}
+		_, err = adjustGroupHP(c.ID, tag, amount)
+	case "dismiss":
+		_, err = dismissGroup(c.ID, tag, r.FormValue("defeated") != "")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	// The filter form is included with the request, so the refreshed list
+	// keeps whatever view the GM had.
+	r.URL.RawQuery = r.Form.Encode()
+	handleMinionList(w, r)
+}
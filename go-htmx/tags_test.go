@@ -0,0 +1,201 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tagMinion creates a minion and sets its tags
+func tagMinion(t *testing.T, m *Minion, tags ...string) int64 {
+	t.Helper()
+
+	id := createTestMinion(t, db, m)
+	if err := setMinionTags(db, defaultCampaignID, id, tags); err != nil {
+		t.Fatalf("Failed to tag minion: %v", err)
+	}
+	return id
+}
+
+func TestParseTags(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		want  []string
+	}{
+		{"", nil},
+		{" , ,", nil},
+		{"wolf pack", []string{"wolf pack"}},
+		{"  left   flank , Goblins,goblins, archers", []string{"archers", "Goblins", "left flank"}},
+		{strings.Repeat("x", maxTagLength+5), []string{strings.Repeat("x", maxTagLength)}},
+		{"j,i,h,g,f,e,d,c,b,a,A", []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}},
+	} {
+		if got, err := parseTags(tt.input); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTags(%q): expected %v, got %v, %v", tt.input, tt.want, got, err)
+		}
+	}
+	// Going over the limit is refused, not cut short, so nothing is lost
+	if _, err := parseTags("a,b,c,d,e,f,g,h,i,j,k,l"); err != errTooManyTags {
+		t.Errorf("Expected errTooManyTags, got %v", err)
+	}
+}
+
+func TestSetMinionTags(t *testing.T) {
+	useTestDB(t)
+	id := tagMinion(t, &Minion{Name: "Goblin", HP: 7, MaxHP: 7}, "left flank", "goblins")
+
+	m, err := getMinion(defaultCampaignID, id)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if want := []string{"goblins", "left flank"}; !reflect.DeepEqual(m.Tags, want) {
+		t.Errorf("Expected tags %v, got %v", want, m.Tags)
+	}
+
+	if err := setMinionTags(db, defaultCampaignID, id, []string{"Goblins"}); err != nil {
+		t.Fatalf("Retag failed: %v", err)
+	}
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM tags WHERE campaign_id = ?`, defaultCampaignID).Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected the unused tag to be pruned, %d tags left", count)
+	}
+	m, _ = getMinion(defaultCampaignID, id)
+	if want := []string{"goblins"}; !reflect.DeepEqual(m.Tags, want) {
+		t.Errorf("Expected the existing tag to be reused case-insensitively, got %v", m.Tags)
+	}
+}
+
+func TestTagSummariesAndGroups(t *testing.T) {
+	useTestDB(t)
+	tagMinion(t, &Minion{Name: "Wolf 1", HP: 11, MaxHP: 11}, "wolf pack")
+	tagMinion(t, &Minion{Name: "Wolf 2", HP: 4, MaxHP: 11}, "wolf pack")
+	tagMinion(t, &Minion{Name: "Goblin", HP: 7, MaxHP: 7}, "goblins", "left flank")
+	tagMinion(t, &Minion{Name: "Orc", HP: 15, MaxHP: 15})
+	dismissed := tagMinion(t, &Minion{Name: "Wolf 3", HP: 11, MaxHP: 11}, "wolf pack")
+	insertTestMinion(t, &Minion{Name: "Ranger", Kind: kindPC, HP: 30, MaxHP: 30, Active: true, Tags: []string{"wolf pack"}})
+	deleteMinion(defaultCampaignID, dismissed, false)
+
+	summaries, err := listTagSummaries(defaultCampaignID)
+	if err != nil {
+		t.Fatalf("Summaries failed: %v", err)
+	}
+	want := []tagSummary{{"goblins", 1, 7, 7}, {"left flank", 1, 7, 7}, {"wolf pack", 2, 15, 22}}
+	if !reflect.DeepEqual(summaries, want) {
+		t.Errorf("Expected %+v, got %+v", want, summaries)
+	}
+
+	page, _ := listMinions(defaultCampaignID, minionQuery{Tag: "Wolf Pack"})
+	if got := names(page.Minions); !reflect.DeepEqual(got, []string{"Wolf 1", "Wolf 2"}) {
+		t.Errorf("Expected the tag filter to find the pack, got %v", got)
+	}
+
+	page, _ = listMinions(defaultCampaignID, minionQuery{})
+	groups := groupMinions(page.Minions, summaries)
+	var got []string
+	for _, g := range groups {
+		got = append(got, g.Tag+":"+strings.Join(names(g.Minions), "+"))
+	}
+	if want := []string{"goblins:Goblin", "wolf pack:Wolf 1+Wolf 2", ":Orc"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected groups %v, got %v", want, got)
+	}
+	if groups[1].Summary.HP != 15 {
+		t.Errorf("Expected the pack's summary on its group, got %+v", groups[1].Summary)
+	}
+}
+
+func TestHandleGroupAction(t *testing.T) {
+	useTestDB(t)
+	_, gm := createTestUser(t, "gm", roleGM)
+	_, pc := createTestUser(t, "pc", rolePlayer)
+	wolf := tagMinion(t, &Minion{Name: "Wolf 1", HP: 11, MaxHP: 11}, "wolf pack")
+	tagMinion(t, &Minion{Name: "Wolf 2", HP: 4, MaxHP: 11}, "wolf pack")
+	orc := tagMinion(t, &Minion{Name: "Orc", HP: 15, MaxHP: 15})
+
+	form := url.Values{"amount": {"6"}, "group": {"1"}}
+	if rec := serveAs(t, pc, "POST", "/c/default/tags/wolf%20pack/damage", strings.NewReader(form.Encode())); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a player, got %d", rec.Code)
+	}
+
+	rec := serveAs(t, gm, "POST", "/c/default/tags/wolf%20pack/damage", strings.NewReader(form.Encode()))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if body := rec.Body.String(); !contains(body, "HP 5/22") || !contains(body, "Dismiss group") {
+		t.Errorf("Expected the grouped list with new totals, got %s", body)
+	}
+	if m, _ := getMinion(defaultCampaignID, wolf); m.HP != 5 || m.Version != 2 {
+		t.Errorf("Expected Wolf 1 at 5 HP and version 2, got %d (v%d)", m.HP, m.Version)
+	}
+	if m, _ := getMinion(defaultCampaignID, orc); m.HP != 15 {
+		t.Errorf("Expected the untagged orc untouched, got %d", m.HP)
+	}
+
+	form.Set("amount", "0")
+	if rec := serveAs(t, gm, "POST", "/c/default/tags/wolf%20pack/heal", strings.NewReader(form.Encode())); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a zero amount, got %d", rec.Code)
+	}
+
+	rec = serveAs(t, gm, "POST", "/c/default/tags/wolf%20pack/dismiss", strings.NewReader(""))
+	if rec.Code != http.StatusOK || contains(rec.Body.String(), "Wolf") {
+		t.Errorf("Expected the pack dismissed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if m, _ := getMinion(defaultCampaignID, orc); !m.Active {
+		t.Error("Expected the orc to stay active")
+	}
+}
+
+func TestHandleGroupActionEscapesTags(t *testing.T) {
+	useTestDB(t)
+	_, gm := createTestUser(t, "gm", roleGM)
+	wolf := tagMinion(t, &Minion{Name: "Wolf", HP: 11, MaxHP: 11}, "N/E flank #2")
+	orc := tagMinion(t, &Minion{Name: "Orc", HP: 15, MaxHP: 15}, "N")
+
+	path := "/c/default/tags/N%2FE%20flank%20%232/"
+	form := url.Values{"amount": {"6"}, "group": {"1"}}
+	rec := serveAs(t, gm, "POST", path+"damage", strings.NewReader(form.Encode()))
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), `hx-post="`+path+`heal"`) {
+		t.Fatalf("Expected the group's buttons to post to its escaped path, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if m, _ := getMinion(defaultCampaignID, wolf); m.HP != 5 {
+		t.Errorf("Expected the wolf on 5 HP, got %d", m.HP)
+	}
+	if m, _ := getMinion(defaultCampaignID, orc); m.HP != 15 {
+		t.Errorf("Expected the orc tagged N untouched, got %d", m.HP)
+	}
+}
+
+func TestHandleUpdateTags(t *testing.T) {
+	useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	id := tagMinion(t, &Minion{Name: "Goblin", HP: 7, MaxHP: 7, AC: 15}, "goblins")
+	path := "/c/default/minions/" + itoa64(id)
+
+	if rec := serveAs(t, token, "GET", path+"/edit", nil); !contains(rec.Body.String(), `name="tags" value="goblins"`) {
+		t.Errorf("Expected the edit form to carry the tags, got %s", rec.Body.String())
+	}
+
+	form := url.Values{"name": {"Goblin"}, "hp": {"7"}, "max_hp": {"7"}, "ac": {"15"}, "attack": {"4"}}
+	serveAs(t, token, "PUT", path, strings.NewReader(form.Encode()))
+	if m, _ := getMinion(defaultCampaignID, id); !reflect.DeepEqual(m.Tags, []string{"goblins"}) {
+		t.Errorf("Expected a form without tags to keep them, got %v", m.Tags)
+	}
+
+	form.Set("tags", "left flank, archers")
+	rec := serveAs(t, token, "PUT", path, strings.NewReader(form.Encode()))
+	if !contains(rec.Body.String(), `<mark class="tag">left flank</mark>`) {
+		t.Errorf("Expected the row to show the new tags, got %s", rec.Body.String())
+	}
+	if m, _ := getMinion(defaultCampaignID, id); !reflect.DeepEqual(m.Tags, []string{"archers", "left flank"}) {
+		t.Errorf("Expected the tags replaced, got %v", m.Tags)
+	}
+
+	form.Set("tags", "a,b,c,d,e,f,g,h,i,j,k")
+	if rec := serveAs(t, token, "PUT", path, strings.NewReader(form.Encode())); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for eleven tags, got %d", rec.Code)
+	}
+	if m, _ := getMinion(defaultCampaignID, id); len(m.Tags) != 2 {
+		t.Errorf("Expected the tags untouched, got %v", m.Tags)
+	}
+}
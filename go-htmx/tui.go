@@ -0,0 +1,465 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// tuiRefresh is how often the terminal UI rereads the database, so changes
+// made through the web server show up without a keypress.
+const tuiRefresh = 2 * time.Second
+
+// ANSI sequences used by the terminal UI.
+const (
+	ansiClear   = "\x1b[H\x1b[2J"
+	ansiReverse = "\x1b[7m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiReset   = "\x1b[0m"
+	ansiHide    = "\x1b[?25l"
+	ansiShow    = "\x1b[?25h"
+)
+
+// tuiField is one labelled input in a dialog.
+type tuiField struct {
+	label  string
+	value  string
+	number bool
+}
+
+// tuiDialog is the modal form or prompt currently on screen. submit is
+// called with the field values when Enter is pressed on the last field.
+type tuiDialog struct {
+	title  string
+	fields []tuiField
+	focus  int
+	submit func(values []string) error
+}
+
+// tui is the state of the terminal UI. It talks to the same storage
+// functions as the web handlers and keeps no state of its own beyond the
+// cursor, so it can run against a database the server is also using.
+type tui struct {
+	campaign *Campaign
+	minions  []Minion
+	cursor   int
+	dialog   *tuiDialog
+	status   string
+}
+
+func (c *cli) tui(args []string) error {
+	fs := c.flags("tui", true)
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	camp, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("stdin is not a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	fmt.Fprint(c.stdout, ansiHide)
+	defer fmt.Fprint(c.stdout, ansiShow+ansiClear)
+
+	t := &tui{campaign: camp}
+	t.reload()
+	return t.loop(os.Stdin, c.stdout)
+}
+
+// loop redraws after every key and every tuiRefresh until the user quits.
+func (t *tui) loop(in io.Reader, out io.Writer) error {
+	keys := make(chan string)
+	errs := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				errs <- err
+				return
+			}
+			for _, k := range parseKeys(buf[:n]) {
+				keys <- k
+			}
+		}
+	}()
+
+	tick := time.NewTicker(tuiRefresh)
+	defer tick.Stop()
+	for {
+		t.render(out)
+		select {
+		case k := <-keys:
+			if t.key(k) {
+				return nil
+			}
+		case <-tick.C:
+			if t.dialog == nil {
+				t.reload()
+			}
+		case err := <-errs:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// parseKeys splits raw terminal input into key names: "up", "down",
+// "enter", "esc", "tab", "backspace", "ctrl+c", or the typed character.
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		switch {
+		case len(b) >= 3 && b[0] == 0x1b && b[1] == '[':
+			switch b[2] {
+			case 'A':
+				keys = append(keys, "up")
+			case 'B':
+				keys = append(keys, "down")
+			}
+			b = b[3:]
+			continue
+		case b[0] == 0x1b:
+			keys = append(keys, "esc")
+		case b[0] == '\r' || b[0] == '\n':
+			keys = append(keys, "enter")
+		case b[0] == '\t':
+			keys = append(keys, "tab")
+		case b[0] == 0x7f || b[0] == 0x08:
+			keys = append(keys, "backspace")
+		case b[0] == 0x03:
+			keys = append(keys, "ctrl+c")
+		case b[0] >= 0x20:
+			r := []rune(string(b))[0]
+			keys = append(keys, string(r))
+			b = b[len(string(r)):]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+// reload rereads the minion list, keeping the cursor on the same minion
+// when it is still there.
+func (t *tui) reload() {
+	var selected int64
+	if m := t.selected(); m != nil {
+		selected = m.ID
+	}
+	minions, err := listActiveMinions(t.campaign.ID)
+	if err != nil {
+		t.status = err.Error()
+		return
+	}
+	t.minions = minions
+	t.cursor = min(t.cursor, max(len(minions)-1, 0))
+	for i, m := range minions {
+		if m.ID == selected {
+			t.cursor = i
+		}
+	}
+}
+
+func (t *tui) selected() *Minion {
+	if t.cursor < 0 || t.cursor >= len(t.minions) {
+		return nil
+	}
+	return &t.minions[t.cursor]
+}
+
+// key handles one keypress and reports whether the UI should exit.
+func (t *tui) key(k string) bool {
+	if k == "ctrl+c" {
+		return true
+	}
+	if t.dialog != nil {
+		t.dialogKey(k)
+		return false
+	}
+
+	t.status = ""
+	m := t.selected()
+	switch k {
+	case "q":
+		return true
+	case "up", "k":
+		t.cursor = max(t.cursor-1, 0)
+	case "down", "j":
+		t.cursor = min(t.cursor+1, max(len(t.minions)-1, 0))
+	case "r":
+		t.reload()
+	case "s":
+		t.spawnDialog()
+	case "d", "h":
+		if m != nil {
+			t.amountDialog(m, k == "d")
+		}
+	case "x":
+		if m != nil {
+			t.dismissDialog(m)
+		}
+	case "e":
+		if m != nil {
+			t.editDialog(m)
+		}
+	}
+	return false
+}
+
+func (t *tui) dialogKey(k string) {
+	d := t.dialog
+	f := &d.fields[d.focus]
+	switch k {
+	case "esc":
+		t.dialog = nil
+	case "up":
+		d.focus = max(d.focus-1, 0)
+	case "tab", "down":
+		d.focus = (d.focus + 1) % len(d.fields)
+	case "enter":
+		if d.focus < len(d.fields)-1 {
+			d.focus++
+			return
+		}
+		values := make([]string, len(d.fields))
+		for i, f := range d.fields {
+			values[i] = strings.TrimSpace(f.value)
+		}
+		if err := d.submit(values); err != nil {
+			t.status = err.Error()
+			return
+		}
+		t.dialog = nil
+		t.reload()
+	case "backspace":
+		if r := []rune(f.value); len(r) > 0 {
+			f.value = string(r[:len(r)-1])
+		}
+	default:
+		if len([]rune(k)) != 1 {
+			return
+		}
+		if f.number && !strings.ContainsAny(k, "-+0123456789") {
+			return
+		}
+		f.value += k
+	}
+}
+
+// atoi reads a number field, naming the field when it is not one.
+func atoi(label, value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(value, "+"))
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a whole number", label)
+	}
+	return n, nil
+}
+
+func (t *tui) amountDialog(m *Minion, damage bool) {
+	title, sign := "Heal "+m.Name, 1
+	if damage {
+		title, sign = "Damage "+m.Name, -1
+	}
+	id := m.ID
+	t.dialog = &tuiDialog{
+		title:  title,
+		fields: []tuiField{{label: "Amount", number: true}},
+		submit: func(v []string) error {
+			n, err := atoi("Amount", v[0])
+			if err != nil {
+				return err
+			}
+			if n <= 0 {
+				return errors.New("amount must be positive")
+			}
+			_, err = adjustHP(t.campaign.ID, id, sign*n)
+			return err
+		},
+	}
+}
+
+func (t *tui) dismissDialog(m *Minion) {
+	id := m.ID
+	t.dialog = &tuiDialog{
+		title:  "Dismiss " + m.Name + "? Type y, or d if it was defeated, and press Enter",
+		fields: []tuiField{{label: "Confirm"}},
+		submit: func(v []string) error {
+			defeated := strings.EqualFold(v[0], "d")
+			if !defeated && !strings.EqualFold(v[0], "y") {
+				return nil
+			}
+			return deleteMinion(t.campaign.ID, id, defeated)
+		},
+	}
+}
+
+// minionFromFields reads the Name, HP, Max HP, AC, Attack, Damage and Notes
+// fields shared by the spawn and edit dialogs.
+func minionFromFields(v []string) (*Minion, error) {
+	m := &Minion{Name: v[0], Damage: v[5], Notes: v[6]}
+	var err error
+	for i, dst := range []*int{&m.HP, &m.MaxHP, &m.AC, &m.Attack} {
+		label := []string{"HP", "Max HP", "AC", "Attack"}[i]
+		if *dst, err = atoi(label, v[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	if m.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if m.MaxHP == 0 {
+		m.MaxHP = m.HP
+	}
+	if m.HP < 0 || m.HP > m.MaxHP {
+		return nil, fmt.Errorf("HP must be between 0 and %d", m.MaxHP)
+	}
+	return m, nil
+}
+
+func minionFields(m *Minion) []tuiField {
+	return []tuiField{
+		{label: "Name", value: m.Name},
+		{label: "HP", value: strconv.Itoa(m.HP), number: true},
+		{label: "Max HP", value: strconv.Itoa(m.MaxHP), number: true},
+		{label: "AC", value: strconv.Itoa(m.AC), number: true},
+		{label: "Attack", value: strconv.Itoa(m.Attack), number: true},
+		{label: "Damage", value: m.Damage},
+		{label: "Notes", value: m.Notes},
+	}
+}
+
+func (t *tui) spawnDialog() {
+	fields := minionFields(&Minion{AC: 10})
+	fields[1].value, fields[2].value = "", ""
+	t.dialog = &tuiDialog{
+		title:  "Spawn minion",
+		fields: fields,
+		submit: func(v []string) error {
+			m, err := minionFromFields(v)
+			if err != nil {
+				return err
+			}
+			if err := createMinion(t.campaign.ID, m); err != nil {
+				return err
+			}
+			t.cursor = len(t.minions)
+			return nil
+		},
+	}
+}
+
+func (t *tui) editDialog(existing *Minion) {
+	id, owner, version, initiative, tags := existing.ID, existing.OwnerID, existing.Version, existing.Initiative, existing.Tags
+	t.dialog = &tuiDialog{
+		title:  "Edit " + existing.Name,
+		fields: minionFields(existing),
+		submit: func(v []string) error {
+			m, err := minionFromFields(v)
+			if err != nil {
+				return err
+			}
+			m.ID, m.OwnerID, m.Active, m.Version, m.Initiative, m.Tags = id, owner, true, version, initiative, tags
+			err = updateMinion(t.campaign.ID, m)
+			if errors.Is(err, errConflict) {
+				return errors.New("changed elsewhere since you opened it; press Esc and edit again")
+			}
+			return err
+		},
+	}
+}
+
+// hpBar draws HP as a fixed-width bar coloured by how hurt the minion is.
+func hpBar(hp, maxHP, width int) string {
+	if maxHP <= 0 {
+		return strings.Repeat("░", width)
+	}
+	filled := hp * width / maxHP
+	if hp > 0 && filled == 0 {
+		filled = 1
+	}
+	color := ansiGreen
+	switch {
+	case hp*4 <= maxHP:
+		color = ansiRed
+	case hp*2 <= maxHP:
+		color = ansiYellow
+	}
+	return color + strings.Repeat("█", filled) + ansiDim + strings.Repeat("░", width-filled) + ansiReset
+}
+
+// render redraws the whole screen. Raw mode needs explicit carriage
+// returns, so every line ends in \r\n.
+func (t *tui) render(w io.Writer) {
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		fmt.Fprintf(&b, format, args...)
+		b.WriteString("\x1b[K\r\n")
+	}
+
+	b.WriteString(ansiClear)
+	line("%sMinion Tracker · %s%s", ansiBold, t.campaign.Name, ansiReset)
+	line("")
+	if len(t.minions) == 0 {
+		line("%sNo active minions. Press s to spawn one.%s", ansiDim, ansiReset)
+	}
+	for i, m := range t.minions {
+		name := m.Name
+		switch {
+		case m.IsMob():
+			name = fmt.Sprintf("%s ×%d/%d", m.Name, m.Survivors(), len(m.Members))
+		case m.Dead:
+			name = "† " + m.Name
+		}
+		row := fmt.Sprintf(" %-24.24s %s %3d/%-3d  AC %-2d  %+d %s",
+			name, hpBar(m.HP, m.MaxHP, 20), m.HP, m.MaxHP, m.AC, m.Attack, m.Damage)
+		if i == t.cursor {
+			row = ansiReverse + ">" + row + ansiReset
+		} else {
+			row = " " + row
+		}
+		line("%s", row)
+	}
+	line("")
+
+	if d := t.dialog; d != nil {
+		line("%s%s%s", ansiBold, d.title, ansiReset)
+		for i, f := range d.fields {
+			cursor := " "
+			if i == d.focus {
+				cursor = ">"
+			}
+			line("%s %-8s %s", cursor, f.label+":", f.value)
+		}
+		line("%sEnter next/save · Tab move · Esc cancel%s", ansiDim, ansiReset)
+	} else {
+		line("%s↑/↓ select · d damage · h heal · e edit · x dismiss · s spawn · r reload · q quit%s", ansiDim, ansiReset)
+	}
+	if t.status != "" {
+		line("%s%s%s", ansiRed, t.status, ansiReset)
+	}
+	io.WriteString(w, b.String())
+}
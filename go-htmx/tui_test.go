@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestTUI(t *testing.T) *tui {
+	t.Helper()
+
+	c, err := getCampaign(defaultCampaignID)
+	if err != nil {
+		t.Fatalf("Failed to load campaign: %v", err)
+	}
+	ui := &tui{campaign: c}
+	ui.reload()
+	return ui
+}
+
+// press feeds each key to the UI in turn; multi-character strings are typed
+func press(ui *tui, keys ...string) {
+	for _, k := range keys {
+		if len([]rune(k)) > 1 && !strings.Contains("up down enter esc tab backspace", k) {
+			for _, r := range k {
+				ui.key(string(r))
+			}
+			continue
+		}
+		ui.key(k)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("j\x1b[A\x1b[B\r\t\x7f\x1bé\x03"))
+	want := []string{"j", "up", "down", "enter", "tab", "backspace", "esc", "é", "ctrl+c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestTUIDamageHealDismiss(t *testing.T) {
+	testDB := useTestDB(t)
+	createTestMinion(t, testDB, &Minion{Name: "Goblin", HP: 7, MaxHP: 7, AC: 15})
+	orc := createTestMinion(t, testDB, &Minion{Name: "Orc", HP: 15, MaxHP: 15, AC: 13})
+	ui := newTestTUI(t)
+
+	press(ui, "j", "d", "9", "enter")
+	if m, _ := getMinion(defaultCampaignID, orc); m.HP != 6 {
+		t.Errorf("Expected orc at 6 HP, got %d", m.HP)
+	}
+	press(ui, "h", "4", "enter")
+	if m, _ := getMinion(defaultCampaignID, orc); m.HP != 10 {
+		t.Errorf("Expected orc healed to 10 HP, got %d", m.HP)
+	}
+
+	// Esc abandons the dialog without touching the minion
+	press(ui, "d", "5", "esc")
+	if m, _ := getMinion(defaultCampaignID, orc); m.HP != 10 {
+		t.Errorf("Expected cancelled damage to do nothing, got %d", m.HP)
+	}
+
+	press(ui, "x", "n", "enter")
+	if len(ui.minions) != 2 {
+		t.Errorf("Expected dismiss to need a y, got %d minions", len(ui.minions))
+	}
+	press(ui, "x", "y", "enter")
+	if len(ui.minions) != 1 || ui.minions[0].Name != "Goblin" || ui.cursor != 0 {
+		t.Errorf("Expected only the goblin left under the cursor, got %+v at %d", ui.minions, ui.cursor)
+	}
+}
+
+func TestTUISpawnAndEdit(t *testing.T) {
+	useTestDB(t)
+	ui := newTestTUI(t)
+
+	// Name, HP, (skip Max HP), AC, Attack, Damage, Notes
+	press(ui, "s", "Wolf", "enter", "11", "enter", "enter", "backspace", "backspace", "13", "enter", "4", "enter", "2d4+2", "enter", "enter")
+	if ui.dialog != nil {
+		t.Fatalf("Expected spawn to close the dialog, status %q", ui.status)
+	}
+	if len(ui.minions) != 1 {
+		t.Fatalf("Expected one minion, got %d", len(ui.minions))
+	}
+	wolf := ui.minions[0]
+	if wolf.Name != "Wolf" || wolf.HP != 11 || wolf.MaxHP != 11 || wolf.AC != 13 || wolf.Attack != 4 || wolf.Damage != "2d4+2" {
+		t.Errorf("Unexpected wolf %+v", wolf)
+	}
+
+	press(ui, "e", "backspace", "backspace", "backspace", "backspace", "Dire Wolf", "tab", "backspace", "backspace", "99", "esc")
+	if ui.minions[0].Name != "Wolf" {
+		t.Error("Expected Esc to discard the edit")
+	}
+
+	// HP above max is refused and the dialog stays open
+	press(ui, "e", "tab", "backspace", "backspace", "99", "enter", "enter", "enter", "enter", "enter", "enter")
+	if ui.dialog == nil || !contains(ui.status, "HP must be between") {
+		t.Errorf("Expected validation error, got status %q", ui.status)
+	}
+	press(ui, "esc")
+
+	press(ui, "e", "backspace", "backspace", "backspace", "backspace", "Dire Wolf", "enter", "enter", "enter", "enter", "enter", "enter", "enter")
+	if m, _ := getMinion(defaultCampaignID, wolf.ID); m.Name != "Dire Wolf" || m.HP != 11 {
+		t.Errorf("Expected edit to rename, got %+v", m)
+	}
+}
+
+func TestTUIRender(t *testing.T) {
+	testDB := useTestDB(t)
+	createTestMinion(t, testDB, &Minion{Name: "Goblin", HP: 1, MaxHP: 7, AC: 15, Attack: 4, Damage: "1d6+2"})
+	ui := newTestTUI(t)
+
+	var out bytes.Buffer
+	ui.render(&out)
+	screen := out.String()
+	for _, want := range []string{"Goblin", "  1/7", "AC 15", "+4 1d6+2", ansiRed + "█", "q quit"} {
+		if !contains(screen, want) {
+			t.Errorf("Expected %q on screen:\n%q", want, screen)
+		}
+	}
+
+	if bar := hpBar(7, 7, 10); bar != ansiGreen+strings.Repeat("█", 10)+ansiDim+ansiReset {
+		t.Errorf("Unexpected full bar %q", bar)
+	}
+}
+
+func TestTUIEditConflict(t *testing.T) {
+	testDB := useTestDB(t)
+	id := createTestMinion(t, testDB, &Minion{Name: "Orc", HP: 15, MaxHP: 15, AC: 13})
+	ui := newTestTUI(t)
+
+	press(ui, "e")
+	adjustHP(defaultCampaignID, id, -4) // the web UI lands a hit meanwhile
+	press(ui, "enter", "enter", "enter", "enter", "enter", "enter", "enter")
+
+	if ui.dialog == nil || !contains(ui.status, "changed elsewhere") {
+		t.Errorf("Expected a conflict message, got %q", ui.status)
+	}
+	if m, _ := getMinion(defaultCampaignID, id); m.HP != 11 {
+		t.Errorf("Expected the hit to survive the stale edit, got HP %d", m.HP)
+	}
+}
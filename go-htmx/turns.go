@@ -0,0 +1,271 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// lairInitiative is the count lair actions happen on. The lair loses
+// ties, so creatures on 20 go first.
+const lairInitiative = 20
+
+// lairTurn is the turn_id stored while it is the lair's turn.
+const lairTurn = 0
+
+// turnEntry is one slot in the turn order: a minion, or the lair.
+type turnEntry struct {
+	Minion     *Minion // nil for the lair
+	Initiative int
+	Current    bool
+}
+
+// Lair reports whether e is the lair's slot.
+func (e turnEntry) Lair() bool {
+	return e.Minion == nil
+}
+
+// rank breaks initiative ties: spawn order for minions, last for the lair.
+func (e turnEntry) rank() int64 {
+	if e.Lair() {
+		return math.MaxInt64
+	}
+	return e.Minion.ID
+}
+
+// after reports whether e comes after initiative/rank in the order.
+func (e turnEntry) after(initiative int, rank int64) bool {
+	return e.Initiative < initiative || (e.Initiative == initiative && e.rank() > rank)
+}
+
+// turnOrder is a campaign's combat: everyone with initiative who is still
+// in the fight, highest first, and whose turn it is. Round is zero until
+// the first turn. Limit is the per-turn time limit in seconds, zero for
+// none, and Clock times the current turn.
+type turnOrder struct {
+	Round   int
+	Entries []turnEntry
+	Limit   int
+	Clock   *turnClock
+
+	turnID sql.NullInt64
+}
+
+// Key identifies the current turn, so a poll can tell when it has passed.
+func (t *turnOrder) Key() string {
+	if !t.turnID.Valid || t.Round == 0 {
+		return ""
+	}
+	return strconv.Itoa(t.Round) + "-" + strconv.FormatInt(t.turnID.Int64, 10)
+}
+
+// Current is the entry whose turn it is, if any.
+func (t *turnOrder) Current() *turnEntry {
+	for i := range t.Entries {
+		if t.Entries[i].Current {
+			return &t.Entries[i]
+		}
+	}
+	return nil
+}
+
+// loadTurnOrder builds the turn order. The lair gets a slot on 20 when any
+// active minion has a lair resource.
+func loadTurnOrder(q querier, campaignID int64) (*turnOrder, error) {
+	t := &turnOrder{}
+	var started sql.NullInt64
+	if err := q.QueryRow(`SELECT round, turn_id, turn_started, turn_limit FROM campaigns WHERE id = ?`, campaignID).
+		Scan(&t.Round, &t.turnID, &started, &t.Limit); err != nil {
+		return nil, err
+	}
+	if started.Valid && t.Round > 0 {
+		at := time.Unix(started.Int64, 0)
+		t.Clock = &turnClock{Started: at, Elapsed: max(time.Since(at), 0), Limit: time.Duration(t.Limit) * time.Second}
+	}
+
+	rows, err := q.Query(minionSelect+` WHERE m.campaign_id = ? AND m.active = 1 AND m.initiative IS NOT NULL
+		AND m.died_at IS NULL ORDER BY m.initiative DESC, m.id`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	var minions []*Minion
+	for rows.Next() {
+		m := &Minion{}
+		if err := scanMinion(rows, m); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		minions = append(minions, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var lair bool
+	err = q.QueryRow(`SELECT EXISTS (SELECT 1 FROM resources r JOIN minions m ON m.id = r.minion_id
+		WHERE m.campaign_id = ? AND m.active = 1 AND m.died_at IS NULL AND r.reset = ?)`, campaignID, resetLair).Scan(&lair)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range minions {
+		if lair && *m.Initiative < lairInitiative {
+			t.Entries = append(t.Entries, turnEntry{Initiative: lairInitiative})
+			lair = false
+		}
+		t.Entries = append(t.Entries, turnEntry{Minion: m, Initiative: *m.Initiative})
+	}
+	if lair {
+		t.Entries = append(t.Entries, turnEntry{Initiative: lairInitiative})
+	}
+
+	if id := t.turnID; id.Valid {
+		for i := range t.Entries {
+			e := &t.Entries[i]
+			e.Current = (e.Lair() && id.Int64 == lairTurn) || (!e.Lair() && e.Minion.ID == id.Int64)
+		}
+	}
+	return t, nil
+}
+
+var errNoCombatants = errors.New("nobody has rolled initiative")
+
+// advanceTurn moves to the next slot in the turn order, starting a new
+// round after the last. The turn is remembered by initiative as well as
+// id, so it carries on from the right place when whoever had it has died
+// or been dismissed. Resources reset as the turn passes: round ones at the
+// top of each round, lair ones on the lair's turn, and a minion's own turn
+// resources and recharge rolls at the start of its turn. The turn that
+// ends is logged with how long it took, and the new one's clock starts.
+func advanceTurn(campaignID int64) (*turnOrder, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	t, err := loadTurnOrder(tx, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.Entries) == 0 {
+		return nil, errNoCombatants
+	}
+
+	var turnID, turnInit sql.NullInt64
+	if err := tx.QueryRow(`SELECT turn_id, turn_initiative FROM campaigns WHERE id = ?`, campaignID).
+		Scan(&turnID, &turnInit); err != nil {
+		return nil, err
+	}
+	next := -1
+	if turnID.Valid && t.Round > 0 {
+		rank := turnID.Int64
+		if rank == lairTurn {
+			rank = math.MaxInt64
+		}
+		for i, e := range t.Entries {
+			if e.after(int(turnInit.Int64), rank) {
+				next = i
+				break
+			}
+		}
+	}
+	round := t.Round
+	if next < 0 {
+		next, round = 0, round+1
+		if err := resetResources(tx, campaignID, 0, resetRound); err != nil {
+			return nil, err
+		}
+	}
+
+	e := t.Entries[next]
+	id := int64(lairTurn)
+	if e.Lair() {
+		err = resetResources(tx, campaignID, 0, resetLair)
+	} else {
+		id = e.Minion.ID
+		if err = resetResources(tx, campaignID, id, resetTurn); err == nil {
+			err = rechargeAll(tx, campaignID, id)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := finishTurn(tx, campaignID, now); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE campaigns SET round = ?, turn_id = ?, turn_initiative = ?, turn_started = ? WHERE id = ?`,
+		round, id, e.Initiative, now.Unix(), campaignID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return loadTurnOrder(db, campaignID)
+}
+
+// endCombat logs the last turn and clears the round and turn.
+func endCombat(campaignID int64) (*turnOrder, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := finishTurn(tx, campaignID, time.Now()); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE campaigns SET round = 0, turn_id = NULL, turn_initiative = NULL, turn_started = NULL
+		WHERE id = ?`, campaignID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return loadTurnOrder(db, campaignID)
+}
+
+// renderTurnOrder answers a turn order action. Resources on the rows may
+// have changed, so the list is told to refresh itself.
+func renderTurnOrder(w http.ResponseWriter, c *Campaign, t *turnOrder) {
+	w.Header().Set("HX-Trigger", "minions-changed")
+	tmpl.ExecuteTemplate(w, "turn-order", map[string]any{"Campaign": c, "Turns": t})
+}
+
+func handleNextTurn(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	t, err := advanceTurn(c.ID)
+	if errors.Is(err, errNoCombatants) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	renderTurnOrder(w, c, t)
+}
+
+func handleEndCombat(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	t, err := endCombat(c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	renderTurnOrder(w, c, t)
+}
+
+func handleTurnOrder(w http.ResponseWriter, r *http.Request) {
+	c := campaignFor(r)
+	t, err := loadTurnOrder(db, c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "turn-order", map[string]any{"Campaign": c, "Turns": t})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// turnNames lists the order as "A *B lair", starring the current turn.
+func turnNames(turns *turnOrder) string {
+	var names []string
+	for _, e := range turns.Entries {
+		name := "lair"
+		if !e.Lair() {
+			name = e.Minion.Name
+		}
+		if e.Current {
+			name = "*" + name
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, " ")
+}
+
+// inOrder is a 7 HP minion on initiative n.
+func inOrder(name string, n int) *Minion {
+	return &Minion{Name: name, HP: 7, MaxHP: 7, Active: true, Initiative: initiative(n)}
+}
+
+func TestTurnOrder(t *testing.T) {
+	useTestDB(t)
+	insertTestMinion(t, inOrder("Goblin", 20))
+	insertTestMinion(t, inOrder("Wolf", 12))
+	insertTestMinion(t, &Minion{Name: "Bench", HP: 7, MaxHP: 7, Active: true})
+
+	turns, err := loadTurnOrder(db, defaultCampaignID)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := turnNames(turns); got != "Goblin Wolf" || turns.Round != 0 {
+		t.Errorf("Expected only those who rolled, highest first, got %v", got)
+	}
+
+	// The lair loses the tie on 20
+	d := insertTestMinion(t, dragon(23))
+	turns, _ = loadTurnOrder(db, defaultCampaignID)
+	if got := turnNames(turns); got != "Young Red Dragon Goblin lair Wolf" {
+		t.Errorf("Unexpected order %v", got)
+	}
+
+	// A dead dragon's lair acts no more
+	adjustMemberHP(defaultCampaignID, d.ID, anyMember, -d.HP)
+	turns, _ = loadTurnOrder(db, defaultCampaignID)
+	if got := turnNames(turns); got != "Goblin Wolf" {
+		t.Errorf("Expected the lair gone with the dragon, got %v", got)
+	}
+}
+
+func TestAdvanceTurn(t *testing.T) {
+	useTestDB(t)
+	d := insertTestMinion(t, dragon(23))
+	goblin := insertTestMinion(t, inOrder("Goblin", 12))
+	legendary, lair, breath := d.Resources[0].ID, d.Resources[1].ID, d.Resources[2].ID
+
+	if _, err := advanceTurn(defaultCampaignID); err != nil {
+		t.Fatalf("Advance failed: %v", err)
+	}
+	turns, _ := loadTurnOrder(db, defaultCampaignID)
+	if got := turnNames(turns); turns.Round != 1 || got != "*Young Red Dragon lair Goblin" {
+		t.Fatalf("Expected round 1 on the dragon, got %d %q", turns.Round, got)
+	}
+
+	// Spend everything during the dragon's turn and the goblin's
+	changeResource(defaultCampaignID, d.ID, breath, -1)
+	changeResource(defaultCampaignID, d.ID, legendary, -1)
+	changeResource(defaultCampaignID, d.ID, lair, -1)
+
+	fixedRolls(t, 2)
+	turns, _ = advanceTurn(defaultCampaignID)
+	m, _ := getMinion(defaultCampaignID, d.ID)
+	if got := turnNames(turns); got != "Young Red Dragon *lair Goblin" || m.Resources[1].Current != 1 || m.Resources[0].Current != 2 {
+		t.Errorf("Expected the lair turn to bring back only the lair action, got %q %+v", got, m.Resources)
+	}
+
+	// The goblin is killed on its own turn; the round still moves on
+	advanceTurn(defaultCampaignID)
+	adjustMemberHP(defaultCampaignID, goblin.ID, anyMember, -7)
+
+	fixedRolls(t, 2)
+	turns, _ = advanceTurn(defaultCampaignID)
+	m, _ = getMinion(defaultCampaignID, d.ID)
+	if got := turnNames(turns); turns.Round != 2 || got != "*Young Red Dragon lair" {
+		t.Errorf("Expected round 2 back on the dragon, got %d %q", turns.Round, got)
+	}
+	if m.Resources[0].Current != 3 || m.Resources[2].Current != 0 || lastEvent(t, d.ID).Detail != "Fire Breath 2, not yet" {
+		t.Errorf("Expected legendary actions back and a failed recharge, got %+v", m.Resources)
+	}
+
+	turns, _ = endCombat(defaultCampaignID)
+	if turns.Round != 0 || turns.Current() != nil {
+		t.Errorf("Expected combat over, got %+v", turns)
+	}
+}
+
+func TestHandleTurns(t *testing.T) {
+	useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	_, playerToken := createTestUser(t, "pc", rolePlayer)
+
+	if rec := serveAs(t, token, "POST", "/c/default/turns/next", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 with nobody in the order, got %d", rec.Code)
+	}
+	insertTestMinion(t, inOrder("Goblin", 12))
+
+	rec := serveAs(t, token, "POST", "/c/default/turns/next", nil)
+	if rec.Code != http.StatusOK || !contains(rec.Body.String(), "Round 1") || !contains(rec.Body.String(), `class="current"`) {
+		t.Errorf("Expected round 1 to start, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("HX-Trigger") != "minions-changed" {
+		t.Errorf("Expected the list to be told to refresh, got %q", rec.Header().Get("HX-Trigger"))
+	}
+	if rec := serveAs(t, token, "GET", "/c/default/", nil); !contains(rec.Body.String(), "Round 1") {
+		t.Errorf("Expected the page to show the turn order")
+	}
+	if rec := serveAs(t, playerToken, "POST", "/c/default/turns/next", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a player, got %d", rec.Code)
+	}
+
+	rec = serveAs(t, token, "POST", "/c/default/turns/end", nil)
+	if contains(rec.Body.String(), "Round") || !contains(rec.Body.String(), "Start combat") {
+		t.Errorf("Expected combat ended, got %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Virtual tabletop export formats.
+const (
+	formatFoundry = "foundry"
+	formatRoll20  = "roll20"
+)
+
+// vttExporters turn a minion into a format's JSON document.
+var vttExporters = map[string]func(*Minion) any{
+	formatFoundry: foundryActor,
+	formatRoll20:  roll20Character,
+}
+
+// foundryActor builds a Foundry VTT actor for the dnd5e system. Only the
+// fields the tracker knows are filled in; Foundry supplies defaults for
+// the rest on import.
+func foundryActor(m *Minion) any {
+	type obj = map[string]any
+
+	var items []obj
+	if multi := m.Multiattack(); multi != "" {
+		items = append(items, obj{
+			"name": "Multiattack",
+			"type": "feat",
+			"img":  "icons/svg/combat.svg",
+			"system": obj{
+				"description": obj{"value": "<p>" + html.EscapeString(multi) + "</p>"},
+				"activation":  obj{"type": "action", "cost": 1},
+			},
+		})
+	}
+	for _, a := range vttAttacks(m) {
+		actionType := "mwak"
+		if isRanged(a) {
+			actionType = "rwak"
+		}
+		items = append(items, obj{
+			"name": a.Name,
+			"type": "weapon",
+			"img":  "icons/svg/sword.svg",
+			"system": obj{
+				"actionType":  actionType,
+				"ability":     "none",
+				"attackBonus": strconv.Itoa(a.ToHit),
+				"damage":      obj{"parts": [][]string{{a.Damage, a.DamageType}}, "versatile": ""},
+				"equipped":    true,
+				"proficient":  0,
+				"activation":  obj{"type": "action", "cost": 1},
+				"target":      obj{"value": 1, "type": "creature"},
+			},
+		})
+	}
+
+	system := obj{
+		"attributes": obj{
+			"hp": obj{"value": m.HP, "max": m.MaxHP, "temp": 0, "tempmax": 0, "formula": ""},
+			"ac": obj{"calc": "flat", "flat": m.AC},
+		},
+		"details": obj{
+			"biography": obj{"value": notesHTML(m.Notes)},
+		},
+	}
+	if m.CR != "" {
+		details := system["details"].(obj)
+		details["cr"] = crNumber(m.CR)
+		details["xp"] = obj{"value": m.XP}
+	}
+	if m.Scores != (abilityScores{}) {
+		abilities := obj{}
+		for _, a := range m.Abilities() {
+			proficient := 0
+			if a.Proficient {
+				proficient = 1
+			}
+			abilities[a.Code] = obj{"value": a.Score, "proficient": proficient}
+		}
+		system["abilities"] = abilities
+	}
+
+	return obj{
+		"name":   m.Name,
+		"type":   "npc",
+		"img":    "icons/svg/mystery-man.svg",
+		"system": system,
+		"items":  items,
+		"flags": obj{
+			"minion-tracker": obj{"id": m.ID},
+		},
+	}
+}
+
+// vttAttacks is what the exporters write as attacks: the named ones, or
+// the single Attack/Damage pair when there are none and it says anything.
+func vttAttacks(m *Minion) []attack {
+	if len(m.Attacks) > 0 {
+		return m.Attacks
+	}
+	if m.Damage != "" || m.Attack != 0 {
+		return []attack{{Name: "Attack", ToHit: m.Attack, Damage: m.Damage}}
+	}
+	return nil
+}
+
+// isRanged reports whether an attack is ranged only.
+func isRanged(a attack) bool {
+	reach := strings.ToLower(a.Reach)
+	return strings.Contains(reach, "range") && !strings.Contains(reach, "reach")
+}
+
+func notesHTML(notes string) string {
+	if notes == "" {
+		return ""
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(notes, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			b.WriteString("<p>" + html.EscapeString(line) + "</p>")
+		}
+	}
+	return b.String()
+}
+
+// roll20Attrib is one attribute on a Roll20 character sheet.
+type roll20Attrib struct {
+	Name    string `json:"name"`
+	Current string `json:"current"`
+	Max     string `json:"max"`
+}
+
+// roll20Character builds a character in the shape of Roll20's character
+// vault JSON, with attributes named for the D&D 5E by Roll20 NPC sheet.
+func roll20Character(m *Minion) any {
+	attrib := func(name, current, max string) roll20Attrib {
+		return roll20Attrib{Name: name, Current: current, Max: max}
+	}
+
+	attribs := []roll20Attrib{
+		attrib("npc", "1", ""),
+		attrib("npc_name", m.Name, ""),
+		attrib("hp", strconv.Itoa(m.HP), strconv.Itoa(m.MaxHP)),
+		attrib("npc_ac", strconv.Itoa(m.AC), ""),
+	}
+	if m.CR != "" {
+		attribs = append(attribs, attrib("npc_challenge", m.CR, ""), attrib("npc_xp", strconv.Itoa(m.XP), ""))
+	}
+	if m.Scores != (abilityScores{}) {
+		for i, a := range m.Abilities() {
+			attribs = append(attribs, attrib(strings.ToLower(abilityNames[i]), strconv.Itoa(a.Score), ""))
+		}
+		// The NPC sheet only shows the saves it is told are set.
+		for _, a := range m.Abilities() {
+			if a.Proficient {
+				attribs = append(attribs,
+					attrib("npc_"+a.Code+"_save_flag", "1", ""),
+					attrib("npc_"+a.Code+"_save", strconv.Itoa(a.Save), ""))
+			}
+		}
+	}
+	// Repeating rows need an id unique within the sheet; derive it from the
+	// minion so exports are reproducible.
+	rowID := func(i int) string { return fmt.Sprintf("repeating_npcaction_-mt%08d%02d_", m.ID, i) }
+	attacks := vttAttacks(m)
+	for i, a := range attacks {
+		row, kind := rowID(i), "Melee"
+		if isRanged(a) {
+			kind = "Ranged"
+		}
+		attribs = append(attribs,
+			attrib(row+"name", a.Name, ""),
+			attrib(row+"attack_flag", "on", ""),
+			attrib(row+"attack_type", kind, ""),
+			attrib(row+"attack_tohit", strconv.Itoa(a.ToHit), ""),
+			attrib(row+"attack_damage", a.Damage, ""),
+		)
+		if a.DamageType != "" {
+			attribs = append(attribs, attrib(row+"attack_damagetype", a.DamageType, ""))
+		}
+		if a.Reach != "" {
+			attribs = append(attribs, attrib(row+"attack_range", a.Reach, ""))
+		}
+	}
+	if multi := m.Multiattack(); multi != "" {
+		row := rowID(len(attacks))
+		attribs = append(attribs,
+			attrib(row+"name", "Multiattack", ""),
+			attrib(row+"description", multi, ""))
+	}
+
+	return map[string]any{
+		"schema_version": 2,
+		"type":           "character",
+		"character": map[string]any{
+			"name":             m.Name,
+			"bio":              notesHTML(m.Notes),
+			"gmnotes":          "",
+			"tags":             "[]",
+			"controlledby":     "",
+			"inplayerjournals": "",
+			"attribs":          attribs,
+			"abilities":        []any{},
+		},
+	}
+}
+
+func vttFilename(m *Minion, format string) string {
+	name := slugify(m.Name)
+	if name == "" {
+		name = "minion"
+	}
+	return fmt.Sprintf("%s-%d.%s.json", name, m.ID, format)
+}
+
+func exporterFor(w http.ResponseWriter, r *http.Request) (string, func(*Minion) any, bool) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatFoundry
+	}
+	export, ok := vttExporters[format]
+	if !ok {
+		http.Error(w, "unknown format "+strconv.Quote(format)+"; use foundry or roll20", http.StatusBadRequest)
+	}
+	return format, export, ok
+}
+
+func handleVTTExport(w http.ResponseWriter, r *http.Request) {
+	format, export, ok := exporterFor(w, r)
+	if !ok {
+		return
+	}
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	m, err := getMinion(campaignID(r), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+vttFilename(m, format)+`"`)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(export(m))
+}
+
+// handleVTTExportAll downloads every active minion as a zip with one
+// document per minion.
+func handleVTTExportAll(w http.ResponseWriter, r *http.Request) {
+	format, export, ok := exporterFor(w, r)
+	if !ok {
+		return
+	}
+	c := campaignFor(r)
+	minions, err := listActiveMinions(c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.zip"`, c.Slug, format))
+	zw := zip.NewWriter(w)
+	for i := range minions {
+		f, err := zw.Create(vttFilename(&minions[i], format))
+		if err != nil {
+			return
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(export(&minions[i])); err != nil {
+			return
+		}
+	}
+	zw.Close()
+}
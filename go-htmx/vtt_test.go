@@ -0,0 +1,147 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata/golden")
+
+// goldenMinion is the fixture every exporter golden file is built from
+func goldenMinion() *Minion {
+	return &Minion{
+		ID: 42, Name: "Goblin Boss", HP: 15, MaxHP: 21, AC: 17, Attack: 4, Damage: "1d6+2",
+		Notes:  "Multiattack. Two scimitar attacks.\nRedirect Attack. Swap places with a goblin <reaction>.",
+		Active: true, CampaignID: defaultCampaignID, Campaign: "default",
+		Scores: abilityScores{10, 14, 10, 10, 8, 10}, Saves: []string{"dex"}, ProfBonus: 2, CR: "1", XP: 200,
+		Attacks: []attack{
+			{Name: "Scimitar", ToHit: 4, Damage: "1d6+2", Reach: "reach 5 ft.", DamageType: "slashing", Uses: 2},
+			{Name: "Javelin", ToHit: 2, Damage: "1d6", Reach: "range 30/120 ft.", DamageType: "piercing"},
+		},
+	}
+}
+
+// checkGolden compares got against testdata/golden/name, or rewrites the
+// file when the tests run with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match golden file\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func marshalExport(t *testing.T, v any) []byte {
+	t.Helper()
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to marshal export: %v", err)
+	}
+	return append(data, '\n')
+}
+
+func TestFoundryGolden(t *testing.T) {
+	checkGolden(t, "foundry-goblin-boss.json", marshalExport(t, foundryActor(goldenMinion())))
+}
+
+func TestRoll20Golden(t *testing.T) {
+	checkGolden(t, "roll20-goblin-boss.json", marshalExport(t, roll20Character(goldenMinion())))
+}
+
+func TestVTTExportWithoutAttack(t *testing.T) {
+	m := &Minion{ID: 1, Name: "Commoner", HP: 4, MaxHP: 4, AC: 10}
+
+	actor := foundryActor(m).(map[string]any)
+	if items, _ := actor["items"].([]map[string]any); len(items) != 0 {
+		t.Errorf("Expected no weapon item, got %v", items)
+	}
+	char := roll20Character(m).(map[string]any)["character"].(map[string]any)
+	if attribs := char["attribs"].([]roll20Attrib); len(attribs) != 4 {
+		t.Errorf("Expected only core attributes, got %v", attribs)
+	}
+}
+
+func TestHandleVTTExport(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "pc", rolePlayer)
+	id := createTestMinion(t, testDB, &Minion{Name: "Goblin", HP: 7, MaxHP: 7, AC: 15, Attack: 4, Damage: "1d6+2"})
+
+	rec := serveAs(t, token, "GET", "/c/default/minions/"+itoa64(id)+"/export?format=roll20", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); cd != `attachment; filename="goblin-1.roll20.json"` {
+		t.Errorf("Unexpected Content-Disposition %q", cd)
+	}
+	var doc struct {
+		SchemaVersion int `json:"schema_version"`
+		Character     struct {
+			Name string `json:"name"`
+		} `json:"character"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil || doc.Character.Name != "Goblin" || doc.SchemaVersion != 2 {
+		t.Errorf("Unexpected Roll20 document: %s (%v)", rec.Body.String(), err)
+	}
+
+	if rec := serveAs(t, token, "GET", "/c/default/minions/"+itoa64(id)+"/export?format=fgu", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown format, got %d", rec.Code)
+	}
+	if rec := serveAs(t, token, "GET", "/c/default/minions/999/export", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing minion, got %d", rec.Code)
+	}
+}
+
+func TestHandleVTTExportAll(t *testing.T) {
+	testDB := useTestDB(t)
+	_, token := createTestUser(t, "gm", roleGM)
+	createTestMinion(t, testDB, &Minion{Name: "Goblin", HP: 7, MaxHP: 7, AC: 15, Attack: 4, Damage: "1d6+2"})
+	createTestMinion(t, testDB, &Minion{Name: "Wolf", HP: 11, MaxHP: 11, AC: 13, Attack: 4, Damage: "2d4+2"})
+	gone := createTestMinion(t, testDB, &Minion{Name: "Dismissed", HP: 1, MaxHP: 1})
+	deleteMinion(defaultCampaignID, gone, false)
+
+	rec := serveAs(t, token, "GET", "/c/default/minions/export?format=foundry", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("Expected a zip, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("Invalid zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		var actor struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(data, &actor); actor.Type != "npc" {
+			t.Errorf("%s: expected an npc actor, got %s", f.Name, data)
+		}
+	}
+	if len(names) != 2 || names[0] != "goblin-1.foundry.json" || names[1] != "wolf-2.foundry.json" {
+		t.Errorf("Unexpected zip contents %v", names)
+	}
+}